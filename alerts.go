@@ -0,0 +1,402 @@
+package sentiment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration written as "24h" in json
+type Duration time.Duration
+
+// MarshalJSON writes the duration as a string e.g. "1h30m0s"
+func (duration Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(duration).String())
+}
+
+// UnmarshalJSON reads a duration string e.g. "24h"
+func (duration *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration must be a string like \"24h\": %v", err)
+	}
+
+	parsed, err := time.ParseDuration(text)
+
+	if err != nil {
+		return err
+	}
+
+	*duration = Duration(parsed)
+
+	return nil
+}
+
+// ScoreRule alerts once on all the records scoring below Below
+type ScoreRule struct {
+	Below float32 `json:"below"`
+}
+
+// NegativeShareRule alerts when more than Above (0 - 1) of the records within Window are negative.
+// windows with less than MinRecords records are ignored, a zero Window looks at all records at once
+type NegativeShareRule struct {
+	Above      float64  `json:"above"`
+	Window     Duration `json:"window"`
+	MinRecords int      `json:"minRecords"`
+}
+
+// EntitySpikeRule alerts when an entity is mentioned more, or more negatively, in a window than in the windows before it.
+// the records are split into windows of Window (24h when zero), the baseline of a window are the BaselineWindows
+// windows before it (all of them when zero). a window with at least MinRecords mentions of the entity spikes when
+// the mentions are at least Growth (2 when zero) times the baseline's average mentions with an average score below
+// ScoreBelow, or when the average score is ScoreDrop below the baseline's average score, a zero ScoreDrop is disabled.
+// the first window has no baseline and records without a time are skipped, only Entities are watched when it is not empty
+type EntitySpikeRule struct {
+	Window          Duration `json:"window"`
+	BaselineWindows int      `json:"baselineWindows"`
+	MinRecords      int      `json:"minRecords"`
+	Growth          float64  `json:"growth"`
+	ScoreBelow      float32  `json:"scoreBelow"`
+	ScoreDrop       float32  `json:"scoreDrop"`
+	Entities        []string `json:"entities,omitempty"`
+}
+
+// AlertRules are the rules checked once an analysis completes, a nil rule is disabled
+type AlertRules struct {
+	Score         *ScoreRule         `json:"score,omitempty"`
+	NegativeShare *NegativeShareRule `json:"negativeShare,omitempty"`
+	EntitySpike   *EntitySpikeRule   `json:"entitySpike,omitempty"`
+}
+
+// DefaultAlertRules are used when no rules are configured
+func DefaultAlertRules() AlertRules {
+	return AlertRules{
+		Score: &ScoreRule{
+			Below: -0.6,
+		},
+		NegativeShare: &NegativeShareRule{
+			Above:      0.4,
+			Window:     Duration(24 * time.Hour),
+			MinRecords: 10,
+		},
+		EntitySpike: &EntitySpikeRule{
+			Window:          Duration(24 * time.Hour),
+			BaselineWindows: 7,
+			MinRecords:      3,
+			Growth:          2,
+			ScoreBelow:      -0.25,
+			ScoreDrop:       0.5,
+		},
+	}
+}
+
+// ParseAlertRules reads the json alert rules
+func ParseAlertRules(r io.Reader) (AlertRules, error) {
+	var rules AlertRules
+
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return rules, fmt.Errorf("parsing alert rules failed: %v", err)
+	}
+
+	if rules.NegativeShare != nil && (rules.NegativeShare.Above < 0 || rules.NegativeShare.Above > 1) {
+		return rules, fmt.Errorf("negativeShare.above must be between 0 and 1")
+	}
+
+	if rules.EntitySpike != nil {
+		spike := rules.EntitySpike
+
+		if spike.Window < 0 || spike.BaselineWindows < 0 || spike.Growth < 0 || spike.ScoreDrop < 0 {
+			return rules, fmt.Errorf("entitySpike must not be negative, except scoreBelow")
+		}
+	}
+
+	return rules, nil
+}
+
+const (
+	ScoreAlert         = "score"
+	NegativeShareAlert = "negativeShare"
+	EntitySpikeAlert   = "entitySpike"
+)
+
+// Alert is a single broken rule, published as an event
+type Alert struct {
+	Rule        string     `json:"rule"`
+	Message     string     `json:"message"`
+	Value       float64    `json:"value"`
+	Threshold   float64    `json:"threshold"`
+	Entity      string     `json:"entity,omitempty"`
+	WindowStart *time.Time `json:"windowStart,omitempty"`
+	WindowEnd   *time.Time `json:"windowEnd,omitempty"`
+	RecordIDs   []string   `json:"recordIds"`
+}
+
+// EvaluateAlerts checks records against every enabled rule
+func EvaluateAlerts(records []Record, rules AlertRules) []Alert {
+	alerts := make([]Alert, 0)
+
+	if rules.Score != nil {
+		alerts = append(alerts, evaluateScore(records, *rules.Score)...)
+	}
+
+	if rules.NegativeShare != nil {
+		alerts = append(alerts, evaluateNegativeShare(records, *rules.NegativeShare)...)
+	}
+
+	if rules.EntitySpike != nil {
+		alerts = append(alerts, evaluateEntitySpike(records, *rules.EntitySpike)...)
+	}
+
+	return alerts
+}
+
+// evaluateScore gathers every record scoring below the rule in a single alert, valued at the lowest score
+func evaluateScore(records []Record, rule ScoreRule) []Alert {
+	alert := Alert{
+		Rule:      ScoreAlert,
+		Threshold: float64(rule.Below),
+		RecordIDs: make([]string, 0),
+	}
+
+	for _, record := range records {
+		if record.Sentiment.Score >= rule.Below {
+			continue
+		}
+
+		if len(alert.RecordIDs) == 0 || float64(record.Sentiment.Score) < alert.Value {
+			alert.Value = float64(record.Sentiment.Score)
+		}
+
+		alert.RecordIDs = append(alert.RecordIDs, record.ID)
+	}
+
+	if len(alert.RecordIDs) == 0 {
+		return []Alert{}
+	}
+
+	alert.Message = fmt.Sprintf("%d records scored below %.2f, the lowest %.2f", len(alert.RecordIDs), rule.Below, alert.Value)
+
+	return []Alert{alert}
+}
+
+// evaluateNegativeShare slides a window over the records ordered by time,
+// once a window alerts the next window starts after it so the same records do not alert twice
+func evaluateNegativeShare(records []Record, rule NegativeShareRule) []Alert {
+	alerts := make([]Alert, 0)
+
+	sorted := make([]Record, len(records))
+	copy(sorted, records)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	window := time.Duration(rule.Window)
+
+	for start := 0; start < len(sorted); {
+		end := len(sorted)
+
+		if window > 0 {
+			end = start
+
+			for end < len(sorted) && sorted[end].Time.Sub(sorted[start].Time) <= window {
+				end++
+			}
+		}
+
+		windowRecords := sorted[start:end]
+		negativeIDs := make([]string, 0)
+
+		for _, record := range windowRecords {
+			if record.Sentiment.ParsedSentiment == "negative" {
+				negativeIDs = append(negativeIDs, record.ID)
+			}
+		}
+
+		share := float64(len(negativeIDs)) / float64(len(windowRecords))
+
+		if len(windowRecords) < rule.MinRecords || share <= rule.Above {
+			start++
+
+			continue
+		}
+
+		windowStart := windowRecords[0].Time
+		windowEnd := windowRecords[len(windowRecords)-1].Time
+
+		alerts = append(alerts, Alert{
+			Rule:        NegativeShareAlert,
+			Message:     fmt.Sprintf("%.0f%% of %d records are negative, above %.0f%%", share*100, len(windowRecords), rule.Above*100),
+			Value:       share,
+			Threshold:   rule.Above,
+			WindowStart: &windowStart,
+			WindowEnd:   &windowEnd,
+			RecordIDs:   negativeIDs,
+		})
+
+		start = end
+	}
+
+	return alerts
+}
+
+// entityWindow are the mentions of an entity within a window
+type entityWindow struct {
+	scoreSum  float64
+	recordIDs []string
+}
+
+// evaluateEntitySpike compares the mentions of each entity in each window against its baseline
+func evaluateEntitySpike(records []Record, rule EntitySpikeRule) []Alert {
+	alerts := make([]Alert, 0)
+
+	window := time.Duration(rule.Window)
+
+	if window <= 0 {
+		window = 24 * time.Hour
+	}
+
+	growth := rule.Growth
+
+	if growth == 0 {
+		growth = 2
+	}
+
+	watched := make(map[string]bool)
+
+	for _, entity := range rule.Entities {
+		watched[strings.ToLower(entity)] = true
+	}
+
+	var first time.Time
+
+	for _, record := range records {
+		if !record.Time.IsZero() && (first.IsZero() || record.Time.Before(first)) {
+			first = record.Time
+		}
+	}
+
+	// the windows of each entity by their index, counted from the first record
+	entityWindows := make(map[string]map[int]*entityWindow)
+	lastIndex := 0
+
+	for _, record := range records {
+		if record.Time.IsZero() {
+			continue
+		}
+
+		index := int(record.Time.Sub(first) / window)
+
+		if index > lastIndex {
+			lastIndex = index
+		}
+
+		// an entity counts once per record
+		seen := make(map[string]bool)
+
+		for _, entity := range record.Entity {
+			name := strings.ToLower(entity.Keyword)
+
+			if seen[name] || (len(watched) > 0 && !watched[name]) {
+				continue
+			}
+
+			seen[name] = true
+
+			if entityWindows[name] == nil {
+				entityWindows[name] = make(map[int]*entityWindow)
+			}
+
+			if entityWindows[name][index] == nil {
+				entityWindows[name][index] = &entityWindow{}
+			}
+
+			entityWindows[name][index].scoreSum += float64(entity.Score)
+			entityWindows[name][index].recordIDs = append(entityWindows[name][index].recordIDs, record.ID)
+		}
+	}
+
+	names := make([]string, 0)
+
+	for name := range entityWindows {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		windows := entityWindows[name]
+
+		for index := 1; index <= lastIndex; index++ {
+			current := windows[index]
+
+			if current == nil || len(current.recordIDs) < rule.MinRecords {
+				continue
+			}
+
+			baselineStart := 0
+
+			if rule.BaselineWindows > 0 && index-rule.BaselineWindows > 0 {
+				baselineStart = index - rule.BaselineWindows
+			}
+
+			// windows without mentions are part of the baseline too
+			baselineMentions := 0
+			baselineScoreSum := 0.0
+
+			for i := baselineStart; i < index; i++ {
+				if windows[i] != nil {
+					baselineMentions += len(windows[i].recordIDs)
+					baselineScoreSum += windows[i].scoreSum
+				}
+			}
+
+			mentions := len(current.recordIDs)
+			averageMentions := float64(baselineMentions) / float64(index-baselineStart)
+			averageScore := current.scoreSum / float64(mentions)
+
+			windowStart := first.Add(time.Duration(index) * window)
+			windowEnd := windowStart.Add(window)
+
+			alert := Alert{
+				Rule:        EntitySpikeAlert,
+				Entity:      name,
+				WindowStart: &windowStart,
+				WindowEnd:   &windowEnd,
+				RecordIDs:   current.recordIDs,
+			}
+
+			if float64(mentions) >= growth*averageMentions && averageScore < float64(rule.ScoreBelow) {
+				alert.Message = fmt.Sprintf("\"%s\" was mentioned in %d records with an average score of %.2f, up from %.1f per window before", name, mentions, averageScore, averageMentions)
+				alert.Value = float64(mentions)
+				alert.Threshold = growth * averageMentions
+
+				alerts = append(alerts, alert)
+
+				continue
+			}
+
+			if rule.ScoreDrop == 0 || baselineMentions == 0 {
+				continue
+			}
+
+			baselineScore := baselineScoreSum / float64(baselineMentions)
+
+			if averageScore > baselineScore-float64(rule.ScoreDrop) {
+				continue
+			}
+
+			alert.Message = fmt.Sprintf("\"%s\" was mentioned in %d records with an average score of %.2f, down from %.2f before", name, mentions, averageScore, baselineScore)
+			alert.Value = averageScore
+			alert.Threshold = baselineScore - float64(rule.ScoreDrop)
+
+			alerts = append(alerts, alert)
+		}
+	}
+
+	return alerts
+}
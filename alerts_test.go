@@ -0,0 +1,174 @@
+package sentiment
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// alertRecord is a record at hours after the start of the day, mentioning entities with score
+func alertRecord(id string, hours int, score float32, label string, entities ...string) Record {
+	record := Record{
+		ID:        id,
+		Time:      time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(hours) * time.Hour),
+		Sentiment: SentimentWrapper{Score: score, ParsedSentiment: label},
+	}
+
+	for _, entity := range entities {
+		record.Entity = append(record.Entity, EntityWrapper{Keyword: entity, Count: 1, Score: score})
+	}
+
+	return record
+}
+
+func TestEvaluateAlerts(t *testing.T) {
+	tests := []struct {
+		name          string
+		rules         AlertRules
+		records       []Record
+		wantRules     []string
+		wantValues    []float64
+		wantRecordIDs [][]string
+	}{
+		{
+			name:  "gathers the records below the score in a single alert",
+			rules: AlertRules{Score: &ScoreRule{Below: -0.5}},
+			records: []Record{
+				alertRecord("a", 0, -0.6, "negative"),
+				alertRecord("b", 1, 0.3, "positive"),
+				alertRecord("c", 2, -0.9, "negative"),
+				alertRecord("d", 3, -0.5, "negative"),
+			},
+			wantRules:     []string{ScoreAlert},
+			wantValues:    []float64{-0.9},
+			wantRecordIDs: [][]string{{"a", "c"}},
+		},
+		{
+			name:    "does not alert without records below the score",
+			rules:   AlertRules{Score: &ScoreRule{Below: -0.5}},
+			records: []Record{alertRecord("a", 0, 0.3, "positive")},
+		},
+		{
+			name:  "alerts on a window with too many negative records",
+			rules: AlertRules{NegativeShare: &NegativeShareRule{Above: 0.5, Window: Duration(time.Hour), MinRecords: 3}},
+			records: []Record{
+				alertRecord("a", 0, -0.6, "negative"),
+				alertRecord("b", 0, 0.3, "positive"),
+				alertRecord("c", 1, -0.6, "negative"),
+				alertRecord("d", 1, -0.6, "negative"),
+				alertRecord("e", 5, -0.6, "negative"),
+			},
+			wantRules:     []string{NegativeShareAlert},
+			wantValues:    []float64{0.75},
+			wantRecordIDs: [][]string{{"a", "c", "d"}},
+		},
+		{
+			name:  "ignores windows with too few records",
+			rules: AlertRules{NegativeShare: &NegativeShareRule{Above: 0.5, Window: Duration(time.Hour), MinRecords: 3}},
+			records: []Record{
+				alertRecord("a", 0, -0.6, "negative"),
+				alertRecord("b", 5, -0.6, "negative"),
+			},
+		},
+		{
+			name:  "alerts on an entity mentioned more and negatively",
+			rules: AlertRules{EntitySpike: &EntitySpikeRule{Window: Duration(24 * time.Hour), MinRecords: 3, ScoreBelow: -0.25}},
+			records: []Record{
+				alertRecord("a", 0, 0, "mixed", "Delivery"),
+				alertRecord("b", 24, -0.5, "negative", "delivery"),
+				alertRecord("c", 25, -0.5, "negative", "delivery", "Delivery"),
+				alertRecord("d", 26, -0.5, "negative", "delivery"),
+			},
+			wantRules:     []string{EntitySpikeAlert},
+			wantValues:    []float64{3},
+			wantRecordIDs: [][]string{{"b", "c", "d"}},
+		},
+		{
+			name:  "alerts on an entity whose score drops",
+			rules: AlertRules{EntitySpike: &EntitySpikeRule{Window: Duration(24 * time.Hour), MinRecords: 2, ScoreBelow: -0.25, ScoreDrop: 0.5}},
+			records: []Record{
+				alertRecord("a", 0, 0.5, "positive", "soup"),
+				alertRecord("b", 1, 0.5, "positive", "soup"),
+				alertRecord("c", 24, -0.2, "negative", "soup"),
+				alertRecord("d", 25, -0.2, "negative", "soup"),
+			},
+			wantRules:     []string{EntitySpikeAlert},
+			wantValues:    []float64{-0.2},
+			wantRecordIDs: [][]string{{"c", "d"}},
+		},
+		{
+			name:  "only watches the listed entities",
+			rules: AlertRules{EntitySpike: &EntitySpikeRule{Window: Duration(24 * time.Hour), MinRecords: 2, ScoreBelow: -0.25, Entities: []string{"soup"}}},
+			records: []Record{
+				alertRecord("a", 24, -0.5, "negative", "delivery"),
+				alertRecord("b", 25, -0.5, "negative", "delivery"),
+				alertRecord("c", 26, -0.5, "negative", "delivery"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			alerts := EvaluateAlerts(test.records, test.rules)
+
+			if len(alerts) != len(test.wantRules) {
+				t.Fatalf("got alerts %+v, want rules %v", alerts, test.wantRules)
+			}
+
+			for i := 0; i < len(alerts); i++ {
+				if alerts[i].Rule != test.wantRules[i] {
+					t.Errorf("alert %d: got rule %s, want %s", i, alerts[i].Rule, test.wantRules[i])
+				}
+
+				if math.Abs(alerts[i].Value-test.wantValues[i]) > 1e-6 {
+					t.Errorf("alert %d: got value %v, want %v", i, alerts[i].Value, test.wantValues[i])
+				}
+
+				if strings.Join(alerts[i].RecordIDs, ",") != strings.Join(test.wantRecordIDs[i], ",") {
+					t.Errorf("alert %d: got records %v, want %v", i, alerts[i].RecordIDs, test.wantRecordIDs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseAlertRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr bool
+	}{
+		{name: "reads the rules", rules: `{"score": {"below": -0.5}, "negativeShare": {"above": 0.3, "window": "12h"}}`},
+		{name: "rejects a share above 1", rules: `{"negativeShare": {"above": 2}}`, wantErr: true},
+		{name: "rejects a negative growth", rules: `{"entitySpike": {"growth": -1}}`, wantErr: true},
+		{name: "rejects a window that is not a duration", rules: `{"entitySpike": {"window": 24}}`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ParseAlertRules(strings.NewReader(test.rules)); (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestCustomerRecordsLeaveOutTheEmail(t *testing.T) {
+	comments := []CustomerAnalysis{
+		{Timestamp: "2021-01-01 10:00:00", Email: "jane@example.com", Comment: "cold soup"},
+		{Timestamp: "2021-01-01 10:00:00", Email: "john@example.com", Comment: "cold soup"},
+	}
+
+	records := CustomerRecords(comments)
+
+	for _, record := range records {
+		if strings.Contains(record.ID, "@") {
+			t.Errorf("record id \"%s\" holds the email", record.ID)
+		}
+	}
+
+	if records[0].ID == records[1].ID {
+		t.Errorf("the same comment sent twice at once got the same id \"%s\"", records[0].ID)
+	}
+}
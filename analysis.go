@@ -2,12 +2,18 @@ package sentiment
 
 import (
 	"context"
-	"fmt"
 
-	language "cloud.google.com/go/language/apiv1"
+	"github.com/googleapis/gax-go/v2"
 	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
 )
 
+// Analyzer is the part of Google's language client used for the analysis.
+// *language.Client satisfies it, so do the Recorder and Replayer
+type Analyzer interface {
+	AnalyzeSentiment(ctx context.Context, req *languagepb.AnalyzeSentimentRequest, opts ...gax.CallOption) (*languagepb.AnalyzeSentimentResponse, error)
+	AnalyzeEntitySentiment(ctx context.Context, req *languagepb.AnalyzeEntitySentimentRequest, opts ...gax.CallOption) (*languagepb.AnalyzeEntitySentimentResponse, error)
+}
+
 // RedditPost is the struct of a reddit post pulled from this repos' scraped post
 type RedditPost struct {
 	Title        string   `json:"title,omitempty"`
@@ -20,18 +26,44 @@ type RedditPost struct {
 	Timestamp    float32  `json:"timestamp,omitempty"` // same as CreatedAt
 	Comments     []string `json:"comments,omitempty"`
 	Analysis     Analysis `json:"analysis,omitempty"`
+
+	// NormalizedBody is the body sent to Google's api, set by PrepareSignals, it is never saved
+	NormalizedBody string `json:"-"`
+}
+
+// apiText is the text of the post sent to Google's api
+func (post RedditPost) apiText() string {
+	if post.NormalizedBody != "" {
+		return post.NormalizedBody
+	}
+
+	return post.Body
 }
 
 // Analysis hold the results from the sentiment analysis from Google's API
 type Analysis struct {
-	Sentiment SentimentWrapper `json:"sentiment"`
-	Entity    []EntityWrapper  `json:"entity"`
+	Sentiment SentimentWrapper   `json:"sentiment"`
+	Entity    []EntityWrapper    `json:"entity"`
+	Emotion   *EmotionScores     `json:"emotion,omitempty"`
+	Signals   *TextSignals       `json:"signals,omitempty"`
+	Cluster   *ClusterAssignment `json:"cluster,omitempty"`
+}
+
+// AnalysisWrapper allows the analysis to be written to json without a lot of nesting
+type AnalysisWrapper struct {
+	ID        string             `json:"id"`
+	Entity    []EntityWrapper    `json:"entity"`
+	Sentiment SentimentWrapper   `json:"sentiment"`
+	Emotion   *EmotionScores     `json:"emotion,omitempty"`
+	Signals   *TextSignals       `json:"signals,omitempty"`
+	Cluster   *ClusterAssignment `json:"cluster,omitempty"`
 }
 
 // EntityWrapper is a wrapper for a better output when writing to json
 type EntityWrapper struct {
-	Keyword string `json:"keyword"`
-	Count   int    `json:"count"`
+	Keyword string  `json:"keyword"`
+	Count   int     `json:"count"`
+	Score   float32 `json:"score,omitempty"`
 }
 
 // SentimentWrapper is a wrapper for a better output when writing to json
@@ -47,11 +79,18 @@ type Posts struct {
 }
 
 type CustomerAnalysis struct {
-	Timestamp string           `json:"timestamp"`
-	Email     string           `json:"email"`
-	Comment   string           `json:"comment"`
-	Sentiment SentimentWrapper `json:"sentiment"`
-	Entity    []EntityWrapper  `json:"entity"`
+	Timestamp  string            `json:"timestamp"`
+	Email      string            `json:"email,omitempty"`
+	Comment    string            `json:"comment"`
+	Rating     *float64          `json:"rating,omitempty"`
+	Sentiment  SentimentWrapper  `json:"sentiment"`
+	Entity     []EntityWrapper   `json:"entity"`
+	Aspects    []AspectSentiment `json:"aspects,omitempty"`
+	Emotion    *EmotionScores    `json:"emotion,omitempty"`
+	Redactions []Redaction       `json:"redactions,omitempty"`
+
+	// Extra holds the passthrough columns of the csv
+	Extra map[string]string `json:"extra,omitempty"`
 }
 
 func getOverallScore(entities []*languagepb.Entity) float32 {
@@ -67,19 +106,19 @@ func getOverallScore(entities []*languagepb.Entity) float32 {
 	return score / float32(entityCount)
 }
 
-// PrintAnalysis prints the results of the posts from the Sentiment Analysis api
-func PrintAnalysis(posts []RedditPost) {
-	for i := 0; i < len(posts); i++ {
-		post := posts[i]
+// getMentionScore is the average sentiment of the mentions of an entity
+func getMentionScore(mentions []*languagepb.EntityMention) float32 {
+	if len(mentions) == 0 {
+		return 0
+	}
+
+	score := float32(0)
 
-		fmt.Printf("post id: \"%s\"\n\ttitle: \"%s\"\n\tbody: \"%s\"\n\tsentiment for post: %s\n\tsentiment score: %f\n",
-			post.ID,
-			post.Title,
-			post.Body,
-			post.Analysis.Sentiment.ParsedSentiment,
-			post.Analysis.Sentiment.Score,
-		)
+	for _, mention := range mentions {
+		score += mention.Sentiment.GetScore()
 	}
+
+	return score / float32(len(mentions))
 }
 
 func parseSentiment(score float32) string {
@@ -98,11 +137,6 @@ func parseSentiment(score float32) string {
 	}
 }
 
-// PrintSentimentChart prints the sentiment analysis chart
-func PrintSentimentChart() {
-	fmt.Printf("To interpret the scores:\n\tpositive: > 0.1\n\tnegative: < 0.0\n\tneutral: 0.1\n\tmixed: 0.0 - 0.1\n")
-}
-
 // pruneEmptyPosts remove reddit posts where the submitter did not write text in the post
 func pruneEmptyPosts(posts []RedditPost) []RedditPost {
 	postsWithBodyText := make([]RedditPost, 0)
@@ -110,7 +144,7 @@ func pruneEmptyPosts(posts []RedditPost) []RedditPost {
 	for i := 0; i < len(posts); i++ {
 		post := posts[i]
 
-		if post.Body == "" {
+		if post.apiText() == "" {
 			continue
 		}
 
@@ -123,6 +157,7 @@ func pruneEmptyPosts(posts []RedditPost) []RedditPost {
 // getEntityCount counts all instances of each entity found
 func getEntityCount(entities []*languagepb.Entity) []EntityWrapper {
 	entityTracker := make(map[string]int)
+	mentionTracker := make(map[string][]*languagepb.EntityMention)
 	wrapper := make([]EntityWrapper, 0)
 
 	for i := 0; i < len(entities); i++ {
@@ -133,12 +168,15 @@ func getEntityCount(entities []*languagepb.Entity) []EntityWrapper {
 		} else {
 			entityTracker[entity.Name]++
 		}
+
+		mentionTracker[entity.Name] = append(mentionTracker[entity.Name], entity.Mentions...)
 	}
 
 	for entity := range entityTracker {
 		e := EntityWrapper{
 			Keyword: entity,
 			Count:   entityTracker[entity],
+			Score:   getMentionScore(mentionTracker[entity]),
 		}
 
 		wrapper = append(wrapper, e)
@@ -147,8 +185,8 @@ func getEntityCount(entities []*languagepb.Entity) []EntityWrapper {
 	return wrapper
 }
 
-func analyzeSentiment(ctx context.Context, client *language.Client, text string) (*languagepb.AnalyzeSentimentResponse, error) {
-	return client.AnalyzeSentiment(ctx, &languagepb.AnalyzeSentimentRequest{
+func analyzeSentiment(ctx context.Context, client Analyzer, text string) (*languagepb.AnalyzeSentimentResponse, error) {
+	response, err := client.AnalyzeSentiment(ctx, &languagepb.AnalyzeSentimentRequest{
 		Document: &languagepb.Document{
 			Source: &languagepb.Document_Content{
 				Content: text,
@@ -156,10 +194,20 @@ func analyzeSentiment(ctx context.Context, client *language.Client, text string)
 			Type: languagepb.Document_PLAIN_TEXT,
 		},
 	})
+
+	if err != nil {
+		return response, err
+	}
+
+	if isBilled(client) {
+		recordUsage(ctx, SentimentFeature, text)
+	}
+
+	return response, nil
 }
 
-func analyzeEntitySentiment(ctx context.Context, client *language.Client, text string) (*languagepb.AnalyzeEntitySentimentResponse, error) {
-	return client.AnalyzeEntitySentiment(ctx, &languagepb.AnalyzeEntitySentimentRequest{
+func analyzeEntitySentiment(ctx context.Context, client Analyzer, text string) (*languagepb.AnalyzeEntitySentimentResponse, error) {
+	response, err := client.AnalyzeEntitySentiment(ctx, &languagepb.AnalyzeEntitySentimentRequest{
 		Document: &languagepb.Document{
 			Source: &languagepb.Document_Content{
 				Content: text,
@@ -167,10 +215,20 @@ func analyzeEntitySentiment(ctx context.Context, client *language.Client, text s
 			Type: languagepb.Document_PLAIN_TEXT,
 		},
 	})
+
+	if err != nil {
+		return response, err
+	}
+
+	if isBilled(client) {
+		recordUsage(ctx, EntitySentimentFeature, text)
+	}
+
+	return response, nil
 }
 
 // AnalyzeEntitiesInPosts analyzes the entities in a reddit post and appends that analysis to each post
-func AnalyzeEntitesInPosts(ctx context.Context, client *language.Client, posts []RedditPost) ([]RedditPost, error) {
+func AnalyzeEntitesInPosts(ctx context.Context, client Analyzer, posts []RedditPost) ([]RedditPost, error) {
 	postsWithBodyText := pruneEmptyPosts(posts)
 	postCount := len(postsWithBodyText)
 
@@ -179,7 +237,7 @@ func AnalyzeEntitesInPosts(ctx context.Context, client *language.Client, posts [
 	for i := 0; i < postCount; i++ {
 		post := postsWithBodyText[i]
 
-		analysis, err := analyzeEntitySentiment(ctx, client, post.Body)
+		analysis, err := analyzeEntitySentiment(ctx, client, post.apiText())
 
 		if err != nil {
 			return []RedditPost{}, err
@@ -199,7 +257,6 @@ func AnalyzeEntitesInPosts(ctx context.Context, client *language.Client, posts [
 		postsWithBodyText[i] = post
 	}
 
-	fmt.Println(postsWithBodyText[0].Analysis.Sentiment.Score)
 	return postsWithBodyText, nil
 
 }
@@ -207,7 +264,7 @@ func AnalyzeEntitesInPosts(ctx context.Context, client *language.Client, posts [
 // analyzePosts send each reddit post's body to Google's api for sentiment analysis
 // mutates each post's Analyze.Score property and return the posts and no error
 // if an error is present then empty posts and nil
-func AnalyzePosts(ctx context.Context, client *language.Client, posts []RedditPost) ([]RedditPost, error) {
+func AnalyzePosts(ctx context.Context, client Analyzer, posts []RedditPost) ([]RedditPost, error) {
 	postsWithBodyText := pruneEmptyPosts(posts)
 	postCount := len(postsWithBodyText)
 
@@ -216,7 +273,7 @@ func AnalyzePosts(ctx context.Context, client *language.Client, posts []RedditPo
 	for i := 0; i < postCount; i++ {
 		post := postsWithBodyText[i]
 
-		analysis, err := analyzeSentiment(ctx, client, post.Body)
+		analysis, err := analyzeSentiment(ctx, client, post.apiText())
 
 		if err != nil {
 			return []RedditPost{}, err
@@ -232,7 +289,16 @@ func AnalyzePosts(ctx context.Context, client *language.Client, posts []RedditPo
 	return postsWithBodyText, nil
 }
 
-func AnalyzeCustomerComments(ctx context.Context, client *language.Client, comments []CustomerAnalysis) ([]CustomerAnalysis, error) {
+// AnalyzeCustomerComments redacts the personal information of the comments with redactor, the default
+// detectors when it is nil, then sends each comment to Google's api for entity sentiment
+func AnalyzeCustomerComments(ctx context.Context, client Analyzer, redactor *Redactor, comments []CustomerAnalysis) ([]CustomerAnalysis, error) {
+	if redactor == nil {
+		redactor = NewRedactor(DefaultDetectors()...)
+	}
+
+	// the raw comments never leave the project
+	comments = RedactCustomerComments(redactor, comments)
+
 	commentCount := len(comments)
 
 	for i := 0; i < commentCount; i++ {
@@ -258,6 +324,7 @@ func AnalyzeCustomerComments(ctx context.Context, client *language.Client, comme
 			wrapped := EntityWrapper{
 				Keyword: entity.Name,
 				Count:   len(entity.Mentions),
+				Score:   getMentionScore(entity.Mentions),
 			}
 
 			comments[i].Entity = append(comments[i].Entity, wrapped)
@@ -266,3 +333,25 @@ func AnalyzeCustomerComments(ctx context.Context, client *language.Client, comme
 
 	return comments, nil
 }
+
+// WrapPosts reduces analyzed posts to their analysis, as saved in analyzed files
+func WrapPosts(posts []RedditPost) []AnalysisWrapper {
+	postsWrapper := make([]AnalysisWrapper, 0)
+
+	for i := 0; i < len(posts); i++ {
+		post := posts[i]
+
+		wrappedPost := AnalysisWrapper{
+			ID:        post.ID,
+			Entity:    post.Analysis.Entity,
+			Sentiment: post.Analysis.Sentiment,
+			Emotion:   post.Analysis.Emotion,
+			Signals:   post.Analysis.Signals,
+			Cluster:   post.Analysis.Cluster,
+		}
+
+		postsWrapper = append(postsWrapper, wrappedPost)
+	}
+
+	return postsWrapper
+}
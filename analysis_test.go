@@ -0,0 +1,247 @@
+package sentiment
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis/languagetest"
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newTestClient starts a fake api and connects a client to it, both are closed with the test
+func newTestClient(t *testing.T) (*languagetest.Server, Analyzer) {
+	t.Helper()
+
+	server, err := languagetest.NewServer()
+
+	if err != nil {
+		t.Fatalf("starting fake api failed: %v", err)
+	}
+
+	t.Cleanup(server.Close)
+
+	client, err := server.NewClient(context.Background())
+
+	if err != nil {
+		t.Fatalf("creating client failed: %v", err)
+	}
+
+	t.Cleanup(func() { client.Close() })
+
+	return server, client
+}
+
+// errorCode is the grpc code of err, a context that ran out before the call is DeadlineExceeded too
+func errorCode(err error) codes.Code {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return codes.DeadlineExceeded
+	}
+
+	return status.Code(err)
+}
+
+func TestAnalyzeSentiment(t *testing.T) {
+	tests := []struct {
+		name         string
+		response     *languagepb.AnalyzeSentimentResponse
+		err          error
+		latency      time.Duration
+		wantScore    float32
+		wantCode     codes.Code
+		wantRequests int
+	}{
+		{
+			name:         "scores the document",
+			response:     languagetest.SentimentResponse(0.8),
+			wantScore:    0.8,
+			wantCode:     codes.OK,
+			wantRequests: 1,
+		},
+		{
+			name:     "returns the api error",
+			err:      status.Error(codes.InvalidArgument, "document is too long"),
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "returns quota errors",
+			err:      status.Error(codes.ResourceExhausted, "quota exceeded"),
+			wantCode: codes.ResourceExhausted,
+		},
+		{
+			name:     "gives up once the context is done",
+			response: languagetest.SentimentResponse(0.8),
+			latency:  5 * time.Second,
+			wantCode: codes.DeadlineExceeded,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, client := newTestClient(t)
+
+			server.SetLatency(test.latency)
+			server.QueueSentiment(test.response, test.err)
+
+			usage := NewUsage()
+
+			ctx, cancel := context.WithTimeout(WithUsage(context.Background(), usage), 500*time.Millisecond)
+
+			defer cancel()
+
+			response, err := analyzeSentiment(ctx, client, "the text")
+
+			if code := errorCode(err); code != test.wantCode {
+				t.Fatalf("got error %v, want code %s", err, test.wantCode)
+			}
+
+			if err == nil && response.DocumentSentiment.Score != test.wantScore {
+				t.Errorf("got score %v, want %v", response.DocumentSentiment.Score, test.wantScore)
+			}
+
+			// only answered requests are billed
+			if requests := usage.Features[SentimentFeature].Requests; requests != test.wantRequests {
+				t.Errorf("got %d billed requests, want %d", requests, test.wantRequests)
+			}
+		})
+	}
+}
+
+func TestAnalyzeEntitySentiment(t *testing.T) {
+	tests := []struct {
+		name         string
+		response     *languagepb.AnalyzeEntitySentimentResponse
+		err          error
+		latency      time.Duration
+		wantEntities int
+		wantCode     codes.Code
+		wantRequests int
+	}{
+		{
+			name:         "returns the entities",
+			response:     languagetest.EntitySentimentResponse(languagetest.Entity("pizza", 0.9, 0.5), languagetest.Entity("delivery", -0.7)),
+			wantEntities: 2,
+			wantCode:     codes.OK,
+			wantRequests: 1,
+		},
+		{
+			name:         "returns no entities",
+			response:     languagetest.EntitySentimentResponse(),
+			wantCode:     codes.OK,
+			wantRequests: 1,
+		},
+		{
+			name:     "returns the api error",
+			err:      status.Error(codes.InvalidArgument, "unsupported language"),
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "gives up once the context is done",
+			response: languagetest.EntitySentimentResponse(languagetest.Entity("pizza", 0.9)),
+			latency:  5 * time.Second,
+			wantCode: codes.DeadlineExceeded,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, client := newTestClient(t)
+
+			server.SetLatency(test.latency)
+			server.QueueEntitySentiment(test.response, test.err)
+
+			usage := NewUsage()
+
+			ctx, cancel := context.WithTimeout(WithUsage(context.Background(), usage), 500*time.Millisecond)
+
+			defer cancel()
+
+			response, err := analyzeEntitySentiment(ctx, client, "the text")
+
+			if code := errorCode(err); code != test.wantCode {
+				t.Fatalf("got error %v, want code %s", err, test.wantCode)
+			}
+
+			if err == nil && len(response.Entities) != test.wantEntities {
+				t.Errorf("got %d entities, want %d", len(response.Entities), test.wantEntities)
+			}
+
+			if requests := usage.Features[EntitySentimentFeature].Requests; requests != test.wantRequests {
+				t.Errorf("got %d billed requests, want %d", requests, test.wantRequests)
+			}
+		})
+	}
+}
+
+func TestAnalyzePosts(t *testing.T) {
+	tests := []struct {
+		name       string
+		posts      []RedditPost
+		replies    []error
+		wantScores []float32
+		wantErr    bool
+	}{
+		{
+			name: "scores every post with a body",
+			posts: []RedditPost{
+				{ID: "a", Body: "great"},
+				{ID: "b"},
+				{ID: "c", Body: "awful"},
+			},
+			replies:    []error{nil, nil},
+			wantScores: []float32{0.5, 0.5},
+		},
+		{
+			name: "fails on the first api error",
+			posts: []RedditPost{
+				{ID: "a", Body: "great"},
+				{ID: "b", Body: "awful"},
+			},
+			replies: []error{nil, status.Error(codes.InvalidArgument, "bad document")},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, client := newTestClient(t)
+
+			for _, err := range test.replies {
+				if err != nil {
+					server.QueueSentiment(nil, err)
+
+					continue
+				}
+
+				server.QueueSentiment(languagetest.SentimentResponse(0.5), nil)
+			}
+
+			posts, err := AnalyzePosts(context.Background(), client, test.posts)
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+
+			if test.wantErr {
+				return
+			}
+
+			if len(posts) != len(test.wantScores) {
+				t.Fatalf("got %d posts, want %d", len(posts), len(test.wantScores))
+			}
+
+			for i := 0; i < len(posts); i++ {
+				if posts[i].Analysis.Sentiment.Score != test.wantScores[i] {
+					t.Errorf("post %s scored %v, want %v", posts[i].ID, posts[i].Analysis.Sentiment.Score, test.wantScores[i])
+				}
+			}
+
+			if calls := server.Calls(); len(calls) != len(test.replies) {
+				t.Errorf("got %d calls, want %d", len(calls), len(test.replies))
+			}
+		})
+	}
+}
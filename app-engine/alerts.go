@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+)
+
+const alertEventType = "sentiment-alert"
+
+// AlertEvent is the payload published to the topic for each rule an analysis broke
+type AlertEvent struct {
+	Source   string            `json:"source"`
+	Analysis string            `json:"analysis"`
+	Rule     string            `json:"rule"`
+	Alerts   []sentiment.Alert `json:"alerts"`
+}
+
+// groupAlerts gathers the alerts by rule, in the order the rules first broke
+func groupAlerts(alerts []sentiment.Alert) ([]string, map[string][]sentiment.Alert) {
+	rules := make([]string, 0)
+	alertsByRule := make(map[string][]sentiment.Alert)
+
+	for _, alert := range alerts {
+		if _, ok := alertsByRule[alert.Rule]; !ok {
+			rules = append(rules, alert.Rule)
+		}
+
+		alertsByRule[alert.Rule] = append(alertsByRule[alert.Rule], alert)
+	}
+
+	return rules, alertsByRule
+}
+
+// loadAlertRules reads the json rules file, or uses the default rules
+func loadAlertRules(rulesFilename string) (sentiment.AlertRules, error) {
+	if rulesFilename == "" {
+		return sentiment.DefaultAlertRules(), nil
+	}
+
+	rulesFile, err := os.Open(rulesFilename)
+
+	if err != nil {
+		return sentiment.AlertRules{}, fmt.Errorf("opening alert rules failed: %v", err)
+	}
+
+	defer rulesFile.Close()
+
+	return sentiment.ParseAlertRules(rulesFile)
+}
+
+// wrapperRecords joins the analysis of the wrapped posts with the time and text of the original posts
+func wrapperRecords(wrappedPosts []sentiment.AnalysisWrapper, posts []sentiment.RedditPost) []sentiment.Record {
+	postRecords := make(map[string]sentiment.Record)
+
+	for _, record := range sentiment.PostRecords(posts) {
+		postRecords[record.ID] = record
+	}
+
+	records := make([]sentiment.Record, 0)
+
+	for i := 0; i < len(wrappedPosts); i++ {
+		wrappedPost := wrappedPosts[i]
+		record := postRecords[wrappedPost.ID]
+
+		record.ID = wrappedPost.ID
+		record.Sentiment = wrappedPost.Sentiment
+		record.Entity = wrappedPost.Entity
+
+		records = append(records, record)
+	}
+
+	return records
+}
+
+// publishAlerts checks the records of a completed analysis against the alert rules
+// and publishes a single event to the topic for each broken rule, the alerts are only logged without a topic
+func (wrapper appWrapper) publishAlerts(analysis string, source string, records []sentiment.Record) error {
+	alerts := sentiment.EvaluateAlerts(records, wrapper.alertRules)
+
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	rules, alertsByRule := groupAlerts(alerts)
+
+	if wrapper.pubsubTopic == nil {
+		for _, alert := range alerts {
+			log.Printf("%s alert for \"%s\": %s\n", alert.Rule, source, alert.Message)
+		}
+
+		return nil
+	}
+
+	log.Printf("publishing %d alerts of %d rules for \"%s\"\n", len(alerts), len(rules), source)
+
+	results := make([]*pubsub.PublishResult, 0)
+
+	for _, rule := range rules {
+		alertBytes, err := json.Marshal(AlertEvent{
+			Source:   source,
+			Analysis: analysis,
+			Rule:     rule,
+			Alerts:   alertsByRule[rule],
+		})
+
+		if err != nil {
+			return err
+		}
+
+		eventBytes, err := json.Marshal(&PubSubEvent{
+			EventType: alertEventType,
+			Payload:   string(alertBytes),
+		})
+
+		if err != nil {
+			return err
+		}
+
+		results = append(results, wrapper.pubsubTopic.Publish(wrapper.ctx, &pubsub.Message{
+			Data: eventBytes,
+			Attributes: map[string]string{
+				"eventType": alertEventType,
+				"rule":      rule,
+			},
+		}))
+	}
+
+	publishCTX, publishCTXCancel := context.WithTimeout(wrapper.ctx, time.Duration(wrapper.config.PubSub.Timeout))
+
+	defer publishCTXCancel()
+
+	for _, result := range results {
+		if _, err := result.Get(publishCTX); err != nil {
+			return fmt.Errorf("publishing alert failed: %v", err)
+		}
+	}
+
+	return nil
+}
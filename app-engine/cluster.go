@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+)
+
+// ClusterReport is the saved result of clustering an analyzed file
+type ClusterReport struct {
+	Filename string              `json:"filename"`
+	Clusters []sentiment.Cluster `json:"clusters"`
+}
+
+// parseClusterOptions reads k, seed and topTerms from the query, k defaults to the configured one
+func parseClusterOptions(query url.Values, defaultK int) (sentiment.ClusterOptions, error) {
+	options := sentiment.ClusterOptions{K: defaultK}
+
+	var err error
+
+	if query.Get("k") != "" {
+		if options.K, err = strconv.Atoi(query.Get("k")); err != nil {
+			return options, fmt.Errorf("k must be a number of clusters: %v", err)
+		}
+	}
+
+	if query.Get("seed") != "" {
+		if options.Seed, err = strconv.ParseInt(query.Get("seed"), 10, 64); err != nil {
+			return options, fmt.Errorf("seed must be a number: %v", err)
+		}
+	}
+
+	if query.Get("topTerms") != "" {
+		if options.TopTerms, err = strconv.Atoi(query.Get("topTerms")); err != nil {
+			return options, fmt.Errorf("topTerms must be a number: %v", err)
+		}
+	}
+
+	return options, nil
+}
+
+func addClusterToWrapper(posts []sentiment.RedditPost, wrapperPosts []sentiment.AnalysisWrapper) []sentiment.AnalysisWrapper {
+	for i := 0; i < len(posts); i++ {
+		post := posts[i]
+		for j := 0; j < len(wrapperPosts); j++ {
+			wrappedPost := wrapperPosts[j]
+
+			if post.ID == wrappedPost.ID {
+				wrapperPosts[j].Cluster = post.Analysis.Cluster
+			}
+		}
+	}
+
+	return wrapperPosts
+}
+
+// startClusterAnalysis clusters the posts of an analyzed file by their text, assigns each analyzed post
+// its cluster and saves the clusters next to it
+func (wrapper appWrapper) startClusterAnalysis(filename string, options sentiment.ClusterOptions) (*JobSummary, error) {
+	summary := newJobSummary("cluster", filename)
+
+	log.Printf("downloading \"%s\"...\n", filename)
+
+	wrappedPosts, err := wrapper.fetchRedditAnalyzedPosts(filename)
+
+	if err != nil {
+		return summary, fmt.Errorf("failed to fetch reddit posts from \"%s\": %v", filename, err)
+	}
+
+	// the analysis has no text, so the posts are clustered from the original file
+	originalFilename := strings.Replace(filename, "_analyzed", "", 1)
+
+	originalPosts, err := wrapper.fetchRedditPosts(originalFilename)
+
+	if err != nil {
+		return summary, fmt.Errorf("failed to fetch the original posts \"%s\": %v", originalFilename, err)
+	}
+
+	originalsByID := make(map[string]sentiment.RedditPost)
+
+	for i := 0; i < len(originalPosts); i++ {
+		originalsByID[originalPosts[i].ID] = originalPosts[i]
+	}
+
+	posts := make([]sentiment.RedditPost, 0)
+
+	for i := 0; i < len(wrappedPosts); i++ {
+		post, ok := originalsByID[wrappedPosts[i].ID]
+
+		if !ok {
+			continue
+		}
+
+		post.Analysis.Sentiment = wrappedPosts[i].Sentiment
+		posts = append(posts, post)
+	}
+
+	log.Printf("clustering %d posts...\n", len(posts))
+
+	posts, clusters := sentiment.ClusterPosts(posts, options)
+	wrappedPosts = addClusterToWrapper(posts, wrappedPosts)
+
+	log.Printf("found %d clusters\n", len(clusters))
+
+	if err := wrapper.saveAnalyzedPosts(filename, wrappedPosts); err != nil {
+		return summary, fmt.Errorf("failed to upload analyzed posts: %v", err)
+	}
+
+	report := ClusterReport{
+		Filename: filename,
+		Clusters: clusters,
+	}
+
+	if err := wrapper.saveReport(wrapper.config.Storage.RedditPrefix, appendToFilename(filename, "clusters"), report); err != nil {
+		return summary, fmt.Errorf("failed to upload clusters: %v", err)
+	}
+
+	log.Printf("uploaded clusters of '%s'\n", wrapper.config.Storage.RedditPrefix+"/"+filename)
+
+	summary.OutputFilename = appendToFilename(filename, "clusters")
+	summary.RecordCount = len(posts)
+	summary.FinishedAt = time.Now()
+
+	return summary, nil
+}
+
+// clusterHandler groups the posts of an analyzed file into themes
+// e.g. /api/cluster?filename=posts_analyzed.json&k=8
+func (wrapper appWrapper) clusterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("must be GET request"))
+
+		return
+	}
+
+	query := r.URL.Query()
+
+	// this file must live within cloud storage
+	filename := query.Get("filename")
+
+	if filename == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing required input filename"))
+
+		return
+	}
+
+	if !isAnalysisFilename(filename) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("filename must be an analyzed file, analyze the posts first"))
+
+		return
+	}
+
+	if _, err := parseClusterOptions(query, wrapper.config.Thresholds.ClusterK); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+
+		return
+	}
+
+	wrapper.acceptJob(w, r, "cluster", filename)
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+)
+
+// Config is the configuration of the server, read from the json file in CONFIG_FILE
+// and overridden by the environment variables noted on each field
+type Config struct {
+	// ProjectID is the Google Cloud project of the pubsub topic, PROJECT_ID
+	ProjectID string `json:"projectId"`
+
+	// Port the server listens on, PORT
+	Port string `json:"port"`
+
+	Storage    StorageConfig    `json:"storage"`
+	PubSub     PubSubConfig     `json:"pubsub"`
+	Language   LanguageConfig   `json:"language"`
+	Analysis   AnalysisConfig   `json:"analysis"`
+	Thresholds ThresholdsConfig `json:"thresholds"`
+	Jobs       JobsConfig       `json:"jobs"`
+}
+
+// StorageConfig is where the files of the server live
+type StorageConfig struct {
+	// Bucket is the cloud storage bucket, STORAGE_BUCKET
+	Bucket string `json:"bucket"`
+
+	// Dir keeps the files in a local directory instead of the bucket, STORAGE_DIR
+	Dir string `json:"dir"`
+
+	// RedditPrefix is the folder of the reddit posts, STORAGE_REDDIT_PREFIX
+	RedditPrefix string `json:"redditPrefix"`
+
+	// CustomerPrefix is the folder of the customer comments, STORAGE_CUSTOMER_PREFIX
+	CustomerPrefix string `json:"customerPrefix"`
+
+	// Timeout of a single read or write, STORAGE_TIMEOUT
+	Timeout sentiment.Duration `json:"timeout"`
+}
+
+// PubSubConfig is the topic events are published to and pushed from
+type PubSubConfig struct {
+	// Topic must already exist, alerts are only logged when it is empty, PUBSUB_TOPIC
+	Topic string `json:"topic"`
+
+	// Timeout of publishing a message, PUBSUB_TIMEOUT
+	Timeout sentiment.Duration `json:"timeout"`
+
+	// PushToken must be the token query parameter of the push subscription's endpoint when set, PUBSUB_PUSH_TOKEN
+	PushToken string `json:"pushToken"`
+
+	// PushAudience is the audience of the push subscription's OIDC token, it is verified when set, PUBSUB_PUSH_AUDIENCE
+	// the push endpoint is only registered with a PushToken or a PushAudience
+	PushAudience string `json:"pushAudience"`
+
+	// PushServiceAccount must be the email of the verified OIDC token when set, PUBSUB_PUSH_SERVICE_ACCOUNT
+	PushServiceAccount string `json:"pushServiceAccount"`
+}
+
+// LanguageConfig chooses where the analysis comes from
+type LanguageConfig struct {
+	// Backend is google, emulator or replay, LANGUAGE_BACKEND
+	// it is inferred from the emulator host and replay fixture when empty
+	Backend string `json:"backend"`
+
+	// EmulatorHost is the address of a fake api, LANGUAGE_EMULATOR_HOST
+	EmulatorHost string `json:"emulatorHost"`
+
+	// ReplayFixture is the recording the replay backend answers from, LANGUAGE_REPLAY_FIXTURE
+	ReplayFixture string `json:"replayFixture"`
+
+	// RecordFixture saves the responses of the google or emulator backend, LANGUAGE_RECORD_FIXTURE
+	RecordFixture string `json:"recordFixture"`
+}
+
+// AnalysisConfig points to the files that tune the analysis, the defaults are used when empty
+// the key of the pseudonymize email policy is a secret, so it is only read from EMAIL_HMAC_KEY
+type AnalysisConfig struct {
+	// EmailPolicy is keep, drop or pseudonymize, EMAIL_POLICY
+	EmailPolicy string `json:"emailPolicy"`
+
+	// CustomerColumns is a json ColumnMapping, CUSTOMER_COLUMNS
+	CustomerColumns json.RawMessage `json:"customerColumns"`
+
+	// AspectTaxonomy is a json taxonomy file, ASPECT_TAXONOMY
+	AspectTaxonomy string `json:"aspectTaxonomy"`
+
+	// AlertRules is a json rules file, ALERT_RULES
+	AlertRules string `json:"alertRules"`
+
+	// EmotionLexicon is an NRC formatted lexicon file, EMOTION_LEXICON
+	EmotionLexicon string `json:"emotionLexicon"`
+
+	// RedactionDetectors is a json list of sentiment.DetectorConfig replacing the default detectors, REDACTION_DETECTORS
+	RedactionDetectors json.RawMessage `json:"redactionDetectors"`
+
+	// RedactionDictionary is a file of names to redact, one per line, REDACTION_DICTIONARY
+	RedactionDictionary string `json:"redactionDictionary"`
+
+	// RedactionNameToken replaces the names of the dictionary, REDACTION_NAME_TOKEN
+	RedactionNameToken string `json:"redactionNameToken"`
+}
+
+// ThresholdsConfig are the defaults of the endpoints when the query leaves them out
+type ThresholdsConfig struct {
+	// Drift is used by /api/drift, DRIFT_METHOD, DRIFT_THRESHOLD and DRIFT_MIN_RECORDS
+	Drift sentiment.DriftOptions `json:"drift"`
+
+	// GraphMinWeight is the least records an edge of /api/graph needs, GRAPH_MIN_WEIGHT
+	GraphMinWeight int `json:"graphMinWeight"`
+
+	// ClusterK is the amount of clusters of /api/cluster, 0 picks it from the posts, CLUSTER_K
+	ClusterK int `json:"clusterK"`
+}
+
+// JobsConfig limits the analysis jobs that run at once and keeps them in the store
+type JobsConfig struct {
+	// Workers is the amount of jobs running at once, the others wait queued, JOB_WORKERS
+	Workers int `json:"workers"`
+
+	// History is the amount of finished jobs kept in the store for /api/jobs, JOB_HISTORY
+	History int `json:"history"`
+
+	// Prefix is the folder of the saved jobs, JOB_PREFIX
+	Prefix string `json:"prefix"`
+
+	// Lease is how long a job stays with an instance that stopped renewing it, JOB_LEASE
+	Lease sentiment.Duration `json:"lease"`
+
+	// MaxAttempts is the times an interrupted job is started before it fails, JOB_MAX_ATTEMPTS
+	MaxAttempts int `json:"maxAttempts"`
+}
+
+// defaultConfig is the configuration of the deployed project
+func defaultConfig() Config {
+	return Config{
+		ProjectID: "sada-u-sess-3-firestore",
+		Port:      "3000",
+		Storage: StorageConfig{
+			Bucket:         "rube_goldberg_project",
+			RedditPrefix:   "reddit_data",
+			CustomerPrefix: "customer_data",
+			Timeout:        sentiment.Duration(50 * time.Second),
+		},
+		PubSub: PubSubConfig{
+			Topic:   "rube_goldberg",
+			Timeout: sentiment.Duration(30 * time.Second),
+		},
+		Analysis: AnalysisConfig{
+			RedactionNameToken: "[NAME]",
+		},
+		Thresholds: ThresholdsConfig{
+			GraphMinWeight: 1,
+		},
+		Jobs: JobsConfig{
+			Workers:     2,
+			History:     500,
+			Prefix:      "jobs",
+			Lease:       sentiment.Duration(2 * time.Minute),
+			MaxAttempts: 3,
+		},
+	}
+}
+
+// loadConfig reads the file in CONFIG_FILE over the defaults, applies the environment and validates the result
+func loadConfig() (Config, error) {
+	config := defaultConfig()
+
+	if configFilename := os.Getenv("CONFIG_FILE"); configFilename != "" {
+		configFile, err := os.Open(configFilename)
+
+		if err != nil {
+			return config, fmt.Errorf("opening config file failed: %v", err)
+		}
+
+		defer configFile.Close()
+
+		decoder := json.NewDecoder(configFile)
+		decoder.DisallowUnknownFields()
+
+		if err := decoder.Decode(&config); err != nil {
+			return config, fmt.Errorf("parsing config file \"%s\" failed: %v", configFilename, err)
+		}
+	}
+
+	if err := config.applyEnv(os.LookupEnv); err != nil {
+		return config, err
+	}
+
+	if config.Language.Backend == "" {
+		config.Language.Backend = "google"
+
+		if config.Language.ReplayFixture != "" {
+			config.Language.Backend = "replay"
+		} else if config.Language.EmulatorHost != "" {
+			config.Language.Backend = "emulator"
+		}
+	}
+
+	return config, config.validate()
+}
+
+// envOverrides collects the environment variables that did not parse
+type envOverrides struct {
+	lookup   func(string) (string, bool)
+	problems []string
+}
+
+func (overrides *envOverrides) string(name string, field *string) {
+	if value, ok := overrides.lookup(name); ok {
+		*field = value
+	}
+}
+
+func (overrides *envOverrides) int(name string, field *int) {
+	value, ok := overrides.lookup(name)
+
+	if !ok {
+		return
+	}
+
+	parsed, err := strconv.Atoi(value)
+
+	if err != nil {
+		overrides.problems = append(overrides.problems, fmt.Sprintf("%s must be a number: %v", name, err))
+
+		return
+	}
+
+	*field = parsed
+}
+
+func (overrides *envOverrides) float(name string, field *float64) {
+	value, ok := overrides.lookup(name)
+
+	if !ok {
+		return
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+
+	if err != nil {
+		overrides.problems = append(overrides.problems, fmt.Sprintf("%s must be a number: %v", name, err))
+
+		return
+	}
+
+	*field = parsed
+}
+
+func (overrides *envOverrides) duration(name string, field *sentiment.Duration) {
+	value, ok := overrides.lookup(name)
+
+	if !ok {
+		return
+	}
+
+	parsed, err := time.ParseDuration(value)
+
+	if err != nil {
+		overrides.problems = append(overrides.problems, fmt.Sprintf("%s must be a duration like 30s: %v", name, err))
+
+		return
+	}
+
+	*field = sentiment.Duration(parsed)
+}
+
+// applyEnv overrides the fields with the environment variables that are set
+func (config *Config) applyEnv(lookup func(string) (string, bool)) error {
+	overrides := envOverrides{lookup: lookup}
+
+	overrides.string("PROJECT_ID", &config.ProjectID)
+	overrides.string("PORT", &config.Port)
+
+	overrides.string("STORAGE_BUCKET", &config.Storage.Bucket)
+	overrides.string("STORAGE_DIR", &config.Storage.Dir)
+	overrides.string("STORAGE_REDDIT_PREFIX", &config.Storage.RedditPrefix)
+	overrides.string("STORAGE_CUSTOMER_PREFIX", &config.Storage.CustomerPrefix)
+	overrides.duration("STORAGE_TIMEOUT", &config.Storage.Timeout)
+
+	overrides.string("PUBSUB_TOPIC", &config.PubSub.Topic)
+	overrides.duration("PUBSUB_TIMEOUT", &config.PubSub.Timeout)
+	overrides.string("PUBSUB_PUSH_TOKEN", &config.PubSub.PushToken)
+	overrides.string("PUBSUB_PUSH_AUDIENCE", &config.PubSub.PushAudience)
+	overrides.string("PUBSUB_PUSH_SERVICE_ACCOUNT", &config.PubSub.PushServiceAccount)
+
+	overrides.string("LANGUAGE_BACKEND", &config.Language.Backend)
+	overrides.string("LANGUAGE_EMULATOR_HOST", &config.Language.EmulatorHost)
+	overrides.string("LANGUAGE_REPLAY_FIXTURE", &config.Language.ReplayFixture)
+	overrides.string("LANGUAGE_RECORD_FIXTURE", &config.Language.RecordFixture)
+
+	overrides.string("EMAIL_POLICY", &config.Analysis.EmailPolicy)
+	overrides.string("ASPECT_TAXONOMY", &config.Analysis.AspectTaxonomy)
+	overrides.string("ALERT_RULES", &config.Analysis.AlertRules)
+	overrides.string("EMOTION_LEXICON", &config.Analysis.EmotionLexicon)
+	overrides.string("REDACTION_DICTIONARY", &config.Analysis.RedactionDictionary)
+	overrides.string("REDACTION_NAME_TOKEN", &config.Analysis.RedactionNameToken)
+
+	if columnsJSON, ok := lookup("CUSTOMER_COLUMNS"); ok {
+		config.Analysis.CustomerColumns = json.RawMessage(columnsJSON)
+	}
+
+	if detectorsJSON, ok := lookup("REDACTION_DETECTORS"); ok {
+		config.Analysis.RedactionDetectors = json.RawMessage(detectorsJSON)
+	}
+
+	method := string(config.Thresholds.Drift.Method)
+	overrides.string("DRIFT_METHOD", &method)
+	config.Thresholds.Drift.Method = sentiment.DriftMethod(method)
+
+	overrides.float("DRIFT_THRESHOLD", &config.Thresholds.Drift.Threshold)
+	overrides.int("DRIFT_MIN_RECORDS", &config.Thresholds.Drift.MinRecords)
+	overrides.int("GRAPH_MIN_WEIGHT", &config.Thresholds.GraphMinWeight)
+	overrides.int("CLUSTER_K", &config.Thresholds.ClusterK)
+
+	overrides.int("JOB_WORKERS", &config.Jobs.Workers)
+	overrides.int("JOB_HISTORY", &config.Jobs.History)
+	overrides.string("JOB_PREFIX", &config.Jobs.Prefix)
+	overrides.duration("JOB_LEASE", &config.Jobs.Lease)
+	overrides.int("JOB_MAX_ATTEMPTS", &config.Jobs.MaxAttempts)
+
+	if len(overrides.problems) > 0 {
+		return fmt.Errorf("invalid environment:\n\t%s", strings.Join(overrides.problems, "\n\t"))
+	}
+
+	return nil
+}
+
+// validate reports every problem of the configuration at once
+func (config Config) validate() error {
+	problems := make([]string, 0)
+
+	if config.ProjectID == "" {
+		problems = append(problems, "projectId (PROJECT_ID) is required")
+	}
+
+	if config.Port == "" {
+		problems = append(problems, "port (PORT) is required")
+	}
+
+	if config.Storage.Bucket == "" && config.Storage.Dir == "" {
+		problems = append(problems, "storage.bucket (STORAGE_BUCKET) or storage.dir (STORAGE_DIR) is required")
+	}
+
+	prefixes := [][2]string{
+		{"storage.redditPrefix (STORAGE_REDDIT_PREFIX)", config.Storage.RedditPrefix},
+		{"storage.customerPrefix (STORAGE_CUSTOMER_PREFIX)", config.Storage.CustomerPrefix},
+		{"jobs.prefix (JOB_PREFIX)", config.Jobs.Prefix},
+	}
+
+	for _, prefix := range prefixes {
+		if prefix[1] == "" || strings.HasPrefix(prefix[1], "/") || strings.HasSuffix(prefix[1], "/") {
+			problems = append(problems, fmt.Sprintf("%s must be a folder name without leading or trailing slashes, got \"%s\"", prefix[0], prefix[1]))
+		}
+	}
+
+	if config.Storage.RedditPrefix != "" && config.Storage.RedditPrefix == config.Storage.CustomerPrefix {
+		problems = append(problems, "storage.redditPrefix and storage.customerPrefix must differ")
+	}
+
+	if config.Jobs.Prefix != "" && (config.Jobs.Prefix == config.Storage.RedditPrefix || config.Jobs.Prefix == config.Storage.CustomerPrefix) {
+		problems = append(problems, "jobs.prefix must differ from the storage prefixes")
+	}
+
+	if config.Storage.Timeout <= 0 {
+		problems = append(problems, "storage.timeout (STORAGE_TIMEOUT) must be positive")
+	}
+
+	if config.PubSub.Timeout <= 0 {
+		problems = append(problems, "pubsub.timeout (PUBSUB_TIMEOUT) must be positive")
+	}
+
+	if config.PubSub.PushServiceAccount != "" && config.PubSub.PushAudience == "" {
+		problems = append(problems, "pubsub.pushServiceAccount (PUBSUB_PUSH_SERVICE_ACCOUNT) needs pubsub.pushAudience (PUBSUB_PUSH_AUDIENCE)")
+	}
+
+	switch config.Language.Backend {
+	case "google":
+	case "emulator":
+		if config.Language.EmulatorHost == "" {
+			problems = append(problems, "the emulator backend needs language.emulatorHost (LANGUAGE_EMULATOR_HOST)")
+		}
+	case "replay":
+		if config.Language.ReplayFixture == "" {
+			problems = append(problems, "the replay backend needs language.replayFixture (LANGUAGE_REPLAY_FIXTURE)")
+		}
+
+		if config.Language.RecordFixture != "" {
+			problems = append(problems, "the replay backend cannot record, unset language.recordFixture (LANGUAGE_RECORD_FIXTURE)")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("language.backend (LANGUAGE_BACKEND) must be google, emulator or replay, got \"%s\"", config.Language.Backend))
+	}
+
+	if _, err := sentiment.ParseEmailPolicy(config.Analysis.EmailPolicy); err != nil {
+		problems = append(problems, fmt.Sprintf("analysis.emailPolicy (EMAIL_POLICY): %v", err))
+	}
+
+	if config.Analysis.RedactionDictionary != "" && config.Analysis.RedactionNameToken == "" {
+		problems = append(problems, "analysis.redactionNameToken (REDACTION_NAME_TOKEN) is required with a redaction dictionary")
+	}
+
+	drift := config.Thresholds.Drift
+
+	if drift.Method != "" && drift.Method != sentiment.ZScoreDrift && drift.Method != sentiment.CUSUMDrift {
+		problems = append(problems, fmt.Sprintf("thresholds.drift.method (DRIFT_METHOD) must be zscore or cusum, got \"%s\"", drift.Method))
+	}
+
+	if drift.Threshold < 0 || drift.MinRecords < 0 || drift.Window < 0 || drift.Slack < 0 || drift.BucketSize < 0 {
+		problems = append(problems, "thresholds.drift must not be negative")
+	}
+
+	if config.Thresholds.GraphMinWeight < 1 {
+		problems = append(problems, "thresholds.graphMinWeight (GRAPH_MIN_WEIGHT) must be at least 1")
+	}
+
+	if config.Thresholds.ClusterK < 0 {
+		problems = append(problems, "thresholds.clusterK (CLUSTER_K) must not be negative")
+	}
+
+	if config.Jobs.Workers < 1 {
+		problems = append(problems, "jobs.workers (JOB_WORKERS) must be at least 1")
+	}
+
+	if config.Jobs.History < 0 {
+		problems = append(problems, "jobs.history (JOB_HISTORY) must not be negative")
+	}
+
+	if config.Jobs.Lease < sentiment.Duration(3*time.Second) {
+		problems = append(problems, "jobs.lease (JOB_LEASE) must be at least 3s")
+	}
+
+	if config.Jobs.MaxAttempts < 1 {
+		problems = append(problems, "jobs.maxAttempts (JOB_MAX_ATTEMPTS) must be at least 1")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+
+	return nil
+}
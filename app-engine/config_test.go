@@ -0,0 +1,182 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(config *Config)
+		wantErrs []string
+	}{
+		{
+			name:   "accepts the defaults",
+			change: func(config *Config) {},
+		},
+		{
+			name: "accepts a local store without a topic",
+			change: func(config *Config) {
+				config.Storage.Bucket = ""
+				config.Storage.Dir = "/tmp/files"
+				config.PubSub.Topic = ""
+			},
+		},
+		{
+			name:     "needs a bucket or a directory",
+			change:   func(config *Config) { config.Storage.Bucket = "" },
+			wantErrs: []string{"storage.bucket (STORAGE_BUCKET) or storage.dir (STORAGE_DIR) is required"},
+		},
+		{
+			name: "rejects prefixes with slashes",
+			change: func(config *Config) {
+				config.Storage.RedditPrefix = "/reddit"
+				config.Jobs.Prefix = "jobs/"
+			},
+			wantErrs: []string{"storage.redditPrefix (STORAGE_REDDIT_PREFIX) must be a folder name", "jobs.prefix (JOB_PREFIX) must be a folder name"},
+		},
+		{
+			name:     "rejects shared prefixes",
+			change:   func(config *Config) { config.Jobs.Prefix = config.Storage.CustomerPrefix },
+			wantErrs: []string{"jobs.prefix must differ from the storage prefixes"},
+		},
+		{
+			name:     "needs an audience to check the service account",
+			change:   func(config *Config) { config.PubSub.PushServiceAccount = "push@example.com" },
+			wantErrs: []string{"needs pubsub.pushAudience"},
+		},
+		{
+			name:     "needs the host of the emulator",
+			change:   func(config *Config) { config.Language.Backend = "emulator" },
+			wantErrs: []string{"the emulator backend needs language.emulatorHost"},
+		},
+		{
+			name: "cannot record a replay",
+			change: func(config *Config) {
+				config.Language.Backend = "replay"
+				config.Language.ReplayFixture = "replay.ndjson"
+				config.Language.RecordFixture = "record.ndjson"
+			},
+			wantErrs: []string{"the replay backend cannot record"},
+		},
+		{
+			name:     "rejects an unknown backend",
+			change:   func(config *Config) { config.Language.Backend = "azure" },
+			wantErrs: []string{"must be google, emulator or replay, got \"azure\""},
+		},
+		{
+			name:     "rejects an unknown email policy",
+			change:   func(config *Config) { config.Analysis.EmailPolicy = "hash" },
+			wantErrs: []string{"analysis.emailPolicy (EMAIL_POLICY)"},
+		},
+		{
+			name:     "rejects an unknown drift method",
+			change:   func(config *Config) { config.Thresholds.Drift.Method = "ewma" },
+			wantErrs: []string{"must be zscore or cusum, got \"ewma\""},
+		},
+		{
+			name: "reports every problem at once",
+			change: func(config *Config) {
+				config.Port = ""
+				config.Thresholds.GraphMinWeight = 0
+				config.Jobs.Workers = 0
+				config.Jobs.Lease = sentiment.Duration(time.Second)
+			},
+			wantErrs: []string{
+				"port (PORT) is required",
+				"thresholds.graphMinWeight (GRAPH_MIN_WEIGHT) must be at least 1",
+				"jobs.workers (JOB_WORKERS) must be at least 1",
+				"jobs.lease (JOB_LEASE) must be at least 3s",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Language.Backend = "google"
+			test.change(&config)
+
+			err := config.validate()
+
+			if (err != nil) != (len(test.wantErrs) > 0) {
+				t.Fatalf("got error %v, want %v", err, test.wantErrs)
+			}
+
+			for _, want := range test.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error does not hold \"%s\":\n%v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		check   func(config Config) bool
+		wantErr string
+	}{
+		{
+			name: "overrides the fields that are set",
+			env:  map[string]string{"PORT": "8080", "STORAGE_TIMEOUT": "10s", "JOB_WORKERS": "4", "DRIFT_METHOD": "cusum"},
+			check: func(config Config) bool {
+				return config.Port == "8080" && config.Storage.Timeout == sentiment.Duration(10*time.Second) && config.Jobs.Workers == 4 && config.Thresholds.Drift.Method == sentiment.CUSUMDrift
+			},
+		},
+		{
+			name:  "empties a field set to nothing",
+			env:   map[string]string{"PUBSUB_TOPIC": ""},
+			check: func(config Config) bool { return config.PubSub.Topic == "" },
+		},
+		{
+			name:  "keeps the fields that are not set",
+			env:   map[string]string{},
+			check: func(config Config) bool { return config.PubSub.Topic == "rube_goldberg" && config.Jobs.History == 500 },
+		},
+		{
+			name:    "rejects a number that does not parse",
+			env:     map[string]string{"JOB_WORKERS": "many"},
+			wantErr: "JOB_WORKERS must be a number",
+		},
+		{
+			name:    "rejects a duration without a unit",
+			env:     map[string]string{"JOB_LEASE": "30"},
+			wantErr: "JOB_LEASE must be a duration like 30s",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := defaultConfig()
+
+			err := config.applyEnv(func(name string) (string, bool) {
+				value, ok := test.env[name]
+
+				return value, ok
+			})
+
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("got error %v, want \"%s\"", err, test.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("applying the environment failed: %v", err)
+			}
+
+			if !test.check(config) {
+				t.Errorf("got config %+v", config)
+			}
+		})
+	}
+}
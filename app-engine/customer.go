@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+)
+
+// customerOptions are the per request settings of a customer analysis
+type customerOptions struct {
+	emailPolicy   sentiment.EmailPolicy
+	columnMapping sentiment.ColumnMapping
+	strictRows    bool
+
+	export exportOptions
+}
+
+// loadColumnMapping uses the json ColumnMapping of the config, or the default mapping
+func loadColumnMapping(columnsJSON json.RawMessage) (sentiment.ColumnMapping, error) {
+	columnMapping := sentiment.DefaultColumnMapping()
+
+	if len(columnsJSON) == 0 {
+		return columnMapping, nil
+	}
+
+	if err := json.Unmarshal(columnsJSON, &columnMapping); err != nil {
+		return columnMapping, fmt.Errorf("parsing customer columns failed: %v", err)
+	}
+
+	return columnMapping, nil
+}
+
+// loadAspectTaxonomy reads the json taxonomy file, or uses the default taxonomy
+func loadAspectTaxonomy(taxonomyFilename string) (sentiment.AspectTaxonomy, error) {
+	if taxonomyFilename == "" {
+		return sentiment.DefaultAspectTaxonomy(), nil
+	}
+
+	taxonomyFile, err := os.Open(taxonomyFilename)
+
+	if err != nil {
+		return nil, fmt.Errorf("opening aspect taxonomy failed: %v", err)
+	}
+
+	defer taxonomyFile.Close()
+
+	return sentiment.ParseAspectTaxonomy(taxonomyFile)
+}
+
+// parseCustomerOptions starts from the server's settings and applies the overrides of the query:
+// email, timestampColumn, emailColumn, commentColumn, passthrough (comma separated), strict and ratingScale
+func (wrapper appWrapper) parseCustomerOptions(query url.Values) (customerOptions, error) {
+	options := customerOptions{
+		emailPolicy:   wrapper.emailPolicy,
+		columnMapping: wrapper.columnMapping,
+	}
+
+	if query.Get("email") != "" {
+		emailPolicy, err := sentiment.ParseEmailPolicy(query.Get("email"))
+
+		if err != nil {
+			return options, err
+		}
+
+		options.emailPolicy = emailPolicy
+	}
+
+	if options.emailPolicy == sentiment.EmailPolicyPseudonymize && len(wrapper.emailKey) == 0 {
+		return options, fmt.Errorf("pseudonymizing emails requires EMAIL_HMAC_KEY to be set")
+	}
+
+	if column := query.Get("timestampColumn"); column != "" {
+		options.columnMapping.Timestamp = []string{column}
+	}
+
+	if column := query.Get("emailColumn"); column != "" {
+		options.columnMapping.Email = []string{column}
+	}
+
+	if column := query.Get("commentColumn"); column != "" {
+		options.columnMapping.Comment = []string{column}
+	}
+
+	if columns := query.Get("passthrough"); columns != "" {
+		options.columnMapping.Passthrough = strings.Split(columns, ",")
+	}
+
+	if query.Get("strict") != "" {
+		strict, err := strconv.ParseBool(query.Get("strict"))
+
+		if err != nil {
+			return options, fmt.Errorf("strict must be true or false: %v", err)
+		}
+
+		options.strictRows = strict
+	}
+
+	if query.Get("ratingScale") != "" {
+		ratingScale, err := sentiment.ParseRatingScale(query.Get("ratingScale"))
+
+		if err != nil {
+			return options, err
+		}
+
+		options.columnMapping.RatingScale = &ratingScale
+	}
+
+	export, err := parseExportOptions(query)
+
+	if err != nil {
+		return options, err
+	}
+
+	options.export = export
+
+	return options, nil
+}
+
+func hasRatings(comments []sentiment.CustomerAnalysis) bool {
+	for i := 0; i < len(comments); i++ {
+		if comments[i].Rating != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// saveRatingReport correlates the ratings with the sentiment of the comments, when the csv had ratings
+func (wrapper appWrapper) saveRatingReport(outputFilename string, comments []sentiment.CustomerAnalysis, options customerOptions) error {
+	if !hasRatings(comments) {
+		return nil
+	}
+
+	ratingScale := sentiment.InferRatingScale(comments)
+
+	// the ratings outside of an explicit scale were rejected with their rows
+	if options.columnMapping.RatingScale != nil {
+		ratingScale = *options.columnMapping.RatingScale
+	}
+
+	report := sentiment.ReportRatings(comments, ratingScale)
+
+	log.Printf("ratings of %d comments correlate %.2f with their sentiment, %d disagree\n", report.Count, report.Correlation, len(report.Disagreements))
+
+	return wrapper.saveReport(wrapper.config.Storage.CustomerPrefix, appendToFilename(outputFilename, "ratings"), report)
+}
+
+// saveAspectRollup sums up the sentiment per aspect across the comments
+func (wrapper appWrapper) saveAspectRollup(outputFilename string, comments []sentiment.CustomerAnalysis) error {
+	rollup := sentiment.RollupAspects(comments)
+
+	log.Printf("found %d aspects in the customer comments\n", len(rollup))
+
+	return wrapper.saveReport(wrapper.config.Storage.CustomerPrefix, appendToFilename(outputFilename, "aspects"), rollup)
+}
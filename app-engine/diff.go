@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+)
+
+func (wrapper appWrapper) fetchRecords(bucket string, filename string, readRecords func(r io.Reader) ([]sentiment.Record, error)) ([]sentiment.Record, error) {
+	storageCTX, storageCTXCancel := context.WithTimeout(wrapper.ctx, time.Duration(wrapper.config.Storage.Timeout))
+
+	defer storageCTXCancel()
+
+	storageReader, err := wrapper.store.NewReader(storageCTX, bucket+"/"+filename)
+
+	if err != nil {
+		return nil, fmt.Errorf("getting bucket reader failed: %v", err)
+	}
+
+	defer storageReader.Close()
+
+	return readRecords(storageReader)
+}
+
+// diffHandler compares two analyzed files of the same source
+// e.g. /api/diff?before=posts_analyzed.json&after=posts_v2_analyzed.json&source=reddit&minScoreDelta=0.1
+func (wrapper appWrapper) diffHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("must be GET request"))
+
+		return
+	}
+
+	query := r.URL.Query()
+
+	// these files must live within cloud storage
+	beforeFilename := query.Get("before")
+	afterFilename := query.Get("after")
+
+	if beforeFilename == "" || afterFilename == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing required input before and after"))
+
+		return
+	}
+
+	bucket := wrapper.config.Storage.RedditPrefix
+	readRecords := sentiment.ReadPostRecords
+
+	switch query.Get("source") {
+	case "", "reddit":
+	case "customer":
+		bucket = wrapper.config.Storage.CustomerPrefix
+		readRecords = sentiment.ReadCustomerRecords
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("source must be reddit or customer"))
+
+		return
+	}
+
+	minScoreDelta := 0.0
+
+	if query.Get("minScoreDelta") != "" {
+		var err error
+
+		minScoreDelta, err = strconv.ParseFloat(query.Get("minScoreDelta"), 32)
+
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("minScoreDelta must be a number"))
+
+			return
+		}
+	}
+
+	before, err := wrapper.fetchRecords(bucket, beforeFilename, readRecords)
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to fetch \"%s\": %v", beforeFilename, err)
+
+		return
+	}
+
+	after, err := wrapper.fetchRecords(bucket, afterFilename, readRecords)
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to fetch \"%s\": %v", afterFilename, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	json.NewEncoder(w).Encode(sentiment.DiffRecords(before, after, float32(minScoreDelta)))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+)
+
+// DriftReport is the reply of the drift endpoint
+type DriftReport struct {
+	Filename  string              `json:"filename"`
+	Buckets   []sentiment.Bucket  `json:"buckets"`
+	Anomalies []sentiment.Anomaly `json:"anomalies"`
+}
+
+// parseDriftOptions reads method, bucket, window, threshold and minRecords from the query over the configured defaults
+func parseDriftOptions(query url.Values, defaults sentiment.DriftOptions) (sentiment.DriftOptions, error) {
+	options := defaults
+
+	if query.Get("method") != "" {
+		options.Method = sentiment.DriftMethod(query.Get("method"))
+	}
+
+	if query.Get("bucket") != "" {
+		bucketSize, err := time.ParseDuration(query.Get("bucket"))
+
+		if err != nil {
+			return options, fmt.Errorf("bucket must be a duration like 24h: %v", err)
+		}
+
+		options.BucketSize = sentiment.Duration(bucketSize)
+	}
+
+	var err error
+
+	if query.Get("window") != "" {
+		if options.Window, err = strconv.Atoi(query.Get("window")); err != nil {
+			return options, fmt.Errorf("window must be a number of buckets: %v", err)
+		}
+	}
+
+	if query.Get("threshold") != "" {
+		if options.Threshold, err = strconv.ParseFloat(query.Get("threshold"), 64); err != nil {
+			return options, fmt.Errorf("threshold must be a number: %v", err)
+		}
+	}
+
+	if query.Get("minRecords") != "" {
+		if options.MinRecords, err = strconv.Atoi(query.Get("minRecords")); err != nil {
+			return options, fmt.Errorf("minRecords must be a number: %v", err)
+		}
+	}
+
+	return options, nil
+}
+
+// fetchTimedPostRecords joins an analyzed reddit file with its original posts, the analysis has no time
+func (wrapper appWrapper) fetchTimedPostRecords(filename string) ([]sentiment.Record, error) {
+	wrappedPosts, err := wrapper.fetchRedditAnalyzedPosts(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	originalFilename := strings.Replace(filename, "_analyzed", "", 1)
+
+	posts, err := wrapper.fetchRedditPosts(originalFilename)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the original posts \"%s\": %v", originalFilename, err)
+	}
+
+	return wrapperRecords(wrappedPosts, posts), nil
+}
+
+// driftHandler looks for sudden shifts of sentiment over time in an analyzed file
+// e.g. /api/drift?filename=posts_analyzed.json&source=reddit&bucket=24h&method=cusum
+func (wrapper appWrapper) driftHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("must be GET request"))
+
+		return
+	}
+
+	query := r.URL.Query()
+
+	// this file must live within cloud storage
+	filename := query.Get("filename")
+
+	if filename == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing required input filename"))
+
+		return
+	}
+
+	options, err := parseDriftOptions(query, wrapper.config.Thresholds.Drift)
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+
+		return
+	}
+
+	var records []sentiment.Record
+
+	switch query.Get("source") {
+	case "", "reddit":
+		records, err = wrapper.fetchTimedPostRecords(filename)
+	case "customer":
+		records, err = wrapper.fetchRecords(wrapper.config.Storage.CustomerPrefix, filename, sentiment.ReadCustomerRecords)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("source must be reddit or customer"))
+
+		return
+	}
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to fetch \"%s\": %v", filename, err)
+
+		return
+	}
+
+	buckets, anomalies, err := sentiment.DetectDrift(records, options)
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	json.NewEncoder(w).Encode(DriftReport{
+		Filename:  filename,
+		Buckets:   buckets,
+		Anomalies: anomalies,
+	})
+}
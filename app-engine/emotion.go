@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+)
+
+// loadEmotionLexicon reads the NRC formatted lexicon file, or uses the built-in lexicon
+func loadEmotionLexicon(lexiconFilename string) (sentiment.EmotionLexicon, error) {
+	if lexiconFilename == "" {
+		return sentiment.DefaultEmotionLexicon(), nil
+	}
+
+	lexiconFile, err := os.Open(lexiconFilename)
+
+	if err != nil {
+		return nil, fmt.Errorf("opening emotion lexicon failed: %v", err)
+	}
+
+	defer lexiconFile.Close()
+
+	return sentiment.ParseEmotionLexicon(lexiconFile)
+}
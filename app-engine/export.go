@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+)
+
+// exportOptions are the per request settings of the exported copy of an analysis, the ndjson analysis
+// is always saved since the other endpoints read it
+type exportOptions struct {
+	format       sentiment.OutputFormat
+	entityLayout sentiment.EntityLayout
+}
+
+// parseExportOptions reads format and entities from the query
+func parseExportOptions(query url.Values) (exportOptions, error) {
+	format, err := sentiment.ParseOutputFormat(query.Get("format"))
+
+	if err != nil {
+		return exportOptions{}, err
+	}
+
+	entityLayout, err := sentiment.ParseEntityLayout(query.Get("entities"))
+
+	if err != nil {
+		return exportOptions{}, err
+	}
+
+	return exportOptions{
+		format:       format,
+		entityLayout: entityLayout,
+	}, nil
+}
+
+// exportFilename swaps the extension of the analyzed file for the one of the format
+func exportFilename(outputFilename string, format sentiment.OutputFormat) string {
+	return strings.TrimSuffix(outputFilename, ".json") + format.Extension()
+}
+
+func (wrapper appWrapper) saveTable(bucket string, filename string, table sentiment.Table, format sentiment.OutputFormat) error {
+	storageCTX, storageCTXCancel := context.WithTimeout(wrapper.ctx, time.Duration(wrapper.config.Storage.Timeout))
+
+	defer storageCTXCancel()
+
+	storageWriter, err := wrapper.store.NewWriter(storageCTX, bucket+"/"+filename)
+
+	if err != nil {
+		return fmt.Errorf("getting bucket writer failed: %v", err)
+	}
+
+	if err := table.Write(storageWriter, format); err != nil {
+		storageWriter.Discard()
+
+		return err
+	}
+
+	return storageWriter.Close()
+}
+
+// saveTables saves the table and, in the long layout, the entities table next to it
+func (wrapper appWrapper) saveTables(bucket string, outputFilename string, table sentiment.Table, entities sentiment.Table, options exportOptions) error {
+	filename := exportFilename(outputFilename, options.format)
+
+	if err := wrapper.saveTable(bucket, filename, table, options.format); err != nil {
+		return err
+	}
+
+	log.Printf("exported analysis to '%s'\n", bucket+"/"+filename)
+
+	if options.entityLayout != sentiment.EntityLongFormat {
+		return nil
+	}
+
+	entitiesFilename := appendToFilename(filename, "entities")
+
+	if err := wrapper.saveTable(bucket, entitiesFilename, entities, options.format); err != nil {
+		return fmt.Errorf("saving entities failed: %v", err)
+	}
+
+	return nil
+}
+
+// saveBigQuery saves the rows as ndjson and their BigQuery schema next to them, so they load in one step with
+// bq load --source_format=NEWLINE_DELIMITED_JSON <table> <data> <schema>
+func (wrapper appWrapper) saveBigQuery(bucket string, outputFilename string, rows interface{}, schema []sentiment.BigQueryField) error {
+	filename := exportFilename(outputFilename, sentiment.BigQueryFormat)
+
+	storageCTX, storageCTXCancel := context.WithTimeout(wrapper.ctx, time.Duration(wrapper.config.Storage.Timeout))
+
+	defer storageCTXCancel()
+
+	storageWriter, err := wrapper.store.NewWriter(storageCTX, bucket+"/"+filename)
+
+	if err != nil {
+		return fmt.Errorf("getting bucket writer failed: %v", err)
+	}
+
+	if err := sentiment.WriteNDJSON(storageWriter, rows); err != nil {
+		storageWriter.Discard()
+
+		return err
+	}
+
+	if err := storageWriter.Close(); err != nil {
+		return err
+	}
+
+	log.Printf("exported analysis to '%s'\n", bucket+"/"+filename)
+
+	schemaFilename := strings.TrimSuffix(outputFilename, ".json") + "_schema.json"
+
+	if err := wrapper.saveReport(bucket, schemaFilename, schema); err != nil {
+		return fmt.Errorf("saving schema failed: %v", err)
+	}
+
+	return nil
+}
+
+func (wrapper appWrapper) saveParquet(bucket string, outputFilename string, rows interface{}) error {
+	filename := exportFilename(outputFilename, sentiment.ParquetFormat)
+
+	storageCTX, storageCTXCancel := context.WithTimeout(wrapper.ctx, time.Duration(wrapper.config.Storage.Timeout))
+
+	defer storageCTXCancel()
+
+	storageWriter, err := wrapper.store.NewWriter(storageCTX, bucket+"/"+filename)
+
+	if err != nil {
+		return fmt.Errorf("getting bucket writer failed: %v", err)
+	}
+
+	if err := sentiment.WriteParquet(storageWriter, rows); err != nil {
+		storageWriter.Discard()
+
+		return err
+	}
+
+	if err := storageWriter.Close(); err != nil {
+		return err
+	}
+
+	log.Printf("exported analysis to '%s'\n", bucket+"/"+filename)
+
+	return nil
+}
+
+// exportAnalyzedPosts saves the analyzed posts in the requested format, ndjson is already saved.
+// the original posts give the bigquery rows their creation time
+func (wrapper appWrapper) exportAnalyzedPosts(outputFilename string, posts []sentiment.AnalysisWrapper, originals []sentiment.RedditPost, options exportOptions) error {
+	if options.format == sentiment.BigQueryFormat {
+		rows := sentiment.BigQueryPostRows(posts, originals)
+
+		return wrapper.saveBigQuery(wrapper.config.Storage.RedditPrefix, outputFilename, rows, sentiment.BigQuerySchema(sentiment.BigQueryPostRow{}))
+	}
+
+	if options.format == sentiment.ParquetFormat {
+		return wrapper.saveParquet(wrapper.config.Storage.RedditPrefix, outputFilename, sentiment.ParquetPostRows(posts, originals))
+	}
+
+	if !options.format.IsTable() {
+		return nil
+	}
+
+	table, entities := sentiment.PostTables(posts, options.entityLayout)
+
+	return wrapper.saveTables(wrapper.config.Storage.RedditPrefix, outputFilename, table, entities, options)
+}
+
+// exportAnalyzedCustomerComments saves the analyzed comments in the requested format, ndjson is already saved
+func (wrapper appWrapper) exportAnalyzedCustomerComments(outputFilename string, comments []sentiment.CustomerAnalysis, options exportOptions) error {
+	if options.format == sentiment.BigQueryFormat {
+		rows := sentiment.BigQueryCustomerRows(comments)
+
+		return wrapper.saveBigQuery(wrapper.config.Storage.CustomerPrefix, outputFilename, rows, sentiment.BigQuerySchema(sentiment.BigQueryCustomerRow{}))
+	}
+
+	if options.format == sentiment.ParquetFormat {
+		return wrapper.saveParquet(wrapper.config.Storage.CustomerPrefix, outputFilename, sentiment.ParquetCustomerRows(comments))
+	}
+
+	if !options.format.IsTable() {
+		return nil
+	}
+
+	table, entities := sentiment.CustomerTables(comments, options.entityLayout)
+
+	return wrapper.saveTables(wrapper.config.Storage.CustomerPrefix, outputFilename, table, entities, options)
+}
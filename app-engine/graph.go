@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+)
+
+// graphHandler exports which entities of an analyzed file are mentioned together as json or graphml
+// e.g. /api/graph?filename=posts_analyzed.json&source=reddit&minWeight=2&format=graphml
+func (wrapper appWrapper) graphHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("must be GET request"))
+
+		return
+	}
+
+	query := r.URL.Query()
+
+	// this file must live within cloud storage
+	filename := query.Get("filename")
+
+	if filename == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("missing required input filename"))
+
+		return
+	}
+
+	minWeight := wrapper.config.Thresholds.GraphMinWeight
+
+	if query.Get("minWeight") != "" {
+		var err error
+
+		if minWeight, err = strconv.Atoi(query.Get("minWeight")); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "minWeight must be a number: %v", err)
+
+			return
+		}
+	}
+
+	format := query.Get("format")
+
+	if format != "" && format != "json" && format != "graphml" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("format must be json or graphml"))
+
+		return
+	}
+
+	bucket := wrapper.config.Storage.RedditPrefix
+	readRecords := sentiment.ReadPostRecords
+
+	switch query.Get("source") {
+	case "", "reddit":
+	case "customer":
+		bucket = wrapper.config.Storage.CustomerPrefix
+		readRecords = sentiment.ReadCustomerRecords
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("source must be reddit or customer"))
+
+		return
+	}
+
+	records, err := wrapper.fetchRecords(bucket, filename, readRecords)
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to fetch \"%s\": %v", filename, err)
+
+		return
+	}
+
+	graph := sentiment.BuildEntityGraph(records, minWeight)
+
+	if format == "graphml" {
+		w.Header().Set("Content-Type", "application/graphml+xml")
+		w.WriteHeader(http.StatusOK)
+
+		if err := graph.WriteGraphML(w); err != nil {
+			log.Printf("failed to write graph of \"%s\": %v\n", filename, err)
+		}
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	json.NewEncoder(w).Encode(graph)
+}
@@ -0,0 +1,768 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+	"github.com/SADA-U-Session-3/sentiment-analysis/blob"
+)
+
+// JobState is where a job is in its life, queued -> running -> succeeded, failed or cancelled
+// a running job whose instance died goes back to queued, and fails once it was interrupted too often
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+// maxJobReads is the most saved jobs a listing reads, so a filter matching few jobs does not read them all
+const maxJobReads = 500
+
+// errJobNotFound is returned for ids the tracker does not know, or has forgotten
+var errJobNotFound = errors.New("job not found")
+
+// jobTransitions are the states each state can move to
+var jobTransitions = map[JobState][]JobState{
+	JobQueued:  {JobRunning, JobFailed, JobCancelled},
+	JobRunning: {JobSucceeded, JobFailed, JobCancelled, JobQueued},
+}
+
+// isFinished checks if the state is final
+func (state JobState) isFinished() bool {
+	return state == JobSucceeded || state == JobFailed || state == JobCancelled
+}
+
+func (state JobState) canMoveTo(next JobState) bool {
+	for _, allowed := range jobTransitions[state] {
+		if allowed == next {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Job is an analysis started by a request, Params are the query it was started with
+type Job struct {
+	ID       string     `json:"id"`
+	Analysis string     `json:"analysis"`
+	Filename string     `json:"filename"`
+	Params   url.Values `json:"params,omitempty"`
+	State    JobState   `json:"state"`
+
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+
+	OutputFilename string           `json:"outputFilename,omitempty"`
+	RecordCount    int              `json:"recordCount"`
+	RejectedRows   int              `json:"rejectedRows"`
+	Usage          *sentiment.Usage `json:"usage,omitempty"`
+	Error          string           `json:"error,omitempty"`
+
+	// MessageID is the pubsub message that started the job, so a redelivery does not start it again
+	MessageID string `json:"messageId,omitempty"`
+
+	// Attempts counts the times the job started running, it is more than 1 when an instance died mid-job
+	Attempts int `json:"attempts"`
+
+	// the instance working on a queued or running job, until the lease expires
+	LeaseOwner     string     `json:"leaseOwner,omitempty"`
+	LeaseExpiresAt *time.Time `json:"leaseExpiresAt,omitempty"`
+}
+
+// jobRunner does the work of a job, the summary is kept even when the job fails
+type jobRunner func(wrapper appWrapper, job Job) (*JobSummary, error)
+
+// jobRunners by the analysis of the job
+var jobRunners = map[string]jobRunner{
+	"entity":    runEntityJob,
+	"sentiment": runSentimentJob,
+	"customer":  runCustomerJob,
+	"cluster":   runClusterJob,
+}
+
+// jobTracker runs the jobs with a limited amount of workers and remembers the latest finished ones
+// every change of a job is saved to the store, so another instance can pick up the jobs of a dead one
+type jobTracker struct {
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	cancels map[string]context.CancelFunc
+	workers chan struct{}
+	config  JobsConfig
+
+	// saveMu keeps the saves of the jobs in the order of the changes
+	saveMu sync.Mutex
+	store  blob.Store
+	owner  string
+
+	// generations are the last saves of the unfinished jobs of this instance, a save over another
+	// generation means another instance took the job, guarded by saveMu
+	generations map[string]blob.Generation
+
+	// wrapper runs the jobs resumed from the store
+	wrapper appWrapper
+}
+
+func newJobTracker(config JobsConfig, store blob.Store) *jobTracker {
+	return &jobTracker{
+		jobs:    make(map[string]*Job),
+		cancels: make(map[string]context.CancelFunc),
+		workers: make(chan struct{}, config.Workers),
+		config:  config,
+		store:   store,
+		owner:   newLeaseOwner(),
+
+		generations: make(map[string]blob.Generation),
+	}
+}
+
+// newJobID sorts by creation time, the random part keeps jobs created at once apart
+func newJobID() string {
+	random := make([]byte, 4)
+
+	if _, err := rand.Read(random); err != nil {
+		log.Printf("failed to read random job id: %v\n", err)
+	}
+
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(random)
+}
+
+func newJob(analysis string, filename string, params url.Values) *Job {
+	params = cloneParams(params)
+	params.Del("dryRun")
+
+	return &Job{
+		ID:        newJobID(),
+		Analysis:  analysis,
+		Filename:  filename,
+		Params:    params,
+		State:     JobQueued,
+		CreatedAt: time.Now(),
+	}
+}
+
+// submit queues a job and starts it once a worker is free, the job runs even when saving it fails
+func (tracker *jobTracker) submit(wrapper appWrapper, analysis string, filename string, params url.Values) (Job, error) {
+	job := newJob(analysis, filename, params)
+
+	log.Printf("queued %s job %s for \"%s\"\n", analysis, job.ID, filename)
+
+	return tracker.enqueue(wrapper, job)
+}
+
+// messageJobID names the job of a pubsub message, every delivery of the message gets the same id
+// so the saved job is found by any instance, and only the first instance saves it
+func messageJobID(messageID string, publishedAt time.Time) string {
+	hash := sha256.Sum256([]byte(messageID))
+
+	return publishedAt.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(hash[:4])
+}
+
+// submitMessage queues the job of a pubsub message once, a redelivery of the message gets the job it already queued
+// on this or any other instance
+func (tracker *jobTracker) submitMessage(wrapper appWrapper, messageID string, publishedAt time.Time, analysis string, filename string, params url.Values) (Job, bool, error) {
+	id := messageJobID(messageID, publishedAt)
+
+	tracker.mu.Lock()
+
+	if job, ok := tracker.jobs[id]; ok {
+		existing := *job
+		tracker.mu.Unlock()
+
+		return existing, true, tracker.resave(id)
+	}
+
+	job := newJob(analysis, filename, params)
+	job.ID = id
+	job.MessageID = messageID
+
+	// a concurrent redelivery finds the job before it is saved
+	tracker.jobs[job.ID] = job
+	tracker.mu.Unlock()
+
+	existing, _, err := tracker.loadJob(id)
+
+	if err != errJobNotFound {
+		tracker.forget(job)
+
+		return existing, err == nil, err
+	}
+
+	log.Printf("queued %s job %s for \"%s\" from message %s\n", analysis, job.ID, filename, messageID)
+
+	queued, err := tracker.enqueue(wrapper, job)
+
+	// another instance saved the job of the message first
+	if errors.Is(err, blob.ErrChanged) {
+		existing, _, err := tracker.loadJob(id)
+
+		return existing, err == nil, err
+	}
+
+	return queued, false, err
+}
+
+// forget removes a job from memory that was never queued
+func (tracker *jobTracker) forget(job *Job) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	if tracker.jobs[job.ID] == job {
+		delete(tracker.jobs, job.ID)
+	}
+}
+
+// resave saves an unfinished job again, in case saving it failed when it was queued
+func (tracker *jobTracker) resave(id string) error {
+	tracker.saveMu.Lock()
+	defer tracker.saveMu.Unlock()
+
+	tracker.mu.Lock()
+	job, ok := tracker.jobs[id]
+
+	if !ok || job.State.isFinished() {
+		tracker.mu.Unlock()
+
+		return nil
+	}
+
+	snapshot := *job
+	tracker.mu.Unlock()
+
+	return tracker.saveJob(snapshot)
+}
+
+// enqueue leases the job to this instance, saves it and starts it once a worker is free
+func (tracker *jobTracker) enqueue(wrapper appWrapper, job *Job) (Job, error) {
+	jobCTX, jobCTXCancel := context.WithCancel(wrapper.ctx)
+
+	tracker.saveMu.Lock()
+
+	tracker.mu.Lock()
+	tracker.lease(job)
+	tracker.jobs[job.ID] = job
+	tracker.cancels[job.ID] = jobCTXCancel
+	tracker.forgetFinished()
+	queued := *job
+	tracker.mu.Unlock()
+
+	saveErr := tracker.saveJob(queued)
+
+	if saveErr != nil && !errors.Is(saveErr, blob.ErrChanged) {
+		log.Printf("failed to save job %s: %v\n", queued.ID, saveErr)
+	}
+
+	tracker.saveMu.Unlock()
+
+	// another instance took the job first
+	if errors.Is(saveErr, blob.ErrChanged) {
+		return queued, saveErr
+	}
+
+	wrapper.ctx = jobCTX
+
+	go tracker.run(wrapper, queued)
+
+	return queued, saveErr
+}
+
+func cloneParams(params url.Values) url.Values {
+	cloned := make(url.Values)
+
+	for key, values := range params {
+		cloned[key] = append([]string{}, values...)
+	}
+
+	return cloned
+}
+
+// run waits for a worker, then runs the job with the context of the job
+func (tracker *jobTracker) run(wrapper appWrapper, job Job) {
+	defer tracker.release(job.ID)
+
+	select {
+	case tracker.workers <- struct{}{}:
+		defer func() { <-tracker.workers }()
+	case <-wrapper.ctx.Done():
+		tracker.finish(job.ID, nil, wrapper.ctx.Err())
+
+		return
+	}
+
+	if err := tracker.transition(job.ID, JobRunning, func(job *Job) {
+		startedAt := time.Now()
+		job.StartedAt = &startedAt
+		job.Attempts++
+	}); err != nil {
+		// cancelled while it waited for the worker, or taken over by another instance
+		return
+	}
+
+	log.Printf("running %s job %s\n", job.Analysis, job.ID)
+
+	runner, ok := jobRunners[job.Analysis]
+
+	if !ok {
+		tracker.finish(job.ID, nil, fmt.Errorf("unknown analysis \"%s\"", job.Analysis))
+
+		return
+	}
+
+	summary, err := runner(wrapper, job)
+
+	if err != nil && wrapper.ctx.Err() != nil {
+		err = wrapper.ctx.Err()
+	}
+
+	tracker.finish(job.ID, summary, err)
+}
+
+// finish moves the job to its final state, a cancelled context means the job was cancelled
+func (tracker *jobTracker) finish(id string, summary *JobSummary, err error) {
+	state := JobSucceeded
+
+	if err == context.Canceled {
+		state = JobCancelled
+	} else if err != nil {
+		state = JobFailed
+	}
+
+	transitionErr := tracker.transition(id, state, func(job *Job) {
+		finishedAt := time.Now()
+		job.FinishedAt = &finishedAt
+		job.LeaseOwner = ""
+		job.LeaseExpiresAt = nil
+
+		if summary != nil {
+			job.OutputFilename = summary.OutputFilename
+			job.RecordCount = summary.RecordCount
+			job.RejectedRows = len(summary.RejectedRows)
+			job.Usage = summary.Usage
+		}
+
+		if err != nil {
+			job.Error = err.Error()
+		}
+	})
+
+	if transitionErr != nil {
+		log.Printf("failed to finish job %s: %v\n", id, transitionErr)
+
+		return
+	}
+
+	if err != nil {
+		log.Printf("%s job %s: %v\n", state, id, err)
+
+		return
+	}
+
+	log.Printf("%s job %s\n", state, id)
+}
+
+// transition moves a job to the next state, updates and saves it, when the state machine allows it
+func (tracker *jobTracker) transition(id string, next JobState, update func(job *Job)) error {
+	tracker.saveMu.Lock()
+	defer tracker.saveMu.Unlock()
+
+	tracker.mu.Lock()
+
+	job, ok := tracker.jobs[id]
+
+	if !ok {
+		tracker.mu.Unlock()
+
+		return fmt.Errorf("job %s does not exist", id)
+	}
+
+	if !job.State.canMoveTo(next) {
+		tracker.mu.Unlock()
+
+		return fmt.Errorf("job %s cannot move from %s to %s", id, job.State, next)
+	}
+
+	job.State = next
+
+	if update != nil {
+		update(job)
+	}
+
+	snapshot := *job
+	tracker.mu.Unlock()
+
+	// the job already moved on in memory, a failed save only loses it when the instance dies
+	// unless another instance took the job over
+	err := tracker.saveJob(snapshot)
+
+	if errors.Is(err, blob.ErrChanged) {
+		return err
+	}
+
+	if err != nil {
+		log.Printf("failed to save job %s: %v\n", id, err)
+	}
+
+	return nil
+}
+
+// release forgets the context of a finished job
+func (tracker *jobTracker) release(id string) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	if cancel, ok := tracker.cancels[id]; ok {
+		cancel()
+		delete(tracker.cancels, id)
+	}
+}
+
+// cancel stops a queued or running job, running jobs stop at their next call to Google's api or storage
+// only the instance running a job can cancel it
+func (tracker *jobTracker) cancel(id string) (Job, error) {
+	tracker.mu.Lock()
+
+	job, ok := tracker.jobs[id]
+
+	if !ok {
+		tracker.mu.Unlock()
+
+		saved, _, err := tracker.loadJob(id)
+
+		if err != nil {
+			return Job{}, err
+		}
+
+		if saved.State.isFinished() {
+			return saved, fmt.Errorf("job %s already %s", id, saved.State)
+		}
+
+		return saved, fmt.Errorf("job %s is %s on instance %s, cancel it there", id, saved.State, saved.LeaseOwner)
+	}
+
+	if job.State.isFinished() {
+		snapshot := *job
+		tracker.mu.Unlock()
+
+		return snapshot, fmt.Errorf("job %s already %s", id, job.State)
+	}
+
+	cancel := tracker.cancels[id]
+	snapshot := *job
+	tracker.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+
+	return snapshot, nil
+}
+
+// get returns a copy of the job, the jobs of other instances and the ones this instance forgot are read from the store
+func (tracker *jobTracker) get(id string) (Job, error) {
+	tracker.mu.Lock()
+	job, ok := tracker.jobs[id]
+
+	if ok {
+		snapshot := *job
+		tracker.mu.Unlock()
+
+		return snapshot, nil
+	}
+
+	tracker.mu.Unlock()
+
+	saved, _, err := tracker.loadJob(id)
+
+	return saved, err
+}
+
+// list returns copies of at most limit jobs matching state and analysis, newest first
+// the jobs this instance does not hold are read from the store, until limit jobs matched or maxJobReads were read
+func (tracker *jobTracker) list(state JobState, analysis string, limit int) ([]Job, error) {
+	ids, err := tracker.savedJobIDs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	tracker.mu.Lock()
+
+	known := make(map[string]Job)
+
+	for id, job := range tracker.jobs {
+		known[id] = *job
+	}
+
+	tracker.mu.Unlock()
+
+	saved := make(map[string]bool)
+
+	for _, id := range ids {
+		saved[id] = true
+	}
+
+	// jobs whose save failed are only in memory
+	for id := range known {
+		if !saved[id] {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+
+	jobs := make([]Job, 0)
+	reads := 0
+
+	for i := 0; i < len(ids) && len(jobs) < limit; i++ {
+		job, ok := known[ids[i]]
+
+		if !ok {
+			if reads >= maxJobReads {
+				break
+			}
+
+			reads++
+
+			if job, _, err = tracker.loadJob(ids[i]); err != nil {
+				// pruned since it was listed, or not readable
+				if err != errJobNotFound {
+					log.Printf("failed to load job %s: %v\n", ids[i], err)
+				}
+
+				continue
+			}
+		}
+
+		if state != "" && job.State != state {
+			continue
+		}
+
+		if analysis != "" && job.Analysis != analysis {
+			continue
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// forgetFinished forgets the oldest finished jobs beyond the history, they stay in the store until they are pruned
+// the caller holds the lock
+func (tracker *jobTracker) forgetFinished() {
+	finished := make([]*Job, 0)
+
+	for _, job := range tracker.jobs {
+		if job.State.isFinished() {
+			finished = append(finished, job)
+		}
+	}
+
+	if len(finished) <= tracker.config.History {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].ID < finished[j].ID
+	})
+
+	for i := 0; i < len(finished)-tracker.config.History; i++ {
+		delete(tracker.jobs, finished[i].ID)
+	}
+}
+
+func runEntityJob(wrapper appWrapper, job Job) (*JobSummary, error) {
+	export, err := parseExportOptions(job.Params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapper.startEntityAnalysis(job.Filename, appendToFilename(job.Filename, "analyzed"), export)
+}
+
+func runSentimentJob(wrapper appWrapper, job Job) (*JobSummary, error) {
+	export, err := parseExportOptions(job.Params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	onAnalyzed := func(analyzedFilename string) {
+		log.Printf("finished analyzing sentiment!\nstarting next convolution...")
+		// app.triggerNextStep()
+	}
+
+	return wrapper.startSentimentAnalysis(job.Filename, appendToFilename(job.Filename, "analyzed"), export, onAnalyzed)
+}
+
+func runCustomerJob(wrapper appWrapper, job Job) (*JobSummary, error) {
+	options, err := wrapper.parseCustomerOptions(job.Params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	onAnalyzed := func(analyzedFilename string) {
+		log.Printf("finished analyzing sentiment!\nstarting next convolution...")
+		// app.triggerNextStep()
+	}
+
+	return wrapper.startCustomerAnalysis(job.Filename, appendToFilename(job.Filename, "analyzed"), options, onAnalyzed)
+}
+
+func runClusterJob(wrapper appWrapper, job Job) (*JobSummary, error) {
+	options, err := parseClusterOptions(job.Params, wrapper.config.Thresholds.ClusterK)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapper.startClusterAnalysis(job.Filename, options)
+}
+
+// writeJob replies with the job as json
+func writeJob(w http.ResponseWriter, statusCode int, job Job) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	json.NewEncoder(w).Encode(job)
+}
+
+// acceptJob queues the job of an analysis request and replies with it, the job is polled at Location
+func (wrapper appWrapper) acceptJob(w http.ResponseWriter, r *http.Request, analysis string, filename string) {
+	// a job that could not be saved still runs, it is only lost if the instance dies
+	job, _ := wrapper.jobs.submit(wrapper, analysis, filename, r.URL.Query())
+
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	writeJob(w, http.StatusAccepted, job)
+}
+
+// jobsHandler lists the jobs, newest first
+// e.g. /api/jobs?state=failed&analysis=customer&limit=20
+func (wrapper appWrapper) jobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("must be GET request"))
+
+		return
+	}
+
+	query := r.URL.Query()
+	state := JobState(query.Get("state"))
+
+	if state != "" && state != JobQueued && state != JobRunning && !state.isFinished() {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("state must be queued, running, succeeded, failed or cancelled"))
+
+		return
+	}
+
+	limit := 50
+
+	if query.Get("limit") != "" {
+		var err error
+
+		if limit, err = strconv.Atoi(query.Get("limit")); err != nil || limit < 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("limit must be a positive number"))
+
+			return
+		}
+	}
+
+	jobs, err := wrapper.jobs.list(state, query.Get("analysis"), limit)
+
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(err.Error()))
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// jobHandler shows a job, or cancels it with a POST to /api/jobs/{id}/cancel
+// e.g. /api/jobs/20211014T170302-9f86d081
+func (wrapper appWrapper) jobHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/")
+	id := path
+	action := ""
+
+	if slash := strings.Index(path, "/"); slash >= 0 {
+		id, action = path[:slash], path[slash+1:]
+	}
+
+	switch {
+	case id == "":
+		wrapper.jobsHandler(w, r)
+	case action == "" && r.Method == "GET":
+		job, err := wrapper.jobs.get(id)
+
+		if err == errJobNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "job \"%s\" not found", id)
+
+			return
+		}
+
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(err.Error()))
+
+			return
+		}
+
+		writeJob(w, http.StatusOK, job)
+	case action == "cancel" && r.Method == "POST":
+		job, err := wrapper.jobs.cancel(id)
+
+		if err == errJobNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "job \"%s\" not found", id)
+
+			return
+		}
+
+		if err != nil {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(err.Error()))
+
+			return
+		}
+
+		writeJob(w, http.StatusAccepted, job)
+	case action == "cancel":
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("must be POST request"))
+	case action == "":
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("must be GET request"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "unknown job action \"%s\"", action)
+	}
+}
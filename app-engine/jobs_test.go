@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+	"github.com/SADA-U-Session-3/sentiment-analysis/blob"
+)
+
+// newTestTracker keeps the jobs in a temporary directory, without starting them
+func newTestTracker(t *testing.T, history int) *jobTracker {
+	t.Helper()
+
+	store, err := blob.NewDirStore(t.TempDir())
+
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+
+	config := defaultConfig()
+	config.Storage.Timeout = sentiment.Duration(5 * time.Second)
+	config.Jobs.History = history
+
+	tracker := newJobTracker(config.Jobs, store)
+	tracker.wrapper = appWrapper{ctx: context.Background(), config: config}
+
+	return tracker
+}
+
+// saveTestJob saves a job in the state, a higher number is a newer job and unfinished jobs are marked active
+func saveTestJob(t *testing.T, tracker *jobTracker, number int, state JobState) string {
+	t.Helper()
+
+	job := Job{
+		ID:       fmt.Sprintf("20210101T000000-%08d", number),
+		Analysis: "sentiment",
+		State:    state,
+	}
+
+	tracker.saveMu.Lock()
+	defer tracker.saveMu.Unlock()
+
+	if err := tracker.saveJob(job); err != nil {
+		t.Fatalf("saving job failed: %v", err)
+	}
+
+	return job.ID
+}
+
+func TestJobTransitions(t *testing.T) {
+	tests := []struct {
+		from JobState
+		to   JobState
+		want bool
+	}{
+		{from: JobQueued, to: JobRunning, want: true},
+		{from: JobQueued, to: JobFailed, want: true},
+		{from: JobQueued, to: JobCancelled, want: true},
+		{from: JobQueued, to: JobSucceeded, want: false},
+		{from: JobRunning, to: JobQueued, want: true},
+		{from: JobFailed, to: JobQueued, want: false},
+		{from: JobSucceeded, to: JobRunning, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.from)+" to "+string(test.to), func(t *testing.T) {
+			if got := test.from.canMoveTo(test.to); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAbandonJob(t *testing.T) {
+	tracker := newTestTracker(t, 10)
+	id := saveTestJob(t, tracker, 1, JobQueued)
+
+	job, _, err := tracker.loadJob(id)
+
+	if err != nil {
+		t.Fatalf("loading job failed: %v", err)
+	}
+
+	tracker.abandon(job, errors.New("interrupted 3 times, giving up"))
+
+	saved, _, err := tracker.loadJob(id)
+
+	if err != nil {
+		t.Fatalf("loading job failed: %v", err)
+	}
+
+	if saved.State != JobFailed || saved.FinishedAt == nil || saved.Error != "interrupted 3 times, giving up" {
+		t.Errorf("got job %+v, want it failed", saved)
+	}
+
+	if active, err := tracker.activeJobIDs(); err != nil || len(active) != 0 {
+		t.Errorf("got active jobs %v (%v), want none", active, err)
+	}
+}
+
+func TestPruneJobs(t *testing.T) {
+	tracker := newTestTracker(t, 2)
+
+	unfinished := saveTestJob(t, tracker, 1, JobRunning)
+	saveTestJob(t, tracker, 2, JobSucceeded)
+	saveTestJob(t, tracker, 3, JobFailed)
+	newer := saveTestJob(t, tracker, 4, JobCancelled)
+	newest := saveTestJob(t, tracker, 5, JobSucceeded)
+
+	tracker.prune()
+
+	ids, err := tracker.savedJobIDs()
+
+	if err != nil {
+		t.Fatalf("listing jobs failed: %v", err)
+	}
+
+	want := []string{unfinished, newer, newest}
+
+	sort.Strings(ids)
+
+	if strings.Join(ids, ",") != strings.Join(want, ",") {
+		t.Errorf("got jobs %v, want %v", ids, want)
+	}
+}
+
+func TestListCapsReads(t *testing.T) {
+	tracker := newTestTracker(t, maxJobReads+5)
+
+	oldest := saveTestJob(t, tracker, 0, JobFailed)
+
+	for i := 1; i < maxJobReads; i++ {
+		saveTestJob(t, tracker, i, JobSucceeded)
+	}
+
+	jobs, err := tracker.list(JobFailed, "", 10)
+
+	if err != nil {
+		t.Fatalf("listing jobs failed: %v", err)
+	}
+
+	if len(jobs) != 1 || jobs[0].ID != oldest {
+		t.Fatalf("got jobs %+v, want %s", jobs, oldest)
+	}
+
+	// one more job pushes the oldest out of the reads
+	saveTestJob(t, tracker, maxJobReads, JobSucceeded)
+
+	if jobs, err = tracker.list(JobFailed, "", 10); err != nil || len(jobs) != 0 {
+		t.Errorf("got jobs %+v (%v), want none", jobs, err)
+	}
+}
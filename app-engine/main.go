@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -16,15 +15,10 @@ import (
 	"cloud.google.com/go/pubsub"
 	"cloud.google.com/go/storage"
 	"github.com/SADA-U-Session-3/sentiment-analysis"
+	"github.com/SADA-U-Session-3/sentiment-analysis/blob"
+	"github.com/SADA-U-Session-3/sentiment-analysis/languagetest"
 )
 
-const projectID = "sada-u-sess-3-firestore"
-const projectBucket = "rube_goldberg_project"
-const redditBucket = "reddit_data"
-
-const customerBucket = "customer_data"
-const pubsubTopic = "rube_goldberg"
-
 var app appWrapper
 
 func main() {
@@ -32,15 +26,58 @@ func main() {
 	// by NL api 600 requests per minute
 	ctx := context.Background()
 
-	languageClient, err := language.NewClient(ctx)
+	config, err := loadConfig()
 
 	if err != nil {
-		log.Printf("failed to create language client: %v\n", err)
+		log.Printf("%v\n", err)
 
 		return
 	}
 
-	storageClient, err := storage.NewClient(ctx)
+	app.config = config
+
+	if config.Language.Backend == "replay" {
+		replayFixture := config.Language.ReplayFixture
+		replayer, err := openReplayer(replayFixture)
+
+		if err != nil {
+			log.Printf("failed to load replay fixture: %v\n", err)
+
+			return
+		}
+
+		log.Printf("replaying language responses from \"%s\"\n", replayFixture)
+
+		app.analyzer = replayer
+	} else {
+		languageClient, err := newLanguageClient(ctx, config.Language)
+
+		if err != nil {
+			log.Printf("failed to create language client: %v\n", err)
+
+			return
+		}
+
+		app.languageClient = languageClient
+		app.analyzer = languageClient
+
+		if recordFixture := config.Language.RecordFixture; recordFixture != "" {
+			recordingFile, err := os.Create(recordFixture)
+
+			if err != nil {
+				log.Printf("failed to create record fixture: %v\n", err)
+
+				return
+			}
+
+			log.Printf("recording language responses to \"%s\"\n", recordFixture)
+
+			app.recordingFile = recordingFile
+			app.analyzer = sentiment.NewRecorder(languageClient, recordingFile)
+		}
+	}
+
+	store, err := newStore(ctx, config.Storage)
 
 	if err != nil {
 		log.Printf("failed to create storage client: %v\n", err)
@@ -48,91 +85,232 @@ func main() {
 		return
 	}
 
-	pubsubClient, err := pubsub.NewClient(ctx, projectID)
+	var pubsubClient *pubsub.Client
+	var pubsubTopic *pubsub.Topic
+
+	// without a topic the alerts are only logged
+	if config.PubSub.Topic != "" {
+		pubsubClient, pubsubTopic, err = newPubSubTopic(ctx, config)
+
+		if err != nil {
+			log.Printf("%v\n", err)
+
+			return
+		}
+	} else {
+		log.Printf("no pubsub topic is set, alerts are logged instead of published\n")
+	}
+
+	redactor, err := newRedactor(config.Analysis)
 
 	if err != nil {
-		log.Printf("failed to create storage client: %v\n", err)
+		log.Printf("failed to create redactor: %v\n", err)
 
 		return
 	}
 
-	app.ctx = ctx
-	app.languageClient = languageClient
-	app.storageClient = storageClient
-	app.pubsubClient = pubsubClient
+	// the policy is already validated with the config
+	emailPolicy, _ := sentiment.ParseEmailPolicy(config.Analysis.EmailPolicy)
 
-	// check that our topic exists, so we can function like expected
-	topic := app.pubsubClient.Topic(pubsubTopic)
+	emailKey := []byte(os.Getenv("EMAIL_HMAC_KEY"))
 
-	doesTopicExist, err := topic.Exists(ctx)
+	if emailPolicy == sentiment.EmailPolicyPseudonymize && len(emailKey) == 0 {
+		log.Println("EMAIL_POLICY pseudonymize requires EMAIL_HMAC_KEY to be set")
+
+		return
+	}
+
+	columnMapping, err := loadColumnMapping(config.Analysis.CustomerColumns)
 
 	if err != nil {
-		log.Fatalf("checking if the pubsub topic exists failed: %v", err)
+		log.Printf("invalid customer columns: %v\n", err)
 
 		return
 	}
 
-	if !doesTopicExist {
-		log.Fatalf("\"%s\" does not exist as a topic", pubsubTopic)
+	aspectTaxonomy, err := loadAspectTaxonomy(config.Analysis.AspectTaxonomy)
+
+	if err != nil {
+		log.Printf("invalid aspect taxonomy: %v\n", err)
 
 		return
 	}
 
-	app.pubsubTopic = topic
+	alertRules, err := loadAlertRules(config.Analysis.AlertRules)
 
-	defer app.closeClients()
+	if err != nil {
+		log.Printf("invalid alert rules: %v\n", err)
+
+		return
+	}
 
-	http.HandleFunc("/api/analyze/sentiment", analyzeSentimentHandler)
-	http.HandleFunc("/api/analyze/entity", analyzeEntityHandler)
-	http.HandleFunc("/api/analyze/customer", analyzeCustomerHandler)
+	emotionLexicon, err := loadEmotionLexicon(config.Analysis.EmotionLexicon)
 
-	port := os.Getenv("PORT")
+	if err != nil {
+		log.Printf("invalid emotion lexicon: %v\n", err)
 
-	if port == "" {
-		port = "3000"
-		log.Printf("Defaulting to port %s", port)
+		return
 	}
 
+	app.ctx = ctx
+	app.redactor = redactor
+	app.emailPolicy = emailPolicy
+	app.emailKey = emailKey
+	app.columnMapping = columnMapping
+	app.aspectTaxonomy = aspectTaxonomy
+	app.alertRules = alertRules
+	app.emotionLexicon = emotionLexicon
+	app.store = store
+	app.pubsubClient = pubsubClient
+	app.pubsubTopic = pubsubTopic
+	app.jobs = newJobTracker(config.Jobs, store)
+
+	// resume the jobs an earlier instance did not finish
+	app.jobs.start(app)
+
+	defer app.closeClients()
+
+	port := config.Port
+
 	log.Printf("Listening on port %s", port)
 
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	if err := http.ListenAndServe(":"+port, app.newServeMux()); err != nil {
 		log.Fatal(err)
 	}
 }
 
-// AnalysisWrapper allows the analysis to be written to json without a lot of nesting
-type AnalysisWrapper struct {
-	ID        string                     `json:"id"`
-	Entity    []sentiment.EntityWrapper  `json:"entity"`
-	Sentiment sentiment.SentimentWrapper `json:"sentiment"`
+// newPubSubTopic connects to the topic of the config, which must already exist
+func newPubSubTopic(ctx context.Context, config Config) (*pubsub.Client, *pubsub.Topic, error) {
+	pubsubClient, err := pubsub.NewClient(ctx, config.ProjectID)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create pubsub client: %v", err)
+	}
+
+	// check that our topic exists, so we can function like expected
+	topic := pubsubClient.Topic(config.PubSub.Topic)
+
+	doesTopicExist, err := topic.Exists(ctx)
+
+	if err != nil {
+		pubsubClient.Close()
+
+		return nil, nil, fmt.Errorf("checking if the pubsub topic exists failed: %v", err)
+	}
+
+	if !doesTopicExist {
+		pubsubClient.Close()
+
+		return nil, nil, fmt.Errorf("\"%s\" does not exist as a topic", config.PubSub.Topic)
+	}
+
+	return pubsubClient, topic, nil
+}
+
+// newServeMux routes the api to the handlers of the wrapper
+func (wrapper appWrapper) newServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/analyze/sentiment", wrapper.analyzeSentimentHandler)
+	mux.HandleFunc("/api/analyze/entity", wrapper.analyzeEntityHandler)
+	mux.HandleFunc("/api/analyze/customer", wrapper.analyzeCustomerHandler)
+	mux.HandleFunc("/api/diff", wrapper.diffHandler)
+	mux.HandleFunc("/api/drift", wrapper.driftHandler)
+	mux.HandleFunc("/api/cluster", wrapper.clusterHandler)
+	mux.HandleFunc("/api/graph", wrapper.graphHandler)
+	mux.HandleFunc("/api/jobs", wrapper.jobsHandler)
+	mux.HandleFunc("/api/jobs/", wrapper.jobHandler)
+
+	// anyone could start billable jobs through an unauthenticated push endpoint
+	if wrapper.config.PubSub.PushToken != "" || wrapper.config.PubSub.PushAudience != "" {
+		mux.HandleFunc("/api/pubsub/push", wrapper.pushHandler)
+	} else {
+		log.Printf("/api/pubsub/push is disabled, set PUBSUB_PUSH_TOKEN or PUBSUB_PUSH_AUDIENCE to enable it\n")
+	}
+
+	return mux
+}
+
+// newLanguageClient connects to the fake api of the emulator backend
+// e.g. a languagetest.Server, otherwise to Google's api
+func newLanguageClient(ctx context.Context, config LanguageConfig) (*language.Client, error) {
+	if config.Backend == "emulator" {
+		log.Printf("using the language emulator at %s\n", config.EmulatorHost)
+
+		return language.NewClient(ctx, languagetest.ClientOptions(config.EmulatorHost)...)
+	}
+
+	return language.NewClient(ctx)
 }
 
-func toWrapper(posts []sentiment.RedditPost) []AnalysisWrapper {
-	postsWrapper := make([]AnalysisWrapper, 0)
+// newStore keeps the files in the local directory when it is set, for development and tests,
+// otherwise in the project's bucket
+func newStore(ctx context.Context, config StorageConfig) (blob.Store, error) {
+	if storageDir := config.Dir; storageDir != "" {
+		log.Printf("storing files in \"%s\"\n", storageDir)
+
+		return blob.NewDirStore(storageDir)
+	}
+
+	storageClient, err := storage.NewClient(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return blob.NewGCSStore(storageClient, config.Bucket), nil
+}
+
+func openReplayer(filename string) (*sentiment.Replayer, error) {
+	fixture, err := os.Open(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer fixture.Close()
 
+	return sentiment.NewReplayer(fixture)
+}
+
+func addSentimentToWrapper(posts []sentiment.RedditPost, wrapperPosts []sentiment.AnalysisWrapper) []sentiment.AnalysisWrapper {
 	for i := 0; i < len(posts); i++ {
 		post := posts[i]
+		for j := 0; j < len(wrapperPosts); j++ {
+			wrappedPost := wrapperPosts[j]
 
-		wrappedPost := AnalysisWrapper{
-			ID:        post.ID,
-			Entity:    post.Analysis.Entity,
-			Sentiment: post.Analysis.Sentiment,
+			if post.ID == wrappedPost.ID {
+				wrapperPosts[i].Sentiment = post.Analysis.Sentiment
+			}
 		}
+	}
 
-		postsWrapper = append(postsWrapper, wrappedPost)
+	return wrapperPosts
+}
+
+func addEntityToWrapper(posts []sentiment.RedditPost, wrapperPosts []sentiment.AnalysisWrapper) []sentiment.AnalysisWrapper {
+	for i := 0; i < len(posts); i++ {
+		post := posts[i]
+		for j := 0; j < len(wrapperPosts); j++ {
+			wrappedPost := wrapperPosts[j]
+
+			if post.ID == wrappedPost.ID {
+				wrapperPosts[i].Entity = post.Analysis.Entity
+			}
+		}
 	}
 
-	return postsWrapper
+	return wrapperPosts
 }
 
-func addSentimentToWrapper(posts []sentiment.RedditPost, wrapperPosts []AnalysisWrapper) []AnalysisWrapper {
+func addEmotionToWrapper(posts []sentiment.RedditPost, wrapperPosts []sentiment.AnalysisWrapper) []sentiment.AnalysisWrapper {
 	for i := 0; i < len(posts); i++ {
 		post := posts[i]
 		for j := 0; j < len(wrapperPosts); j++ {
 			wrappedPost := wrapperPosts[j]
 
 			if post.ID == wrappedPost.ID {
-				wrapperPosts[i].Sentiment = post.Analysis.Sentiment
+				wrapperPosts[j].Emotion = post.Analysis.Emotion
 			}
 		}
 	}
@@ -140,14 +318,14 @@ func addSentimentToWrapper(posts []sentiment.RedditPost, wrapperPosts []Analysis
 	return wrapperPosts
 }
 
-func addEntityToWrapper(posts []sentiment.RedditPost, wrapperPosts []AnalysisWrapper) []AnalysisWrapper {
+func addSignalsToWrapper(posts []sentiment.RedditPost, wrapperPosts []sentiment.AnalysisWrapper) []sentiment.AnalysisWrapper {
 	for i := 0; i < len(posts); i++ {
 		post := posts[i]
 		for j := 0; j < len(wrapperPosts); j++ {
 			wrappedPost := wrapperPosts[j]
 
 			if post.ID == wrappedPost.ID {
-				wrapperPosts[i].Entity = post.Analysis.Entity
+				wrapperPosts[j].Signals = post.Analysis.Signals
 			}
 		}
 	}
@@ -168,20 +346,31 @@ type PubSubEvent struct {
 
 type appWrapper struct {
 	ctx            context.Context
+	config         Config
+	analyzer       sentiment.Analyzer
 	languageClient *language.Client
-	storageClient  *storage.Client
+	recordingFile  *os.File
+	redactor       *sentiment.Redactor
+	emailPolicy    sentiment.EmailPolicy
+	emailKey       []byte
+	columnMapping  sentiment.ColumnMapping
+	aspectTaxonomy sentiment.AspectTaxonomy
+	alertRules     sentiment.AlertRules
+	emotionLexicon sentiment.EmotionLexicon
+	store          blob.Store
 	pubsubClient   *pubsub.Client
 	pubsubTopic    *pubsub.Topic
+	jobs           *jobTracker
 }
 
 func (wrapper appWrapper) fetchRedditPosts(filename string) ([]sentiment.RedditPost, error) {
-	storageCTX, storageCTXCancel := context.WithTimeout(wrapper.ctx, time.Second*50)
+	storageCTX, storageCTXCancel := context.WithTimeout(wrapper.ctx, time.Duration(wrapper.config.Storage.Timeout))
 
 	defer storageCTXCancel()
 
 	var posts []sentiment.RedditPost
 
-	storageReader, err := wrapper.storageClient.Bucket(projectBucket + "/" + redditBucket).Object(filename).NewReader(storageCTX)
+	storageReader, err := wrapper.store.NewReader(storageCTX, wrapper.config.Storage.RedditPrefix+"/"+filename)
 
 	if err != nil {
 
@@ -205,14 +394,14 @@ func (wrapper appWrapper) fetchRedditPosts(filename string) ([]sentiment.RedditP
 	return posts, nil
 }
 
-func (wrapper appWrapper) fetchRedditAnalyzedPosts(filename string) ([]AnalysisWrapper, error) {
-	storageCTX, storageCTXCancel := context.WithTimeout(wrapper.ctx, time.Second*50)
+func (wrapper appWrapper) fetchRedditAnalyzedPosts(filename string) ([]sentiment.AnalysisWrapper, error) {
+	storageCTX, storageCTXCancel := context.WithTimeout(wrapper.ctx, time.Duration(wrapper.config.Storage.Timeout))
 
 	defer storageCTXCancel()
 
-	var posts []AnalysisWrapper
+	var posts []sentiment.AnalysisWrapper
 
-	storageReader, err := wrapper.storageClient.Bucket(projectBucket + "/" + redditBucket).Object(filename).NewReader(storageCTX)
+	storageReader, err := wrapper.store.NewReader(storageCTX, wrapper.config.Storage.RedditPrefix+"/"+filename)
 
 	if err != nil {
 
@@ -224,7 +413,7 @@ func (wrapper appWrapper) fetchRedditAnalyzedPosts(filename string) ([]AnalysisW
 	decoder := json.NewDecoder(storageReader)
 
 	for decoder.More() {
-		var post AnalysisWrapper
+		var post sentiment.AnalysisWrapper
 
 		if err := decoder.Decode(&post); err != nil {
 			return posts, fmt.Errorf("parsing json failed: %v", err)
@@ -236,59 +425,38 @@ func (wrapper appWrapper) fetchRedditAnalyzedPosts(filename string) ([]AnalysisW
 	return posts, nil
 }
 
-func (wrapper appWrapper) fetchCustomerComments(filename string) ([]sentiment.CustomerAnalysis, error) {
-	storageCTX, storageCTXCancel := context.WithTimeout(wrapper.ctx, time.Second*50)
+func (wrapper appWrapper) fetchCustomerComments(filename string, columnMapping sentiment.ColumnMapping, strict bool) ([]sentiment.CustomerAnalysis, []sentiment.RowError, error) {
+	storageCTX, storageCTXCancel := context.WithTimeout(wrapper.ctx, time.Duration(wrapper.config.Storage.Timeout))
 
 	defer storageCTXCancel()
 
-	var comments [][]string
-	var commentsWrapper []sentiment.CustomerAnalysis
-
-	storageReader, err := wrapper.storageClient.Bucket(projectBucket + "/" + customerBucket).Object(filename).NewReader(storageCTX)
+	storageReader, err := wrapper.store.NewReader(storageCTX, wrapper.config.Storage.CustomerPrefix+"/"+filename)
 
 	if err != nil {
-		return commentsWrapper, fmt.Errorf("getting bucket reader failed: %v", err)
+		return nil, nil, fmt.Errorf("getting bucket reader failed: %v", err)
 	}
 
 	defer storageReader.Close()
 
-	csvReader := csv.NewReader(storageReader)
-
-	comments, err = csvReader.ReadAll()
+	comments, rowErrors, err := sentiment.ParseCustomerComments(storageReader, columnMapping, strict)
 
 	if err != nil {
-		return commentsWrapper, fmt.Errorf("parsing csv failed: %v", err)
-	}
-
-	for i := 0; i < len(comments); i++ {
-		comment := comments[i]
-
-		// do no save the headers
-		if i == 0 {
-			continue
-		}
-
-		commentWrapper := sentiment.CustomerAnalysis{
-			Timestamp: comment[0],
-			Email:     comment[3],
-			Comment:   comment[2],
-		}
-
-		commentsWrapper = append(commentsWrapper, commentWrapper)
-
+		return comments, rowErrors, fmt.Errorf("parsing csv failed: %v", err)
 	}
 
-	return commentsWrapper, nil
+	return comments, rowErrors, nil
 }
 
-func (wrapper appWrapper) saveAnalyzedPosts(outputFilename string, posts []AnalysisWrapper) error {
-	storageCTX, storageCTXCancel := context.WithTimeout(wrapper.ctx, time.Second*50)
+func (wrapper appWrapper) saveAnalyzedPosts(outputFilename string, posts []sentiment.AnalysisWrapper) error {
+	storageCTX, storageCTXCancel := context.WithTimeout(wrapper.ctx, time.Duration(wrapper.config.Storage.Timeout))
 
 	defer storageCTXCancel()
 
-	storageWriter := wrapper.storageClient.Bucket(projectBucket).Object(redditBucket + "/" + outputFilename).NewWriter(storageCTX)
+	storageWriter, err := wrapper.store.NewWriter(storageCTX, wrapper.config.Storage.RedditPrefix+"/"+outputFilename)
 
-	defer storageWriter.Close()
+	if err != nil {
+		return fmt.Errorf("getting bucket writer failed: %v", err)
+	}
 
 	encoder := json.NewEncoder(storageWriter)
 
@@ -296,21 +464,26 @@ func (wrapper appWrapper) saveAnalyzedPosts(outputFilename string, posts []Analy
 		post := posts[i]
 
 		if err := encoder.Encode(post); err != nil {
+			storageWriter.Discard()
+
 			return err
 		}
 	}
 
-	return nil
+	// the blob is only written once the writer closes
+	return storageWriter.Close()
 }
 
 func (wrapper appWrapper) saveAnalyzedCustomerComments(outputFilename string, comments []sentiment.CustomerAnalysis) error {
-	storageCTX, storageCTXCancel := context.WithTimeout(wrapper.ctx, time.Second*50)
+	storageCTX, storageCTXCancel := context.WithTimeout(wrapper.ctx, time.Duration(wrapper.config.Storage.Timeout))
 
 	defer storageCTXCancel()
 
-	storageWriter := wrapper.storageClient.Bucket(projectBucket).Object(customerBucket + "/" + outputFilename).NewWriter(storageCTX)
+	storageWriter, err := wrapper.store.NewWriter(storageCTX, wrapper.config.Storage.CustomerPrefix+"/"+outputFilename)
 
-	defer storageWriter.Close()
+	if err != nil {
+		return fmt.Errorf("getting bucket writer failed: %v", err)
+	}
 
 	encoder := json.NewEncoder(storageWriter)
 
@@ -318,15 +491,18 @@ func (wrapper appWrapper) saveAnalyzedCustomerComments(outputFilename string, co
 		comment := comments[i]
 
 		if err := encoder.Encode(comment); err != nil {
+			storageWriter.Discard()
+
 			return err
 		}
 	}
 
-	return nil
+	// the blob is only written once the writer closes
+	return storageWriter.Close()
 }
 
-func (wrapper appWrapper) analyzeEntitySentiment(posts []sentiment.RedditPost) ([]sentiment.RedditPost, error) {
-	return sentiment.AnalyzeEntitesInPosts(wrapper.ctx, wrapper.languageClient, posts)
+func (wrapper appWrapper) analyzeEntitySentiment(usage *sentiment.Usage, posts []sentiment.RedditPost) ([]sentiment.RedditPost, error) {
+	return sentiment.AnalyzeEntitesInPosts(sentiment.WithUsage(wrapper.ctx, usage), wrapper.analyzer, posts)
 }
 
 func (wrapper appWrapper) triggerSentimentViaPubSub(filename string) error {
@@ -334,8 +510,12 @@ func (wrapper appWrapper) triggerSentimentViaPubSub(filename string) error {
 		return fmt.Errorf("filename is required")
 	}
 
+	if wrapper.pubsubTopic == nil {
+		return fmt.Errorf("no pubsub topic is set")
+	}
+
 	event := PubSubEvent{
-		EventType: "update-post-sentiment",
+		EventType: sentimentEventType,
 		Payload:   filename,
 	}
 
@@ -349,36 +529,53 @@ func (wrapper appWrapper) triggerSentimentViaPubSub(filename string) error {
 		Data: eventBytes,
 	}
 
-	_, err = wrapper.pubsubTopic.Publish(wrapper.ctx, msg).Get(wrapper.ctx)
+	publishCTX, publishCTXCancel := context.WithTimeout(wrapper.ctx, time.Duration(wrapper.config.PubSub.Timeout))
+
+	defer publishCTXCancel()
+
+	_, err = wrapper.pubsubTopic.Publish(publishCTX, msg).Get(publishCTX)
 
 	return err
 }
 
-func (wrapper appWrapper) analyzeSentiment(posts []sentiment.RedditPost) ([]sentiment.RedditPost, error) {
-	return sentiment.AnalyzePosts(wrapper.ctx, wrapper.languageClient, posts)
+func (wrapper appWrapper) analyzeSentiment(usage *sentiment.Usage, posts []sentiment.RedditPost) ([]sentiment.RedditPost, error) {
+	return sentiment.AnalyzePosts(sentiment.WithUsage(wrapper.ctx, usage), wrapper.analyzer, posts)
 }
 
-func (wrapper appWrapper) analyzeCustomerComments(comments []sentiment.CustomerAnalysis) ([]sentiment.CustomerAnalysis, error) {
-	return sentiment.AnalyzeCustomerComments(wrapper.ctx, wrapper.languageClient, comments)
+func (wrapper appWrapper) analyzeCustomerComments(usage *sentiment.Usage, comments []sentiment.CustomerAnalysis) ([]sentiment.CustomerAnalysis, error) {
+	// customer comments are redacted before they reach Google's api
+	return sentiment.AnalyzeCustomerComments(sentiment.WithUsage(wrapper.ctx, usage), wrapper.analyzer, wrapper.redactor, comments)
 }
 
 func (wrapper appWrapper) closeClients() {
-	if err := wrapper.languageClient.Close(); err != nil {
-		log.Printf("failed to close language client: %v\n", err)
+	if wrapper.languageClient != nil {
+		if err := wrapper.languageClient.Close(); err != nil {
+			log.Printf("failed to close language client: %v\n", err)
 
-		return
+			return
+		}
+	}
+
+	if wrapper.recordingFile != nil {
+		if err := wrapper.recordingFile.Close(); err != nil {
+			log.Printf("failed to close record fixture: %v\n", err)
+
+			return
+		}
 	}
 
-	if err := wrapper.storageClient.Close(); err != nil {
+	if err := wrapper.store.Close(); err != nil {
 		log.Printf("failed to close storage client: %v\n", err)
 
 		return
 	}
 
-	if err := wrapper.pubsubClient.Close(); err != nil {
-		log.Printf("failed to close pubsub client: %v\n", err)
+	if wrapper.pubsubClient != nil {
+		if err := wrapper.pubsubClient.Close(); err != nil {
+			log.Printf("failed to close pubsub client: %v\n", err)
 
-		return
+			return
+		}
 	}
 }
 
@@ -389,29 +586,30 @@ func isAnalysisFilename(filename string) bool {
 }
 
 // startEntityAnalysis analyzes entities from json file in google cloud storage
-func startEntityAnalysis(filename string, outputFilename string) {
-	var wrappedPosts []AnalysisWrapper
+func (wrapper appWrapper) startEntityAnalysis(filename string, outputFilename string, export exportOptions) (*JobSummary, error) {
+	var wrappedPosts []sentiment.AnalysisWrapper
 	var posts []sentiment.RedditPost
 	var postCount int
 	var err error
 
+	summary := newJobSummary("entity", filename)
+
 	if isAnalysisFilename(filename) {
+		// analyzed files are updated in place
+		outputFilename = filename
+
 		log.Printf("downloading \"%s\"...\n", filename)
 
-		wrappedPosts, err = app.fetchRedditAnalyzedPosts(filename)
+		wrappedPosts, err = wrapper.fetchRedditAnalyzedPosts(filename)
 
 		if err != nil {
-			log.Printf("failed to fetch reddit posts from \"%s\": %v", filename, err)
-
-			return
+			return summary, fmt.Errorf("failed to fetch reddit posts from \"%s\": %v", filename, err)
 		}
 
 		postCount = len(wrappedPosts)
 
 		if postCount == 0 {
-			log.Println("found 0 analyzed posts - Aborting...")
-
-			return
+			return summary, fmt.Errorf("found 0 analyzed posts")
 		}
 
 		log.Printf("found %d analyzed posts\n", postCount)
@@ -421,114 +619,122 @@ func startEntityAnalysis(filename string, outputFilename string) {
 
 		log.Printf("downloading \"%s\"...", originalFilename)
 
-		posts, err = app.fetchRedditPosts(originalFilename)
+		posts, err = wrapper.fetchRedditPosts(originalFilename)
 
 		if err != nil {
-			log.Printf("failed to fetch reddit posts from \"%s\": %v", originalFilename, err)
-
-			return
+			return summary, fmt.Errorf("failed to fetch reddit posts from \"%s\": %v", originalFilename, err)
 		}
 
 		postCount = len(posts)
 
 		if postCount == 0 {
-			log.Println("found 0 posts - Aborting...")
-
-			return
+			return summary, fmt.Errorf("found 0 posts")
 		}
 
 		log.Printf("starting entity analysis with %d posts\n", postCount)
 
-		analyzedPosts, err := app.analyzeEntitySentiment(posts)
+		posts = sentiment.PrepareSignals(posts)
 
-		if err != nil {
-			log.Printf("failed to analyze entities from \"%s\": %v\n", filename, err)
+		analyzedPosts, err := wrapper.analyzeEntitySentiment(summary.Usage, posts)
 
-			return
+		if err != nil {
+			return summary, wrapper.failJob(wrapper.config.Storage.RedditPrefix, outputFilename, summary, fmt.Errorf("failed to analyze entities from \"%s\": %v", filename, err))
 		}
 
 		postCount = len(analyzedPosts)
 
 		if postCount == 0 {
-			log.Println("analyzed 0 posts - Aborting...")
-
-			return
+			return summary, wrapper.failJob(wrapper.config.Storage.RedditPrefix, outputFilename, summary, fmt.Errorf("analyzed 0 posts"))
 		}
 
+		// the analyzed file keeps its sentiment and the signals that adjusted it, only the entities are new
+		analyzedPosts = sentiment.ClassifyPostEmotions(analyzedPosts, wrapper.emotionLexicon)
+
 		wrappedPosts = addEntityToWrapper(analyzedPosts, wrappedPosts)
+		wrappedPosts = addEmotionToWrapper(analyzedPosts, wrappedPosts)
 	} else {
 		// pull posts from cloud storage
 		log.Printf("downloading \"%s\"...", filename)
 
-		posts, err = app.fetchRedditPosts(filename)
+		posts, err = wrapper.fetchRedditPosts(filename)
 
 		if err != nil {
-			log.Printf("failed to fetch reddit posts from \"%s\": %v", filename, err)
-
-			return
+			return summary, fmt.Errorf("failed to fetch reddit posts from \"%s\": %v", filename, err)
 		}
 
 		postCount = len(posts)
 
 		if postCount == 0 {
-			log.Println("found 0 posts - Aborting...")
-
-			return
+			return summary, fmt.Errorf("found 0 posts")
 		}
 
 		log.Printf("starting entity and sentiment analysis with %d posts\n", postCount)
 
-		analyzedPosts, err := app.analyzeEntitySentiment(posts)
+		posts = sentiment.PrepareSignals(posts)
 
-		if err != nil {
-			log.Printf("failed to analyze entities from \"%s\": %v\n", filename, err)
+		analyzedPosts, err := wrapper.analyzeEntitySentiment(summary.Usage, posts)
 
-			return
+		if err != nil {
+			return summary, wrapper.failJob(wrapper.config.Storage.RedditPrefix, outputFilename, summary, fmt.Errorf("failed to analyze entities from \"%s\": %v", filename, err))
 		}
 
-		wrappedPosts = toWrapper(analyzedPosts)
+		analyzedPosts = sentiment.AdjustPostSentiment(analyzedPosts)
+		analyzedPosts = sentiment.ClassifyPostEmotions(analyzedPosts, wrapper.emotionLexicon)
+
+		wrappedPosts = sentiment.WrapPosts(analyzedPosts)
 	}
 
 	log.Printf("after pruning posts with empty body we analyzed sentiment and entity on %d posts\n", postCount)
 
-	// save to cloud storage
-	if isAnalysisFilename(filename) {
-		outputFilename = filename
+	if err := wrapper.saveAnalyzedPosts(outputFilename, wrappedPosts); err != nil {
+		return summary, wrapper.failJob(wrapper.config.Storage.RedditPrefix, outputFilename, summary, fmt.Errorf("failed to upload analyzed posts: %v", err))
 	}
 
-	if err := app.saveAnalyzedPosts(outputFilename, wrappedPosts); err != nil {
-		log.Printf("failed to upload analyzed posts: %v\n", err)
+	log.Printf("uploaded analyzed posts to '%s'\n", wrapper.config.Storage.RedditPrefix+"/"+outputFilename)
 
-		return
+	if err := wrapper.exportAnalyzedPosts(outputFilename, wrappedPosts, posts, export); err != nil {
+		log.Printf("failed to export analyzed posts: %v\n", err)
 	}
 
-	log.Printf("uploaded analyzed posts to '%s'\n", projectBucket+"/"+outputFilename)
+	summary.Emotions = summarizeWrapperEmotions(wrappedPosts)
+	summary.finish(outputFilename, len(wrappedPosts))
+
+	if err := wrapper.saveJobSummary(wrapper.config.Storage.RedditPrefix, summary); err != nil {
+		log.Printf("failed to upload job summary: %v\n", err)
+	}
+
+	if err := wrapper.publishAlerts("entity", outputFilename, wrapperRecords(wrappedPosts, posts)); err != nil {
+		log.Printf("failed to publish alerts: %v\n", err)
+	}
+
+	return summary, nil
 }
 
 // startSentimentAnalysis analyzes entities from json file in google cloud storage
-func startSentimentAnalysis(filename string, outputFilename string, onAnalyzed func(analyzedFilename string)) {
-	var wrappedPosts []AnalysisWrapper
+func (wrapper appWrapper) startSentimentAnalysis(filename string, outputFilename string, export exportOptions, onAnalyzed func(analyzedFilename string)) (*JobSummary, error) {
+	var wrappedPosts []sentiment.AnalysisWrapper
 	var posts []sentiment.RedditPost
 	var postCount int
 	var err error
 
+	summary := newJobSummary("sentiment", filename)
+
 	if isAnalysisFilename(filename) {
+		// analyzed files are updated in place
+		outputFilename = filename
+
 		log.Printf("downloading \"%s\"...\n", filename)
 
-		wrappedPosts, err = app.fetchRedditAnalyzedPosts(filename)
+		wrappedPosts, err = wrapper.fetchRedditAnalyzedPosts(filename)
 
 		if err != nil {
-			log.Printf("failed to fetch reddit posts from \"%s\": %v", filename, err)
-
-			return
+			return summary, fmt.Errorf("failed to fetch reddit posts from \"%s\": %v", filename, err)
 		}
 
 		postCount = len(wrappedPosts)
 
 		if postCount == 0 {
-			log.Println("found 0 analyzed posts - Aborting...")
-
-			return
+			return summary, fmt.Errorf("found 0 analyzed posts")
 		}
 
 		log.Printf("found %d analyzed posts\n", postCount)
@@ -538,129 +744,173 @@ func startSentimentAnalysis(filename string, outputFilename string, onAnalyzed f
 
 		log.Printf("downloading \"%s\"...", originalFilename)
 
-		posts, err = app.fetchRedditPosts(originalFilename)
+		posts, err = wrapper.fetchRedditPosts(originalFilename)
 
 		if err != nil {
-			log.Printf("failed to fetch reddit posts from \"%s\": %v", originalFilename, err)
-
-			return
+			return summary, fmt.Errorf("failed to fetch reddit posts from \"%s\": %v", originalFilename, err)
 		}
 
 		postCount = len(posts)
 
 		if postCount == 0 {
-			log.Println("found 0 posts - Aborting...")
-
-			return
+			return summary, fmt.Errorf("found 0 posts")
 		}
 
 		log.Printf("starting sentiment analysis with %d posts\n", postCount)
 
-		analyzedPosts, err := app.analyzeSentiment(posts)
+		posts = sentiment.PrepareSignals(posts)
 
-		if err != nil {
-			log.Printf("failed to analyze sentiment from \"%s\": %v\n", filename, err)
+		analyzedPosts, err := wrapper.analyzeSentiment(summary.Usage, posts)
 
-			return
+		if err != nil {
+			return summary, wrapper.failJob(wrapper.config.Storage.RedditPrefix, outputFilename, summary, fmt.Errorf("failed to analyze sentiment from \"%s\": %v", filename, err))
 		}
 
 		postCount = len(analyzedPosts)
 
 		if postCount == 0 {
-			log.Println("analyzed 0 posts - Aborting...")
-
-			return
+			return summary, wrapper.failJob(wrapper.config.Storage.RedditPrefix, outputFilename, summary, fmt.Errorf("analyzed 0 posts"))
 		}
 
+		analyzedPosts = sentiment.AdjustPostSentiment(analyzedPosts)
+		analyzedPosts = sentiment.ClassifyPostEmotions(analyzedPosts, wrapper.emotionLexicon)
+
 		wrappedPosts = addSentimentToWrapper(analyzedPosts, wrappedPosts)
+		wrappedPosts = addSignalsToWrapper(analyzedPosts, wrappedPosts)
+		wrappedPosts = addEmotionToWrapper(analyzedPosts, wrappedPosts)
 	} else {
 		// pull posts from cloud storage
 		log.Printf("downloading \"%s\"...", filename)
 
-		posts, err = app.fetchRedditPosts(filename)
+		posts, err = wrapper.fetchRedditPosts(filename)
 
 		if err != nil {
-			log.Printf("failed to fetch reddit posts from \"%s\": %v", filename, err)
-
-			return
+			return summary, fmt.Errorf("failed to fetch reddit posts from \"%s\": %v", filename, err)
 		}
 
 		postCount = len(posts)
 
 		if postCount == 0 {
-			log.Println("found 0 posts - Aborting...")
-
-			return
+			return summary, fmt.Errorf("found 0 posts")
 		}
 
 		log.Printf("starting sentiment analysis with %d posts\n", postCount)
 
-		analyzedPosts, err := app.analyzeSentiment(posts)
+		posts = sentiment.PrepareSignals(posts)
 
-		if err != nil {
-			log.Printf("failed to analyze sentiment from \"%s\": %v\n", filename, err)
+		analyzedPosts, err := wrapper.analyzeSentiment(summary.Usage, posts)
 
-			return
+		if err != nil {
+			return summary, wrapper.failJob(wrapper.config.Storage.RedditPrefix, outputFilename, summary, fmt.Errorf("failed to analyze sentiment from \"%s\": %v", filename, err))
 		}
 
-		wrappedPosts = toWrapper(analyzedPosts)
+		analyzedPosts = sentiment.AdjustPostSentiment(analyzedPosts)
+		analyzedPosts = sentiment.ClassifyPostEmotions(analyzedPosts, wrapper.emotionLexicon)
+
+		wrappedPosts = sentiment.WrapPosts(analyzedPosts)
 	}
 
 	log.Printf("after pruning posts with empty body we analyzed sentiment on %d posts\n", postCount)
 
-	// save to cloud storage
-	if isAnalysisFilename(filename) {
-		outputFilename = filename
+	if err := wrapper.saveAnalyzedPosts(outputFilename, wrappedPosts); err != nil {
+		return summary, wrapper.failJob(wrapper.config.Storage.RedditPrefix, outputFilename, summary, fmt.Errorf("failed to upload analyzed posts: %v", err))
 	}
 
-	if err := app.saveAnalyzedPosts(outputFilename, wrappedPosts); err != nil {
-		log.Printf("failed to upload analyzed posts: %v\n", err)
+	log.Printf("uploaded analyzed posts to '%s'\n", wrapper.config.Storage.RedditPrefix+"/"+outputFilename)
 
-		return
+	if err := wrapper.exportAnalyzedPosts(outputFilename, wrappedPosts, posts, export); err != nil {
+		log.Printf("failed to export analyzed posts: %v\n", err)
+	}
+
+	summary.Emotions = summarizeWrapperEmotions(wrappedPosts)
+	summary.finish(outputFilename, len(wrappedPosts))
+
+	if err := wrapper.saveJobSummary(wrapper.config.Storage.RedditPrefix, summary); err != nil {
+		log.Printf("failed to upload job summary: %v\n", err)
 	}
 
-	log.Printf("uploaded analyzed posts to '%s'\n", projectBucket+"/"+outputFilename)
+	if err := wrapper.publishAlerts("sentiment", outputFilename, wrapperRecords(wrappedPosts, posts)); err != nil {
+		log.Printf("failed to publish alerts: %v\n", err)
+	}
 
 	onAnalyzed(outputFilename)
+
+	return summary, nil
 }
 
-func startCustomerAnalysis(filename string, outputFilename string, onAnalyzed func(analyzedFilename string)) {
-	comments, err := app.fetchCustomerComments(filename)
+func (wrapper appWrapper) startCustomerAnalysis(filename string, outputFilename string, options customerOptions, onAnalyzed func(analyzedFilename string)) (*JobSummary, error) {
+	summary := newJobSummary("customer", filename)
+
+	// we save as .json, so we must change the extension
+	outputFilename = strings.Replace(outputFilename, ".csv", ".json", 1)
+
+	comments, rowErrors, err := wrapper.fetchCustomerComments(filename, options.columnMapping, options.strictRows)
 
 	if err != nil {
-		log.Printf("fetching customer comments failed: %s", err)
+		return summary, fmt.Errorf("fetching customer comments failed: %s", err)
+	}
 
-		return
+	summary.RejectedRows = rowErrors
+
+	for _, rowError := range rowErrors {
+		log.Printf("skipped row of \"%s\": %v\n", filename, rowError)
 	}
 
 	log.Printf("found %d customer comments\n", len(comments))
 	log.Println("starting analysis")
 
-	analyzedComments, err := app.analyzeCustomerComments(comments)
+	analyzedComments, err := wrapper.analyzeCustomerComments(summary.Usage, comments)
 
 	if err != nil {
-		log.Printf("failed analyzing customer comments: %v\n", err)
-
-		return
+		return summary, wrapper.failJob(wrapper.config.Storage.CustomerPrefix, outputFilename, summary, fmt.Errorf("failed analyzing customer comments: %v", err))
 	}
 
 	log.Printf("analyzed %d customer comments\n", len(analyzedComments))
 
-	// we save as .json, so we must change the extension
-	outputFilename = strings.Replace(outputFilename, ".csv", ".json", 1)
+	analyzedComments = sentiment.AssignAspects(analyzedComments, wrapper.aspectTaxonomy)
+	analyzedComments = sentiment.ClassifyCustomerEmotions(analyzedComments, wrapper.emotionLexicon)
+
+	analyzedComments, err = sentiment.ApplyEmailPolicy(analyzedComments, options.emailPolicy, wrapper.emailKey)
+
+	if err != nil {
+		return summary, wrapper.failJob(wrapper.config.Storage.CustomerPrefix, outputFilename, summary, fmt.Errorf("failed applying the email policy: %v", err))
+	}
 
 	log.Printf("saving analysis as \"%s\"\n", outputFilename)
 
-	if err := app.saveAnalyzedCustomerComments(outputFilename, analyzedComments); err != nil {
-		log.Printf("failed saving customer comments: %v\n", err)
+	if err := wrapper.saveAnalyzedCustomerComments(outputFilename, analyzedComments); err != nil {
+		return summary, wrapper.failJob(wrapper.config.Storage.CustomerPrefix, outputFilename, summary, fmt.Errorf("failed saving customer comments: %v", err))
+	}
 
-		return
+	if err := wrapper.exportAnalyzedCustomerComments(outputFilename, analyzedComments, options.export); err != nil {
+		log.Printf("failed exporting customer comments: %v\n", err)
+	}
+
+	if err := wrapper.saveAspectRollup(outputFilename, analyzedComments); err != nil {
+		log.Printf("failed saving aspect rollup: %v\n", err)
+	}
+
+	if err := wrapper.saveRatingReport(outputFilename, analyzedComments, options); err != nil {
+		log.Printf("failed saving rating report: %v\n", err)
+	}
+
+	summary.Emotions = summarizeCustomerEmotions(analyzedComments)
+	summary.finish(outputFilename, len(analyzedComments))
+
+	if err := wrapper.saveJobSummary(wrapper.config.Storage.CustomerPrefix, summary); err != nil {
+		log.Printf("failed saving job summary: %v\n", err)
+	}
+
+	if err := wrapper.publishAlerts("customer", outputFilename, sentiment.CustomerRecords(analyzedComments)); err != nil {
+		log.Printf("failed publishing alerts: %v\n", err)
 	}
 
 	onAnalyzed(outputFilename)
+
+	return summary, nil
 }
 
-func analyzeEntityHandler(w http.ResponseWriter, r *http.Request) {
+func (wrapper appWrapper) analyzeEntityHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte("must be GET request"))
@@ -680,19 +930,28 @@ func analyzeEntityHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	outputFilename := appendToFilename(filename, "analyzed")
+	if _, err := parseExportOptions(query); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "analyzing \"%s\"", filename)
+		return
+	}
+
+	if isDryRun(r) {
+		usage, err := wrapper.estimatePosts(filename, sentiment.EntitySentimentFeature)
+		writeEstimate(w, filename, usage, err)
+
+		return
+	}
 
 	// onAnalyzed := func(analyzedFilename string) {
 	// 	app.triggerSentimentViaPubSub(analyzedFilename)
 	// }
 
-	go startEntityAnalysis(filename, outputFilename)
+	wrapper.acceptJob(w, r, "entity", filename)
 }
 
-func analyzeSentimentHandler(w http.ResponseWriter, r *http.Request) {
+func (wrapper appWrapper) analyzeSentimentHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte("must be GET request"))
@@ -712,20 +971,24 @@ func analyzeSentimentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	outputFilename := appendToFilename(filename, "analyzed")
+	if _, err := parseExportOptions(query); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+
+		return
+	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "analyzing \"%s\"", filename)
+	if isDryRun(r) {
+		usage, err := wrapper.estimatePosts(filename, sentiment.SentimentFeature)
+		writeEstimate(w, filename, usage, err)
 
-	onAnalyzed := func(analyzedFilename string) {
-		log.Printf("finished analyzing sentiment!\nstarting next convolution...")
-		// app.triggerNextStep()
+		return
 	}
 
-	go startSentimentAnalysis(filename, outputFilename, onAnalyzed)
+	wrapper.acceptJob(w, r, "sentiment", filename)
 }
 
-func analyzeCustomerHandler(w http.ResponseWriter, r *http.Request) {
+func (wrapper appWrapper) analyzeCustomerHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte("must be GET request"))
@@ -745,15 +1008,21 @@ func analyzeCustomerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	outputFilename := appendToFilename(filename, "analyzed")
+	options, err := wrapper.parseCustomerOptions(query)
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+
+		return
+	}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "analyzing \"%s\"", filename)
+	if isDryRun(r) {
+		usage, err := wrapper.estimateCustomerComments(filename, options)
+		writeEstimate(w, filename, usage, err)
 
-	onAnalyzed := func(analyzedFilename string) {
-		log.Printf("finished analyzing sentiment!\nstarting next convolution...")
-		// app.triggerNextStep()
+		return
 	}
 
-	go startCustomerAnalysis(filename, outputFilename, onAnalyzed)
+	wrapper.acceptJob(w, r, "customer", filename)
 }
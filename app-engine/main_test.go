@@ -0,0 +1,582 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+	"github.com/SADA-U-Session-3/sentiment-analysis/blob"
+	"github.com/SADA-U-Session-3/sentiment-analysis/languagetest"
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testPosts are the reddit posts the tests analyze, the post without a body is never sent to the api
+const testPosts = `{"id":"a","title":"first","body":"the pizza was great"}
+{"id":"b","title":"second","body":"the delivery was awful"}
+{"id":"c","title":"empty"}
+`
+
+// newTestApp runs a wrapper against a fake api and a store in a temporary directory, with the jobs started
+func newTestApp(t *testing.T) (appWrapper, *languagetest.Server) {
+	t.Helper()
+
+	server, err := languagetest.NewServer()
+
+	if err != nil {
+		t.Fatalf("starting fake api failed: %v", err)
+	}
+
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	t.Cleanup(cancel)
+
+	languageClient, err := server.NewClient(ctx)
+
+	if err != nil {
+		t.Fatalf("creating language client failed: %v", err)
+	}
+
+	t.Cleanup(func() { languageClient.Close() })
+
+	store, err := blob.NewDirStore(t.TempDir())
+
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+
+	config := defaultConfig()
+	config.Storage.Timeout = sentiment.Duration(5 * time.Second)
+	config.PubSub.PushToken = "secret"
+
+	wrapper := appWrapper{
+		ctx:            ctx,
+		config:         config,
+		analyzer:       languageClient,
+		redactor:       sentiment.NewRedactor(sentiment.DefaultDetectors()...),
+		emotionLexicon: sentiment.DefaultEmotionLexicon(),
+		store:          store,
+		jobs:           newJobTracker(config.Jobs, store),
+	}
+
+	wrapper.jobs.start(wrapper)
+
+	return wrapper, server
+}
+
+// putFile writes a file to the store of the wrapper
+func putFile(t *testing.T, wrapper appWrapper, name string, content string) {
+	t.Helper()
+
+	storageWriter, err := wrapper.store.NewWriter(context.Background(), name)
+
+	if err != nil {
+		t.Fatalf("creating writer for \"%s\" failed: %v", name, err)
+	}
+
+	if _, err := storageWriter.Write([]byte(content)); err != nil {
+		t.Fatalf("writing \"%s\" failed: %v", name, err)
+	}
+
+	if err := storageWriter.Close(); err != nil {
+		t.Fatalf("closing \"%s\" failed: %v", name, err)
+	}
+}
+
+// waitForJob polls the job until it is finished
+func waitForJob(t *testing.T, baseURL string, id string) Job {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+
+	for time.Now().Before(deadline) {
+		job := getJob(t, baseURL, id)
+
+		if job.State.isFinished() {
+			return job
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	t.Fatalf("job %s did not finish in time", id)
+
+	return Job{}
+}
+
+func getJob(t *testing.T, baseURL string, id string) Job {
+	t.Helper()
+
+	response, err := http.Get(baseURL + "/api/jobs/" + id)
+
+	if err != nil {
+		t.Fatalf("getting job %s failed: %v", id, err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("getting job %s replied %d", id, response.StatusCode)
+	}
+
+	var job Job
+
+	if err := json.NewDecoder(response.Body).Decode(&job); err != nil {
+		t.Fatalf("parsing job %s failed: %v", id, err)
+	}
+
+	return job
+}
+
+func TestAnalyzeSentiment(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		latency    time.Duration
+		wantScores []float32
+		wantCode   codes.Code
+	}{
+		{
+			name:       "scores the posts with a body",
+			wantScores: []float32{0.4, 0.4},
+			wantCode:   codes.OK,
+		},
+		{
+			name:     "returns the api error",
+			err:      status.Error(codes.PermissionDenied, "api disabled"),
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "stops with the context of the wrapper",
+			latency:  5 * time.Second,
+			wantCode: codes.Canceled,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wrapper, server := newTestApp(t)
+
+			server.SetLatency(test.latency)
+			server.SentimentFunc = func(text string) (*languagepb.AnalyzeSentimentResponse, error) {
+				if test.err != nil {
+					return nil, test.err
+				}
+
+				return languagetest.SentimentResponse(0.4), nil
+			}
+
+			ctx, cancel := context.WithCancel(wrapper.ctx)
+			wrapper.ctx = ctx
+
+			// a cancelled job cancels the context of its wrapper
+			time.AfterFunc(200*time.Millisecond, cancel)
+
+			posts, err := wrapper.analyzeSentiment(sentiment.NewUsage(), []sentiment.RedditPost{
+				{ID: "a", Body: "the pizza was great"},
+				{ID: "b"},
+				{ID: "c", Body: "the delivery was awful"},
+			})
+
+			if code := status.Code(err); code != test.wantCode && !(test.wantCode == codes.Canceled && err == context.Canceled) {
+				t.Fatalf("got error %v, want code %s", err, test.wantCode)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if len(posts) != len(test.wantScores) {
+				t.Fatalf("got %d posts, want %d", len(posts), len(test.wantScores))
+			}
+
+			for i := 0; i < len(posts); i++ {
+				if posts[i].Analysis.Sentiment.Score != test.wantScores[i] {
+					t.Errorf("post %s scored %v, want %v", posts[i].ID, posts[i].Analysis.Sentiment.Score, test.wantScores[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeEntitySentiment(t *testing.T) {
+	tests := []struct {
+		name         string
+		response     *languagepb.AnalyzeEntitySentimentResponse
+		err          error
+		wantEntities []string
+		wantErr      bool
+	}{
+		{
+			name:         "counts the entities of the post",
+			response:     languagetest.EntitySentimentResponse(languagetest.Entity("pizza", 0.8, 0.6), languagetest.Entity("oven", 0.2)),
+			wantEntities: []string{"oven", "pizza"},
+		},
+		{
+			name:    "returns the api error",
+			err:     status.Error(codes.ResourceExhausted, "quota exceeded"),
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wrapper, server := newTestApp(t)
+
+			server.QueueEntitySentiment(test.response, test.err)
+
+			usage := sentiment.NewUsage()
+
+			posts, err := wrapper.analyzeEntitySentiment(usage, []sentiment.RedditPost{
+				{ID: "a", Body: "the pizza from the oven"},
+			})
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+
+			if test.wantErr {
+				if usage.TotalUnits != 0 {
+					t.Errorf("got %d billed units for a failed request", usage.TotalUnits)
+				}
+
+				return
+			}
+
+			// the entities are counted in a map, their order is random
+			keywords := make([]string, 0)
+
+			for _, entity := range posts[0].Analysis.Entity {
+				keywords = append(keywords, entity.Keyword)
+			}
+
+			sort.Strings(keywords)
+
+			if strings.Join(keywords, ",") != strings.Join(test.wantEntities, ",") {
+				t.Errorf("got entities %v, want %v", keywords, test.wantEntities)
+			}
+
+			if usage.TotalUnits != 1 {
+				t.Errorf("got %d billed units, want 1", usage.TotalUnits)
+			}
+		})
+	}
+}
+
+func TestAnalyzeSentimentHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		err        error
+		wantStatus int
+		wantState  JobState
+		wantError  string
+		wantCount  int
+	}{
+		{
+			name:       "analyzes the file in a job",
+			query:      "filename=posts.json",
+			wantStatus: http.StatusAccepted,
+			wantState:  JobSucceeded,
+			wantCount:  2,
+		},
+		{
+			name:       "fails the job on an api error",
+			query:      "filename=posts.json",
+			err:        status.Error(codes.InvalidArgument, "unsupported language"),
+			wantStatus: http.StatusAccepted,
+			wantState:  JobFailed,
+			wantError:  "unsupported language",
+		},
+		{
+			name:       "fails the job of a missing file",
+			query:      "filename=missing.json",
+			wantStatus: http.StatusAccepted,
+			wantState:  JobFailed,
+			wantError:  "failed to fetch reddit posts",
+		},
+		{
+			name:       "rejects a request without a filename",
+			query:      "",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "rejects an unknown format",
+			query:      "filename=posts.json&format=xml",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wrapper, server := newTestApp(t)
+
+			server.SentimentFunc = func(text string) (*languagepb.AnalyzeSentimentResponse, error) {
+				if test.err != nil {
+					return nil, test.err
+				}
+
+				return languagetest.SentimentResponse(0.7), nil
+			}
+
+			putFile(t, wrapper, wrapper.config.Storage.RedditPrefix+"/posts.json", testPosts)
+
+			httpServer := httptest.NewServer(wrapper.newServeMux())
+
+			defer httpServer.Close()
+
+			response, err := http.Get(httpServer.URL + "/api/analyze/sentiment?" + test.query)
+
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+
+			defer response.Body.Close()
+
+			if response.StatusCode != test.wantStatus {
+				t.Fatalf("got status %d, want %d", response.StatusCode, test.wantStatus)
+			}
+
+			if test.wantStatus != http.StatusAccepted {
+				return
+			}
+
+			var accepted Job
+
+			if err := json.NewDecoder(response.Body).Decode(&accepted); err != nil {
+				t.Fatalf("parsing accepted job failed: %v", err)
+			}
+
+			if location := response.Header.Get("Location"); location != "/api/jobs/"+accepted.ID {
+				t.Errorf("got location %s for job %s", location, accepted.ID)
+			}
+
+			job := waitForJob(t, httpServer.URL, accepted.ID)
+
+			if job.State != test.wantState {
+				t.Fatalf("job %s, want %s: %s", job.State, test.wantState, job.Error)
+			}
+
+			if !strings.Contains(job.Error, test.wantError) {
+				t.Errorf("got error \"%s\", want it to contain \"%s\"", job.Error, test.wantError)
+			}
+
+			if test.wantState != JobSucceeded {
+				return
+			}
+
+			if job.RecordCount != test.wantCount {
+				t.Errorf("got %d records, want %d", job.RecordCount, test.wantCount)
+			}
+
+			analyzed, err := wrapper.fetchRedditAnalyzedPosts(job.OutputFilename)
+
+			if err != nil {
+				t.Fatalf("reading the analyzed posts failed: %v", err)
+			}
+
+			if len(analyzed) != test.wantCount {
+				t.Fatalf("got %d analyzed posts, want %d", len(analyzed), test.wantCount)
+			}
+
+			for _, post := range analyzed {
+				if post.Sentiment.ParsedSentiment != "positive" {
+					t.Errorf("post %s is %s, want positive", post.ID, post.Sentiment.ParsedSentiment)
+				}
+			}
+		})
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	wrapper, server := newTestApp(t)
+
+	// the job waits on the api until it is cancelled
+	server.SetLatency(time.Minute)
+
+	putFile(t, wrapper, wrapper.config.Storage.RedditPrefix+"/posts.json", testPosts)
+
+	httpServer := httptest.NewServer(wrapper.newServeMux())
+
+	defer httpServer.Close()
+
+	job, err := wrapper.jobs.submit(wrapper, "sentiment", "posts.json", nil)
+
+	if err != nil {
+		t.Fatalf("submitting job failed: %v", err)
+	}
+
+	for getJob(t, httpServer.URL, job.ID).State != JobRunning {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	response, err := http.Post(httpServer.URL+"/api/jobs/"+job.ID+"/cancel", "", nil)
+
+	if err != nil {
+		t.Fatalf("cancelling job failed: %v", err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted {
+		t.Fatalf("got status %d, want %d", response.StatusCode, http.StatusAccepted)
+	}
+
+	if cancelled := waitForJob(t, httpServer.URL, job.ID); cancelled.State != JobCancelled {
+		t.Fatalf("job %s, want %s", cancelled.State, JobCancelled)
+	}
+}
+
+func TestPushHandler(t *testing.T) {
+	event := base64.StdEncoding.EncodeToString([]byte(`{"eventType":"update-post-sentiment","payload":"posts.json"}`))
+
+	envelope := func(messageID string) string {
+		return fmt.Sprintf(`{"message":{"data":"%s","messageId":"%s","publishTime":"2021-10-14T17:03:02.123Z"}}`, event, messageID)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		bodies     []string
+		wantStatus int
+		wantJobs   int
+	}{
+		{
+			name:       "starts a job for the message",
+			token:      "secret",
+			bodies:     []string{envelope("1")},
+			wantStatus: http.StatusAccepted,
+			wantJobs:   1,
+		},
+		{
+			name:       "starts one job for a redelivered message",
+			token:      "secret",
+			bodies:     []string{envelope("1"), envelope("1"), envelope("1")},
+			wantStatus: http.StatusAccepted,
+			wantJobs:   1,
+		},
+		{
+			name:       "starts a job for each message",
+			token:      "secret",
+			bodies:     []string{envelope("1"), envelope("2")},
+			wantStatus: http.StatusAccepted,
+			wantJobs:   2,
+		},
+		{
+			name:       "rejects a wrong token",
+			token:      "guess",
+			bodies:     []string{envelope("1")},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "acknowledges a message without publish time",
+			token:      "secret",
+			bodies:     []string{fmt.Sprintf(`{"message":{"data":"%s","messageId":"1"}}`, event)},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "acknowledges a message without id",
+			token:      "secret",
+			bodies:     []string{fmt.Sprintf(`{"message":{"data":"%s","publishTime":"2021-10-14T17:03:02.123Z"}}`, event)},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "acknowledges an envelope that is not json",
+			token:      "secret",
+			bodies:     []string{"{\"message\":"},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "acknowledges a message of an unknown event",
+			token:      "secret",
+			bodies:     []string{fmt.Sprintf(`{"message":{"data":"%s","messageId":"1","publishTime":"2021-10-14T17:03:02.123Z"}}`, base64.StdEncoding.EncodeToString([]byte(`{"eventType":"unknown"}`)))},
+			wantStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wrapper, _ := newTestApp(t)
+
+			putFile(t, wrapper, wrapper.config.Storage.RedditPrefix+"/posts.json", testPosts)
+
+			httpServer := httptest.NewServer(wrapper.newServeMux())
+
+			defer httpServer.Close()
+
+			for _, body := range test.bodies {
+				response, err := http.Post(httpServer.URL+"/api/pubsub/push?token="+test.token, "application/json", strings.NewReader(body))
+
+				if err != nil {
+					t.Fatalf("push failed: %v", err)
+				}
+
+				response.Body.Close()
+
+				if response.StatusCode != test.wantStatus {
+					t.Fatalf("got status %d, want %d", response.StatusCode, test.wantStatus)
+				}
+			}
+
+			jobs, err := wrapper.jobs.list("", "", 50)
+
+			if err != nil {
+				t.Fatalf("listing jobs failed: %v", err)
+			}
+
+			if len(jobs) != test.wantJobs {
+				t.Errorf("got %d jobs, want %d", len(jobs), test.wantJobs)
+			}
+
+			for _, job := range jobs {
+				waitForJob(t, httpServer.URL, job.ID)
+			}
+		})
+	}
+}
+
+func TestGroupAlerts(t *testing.T) {
+	alerts := []sentiment.Alert{
+		{Rule: sentiment.EntitySpikeAlert, Entity: "soup"},
+		{Rule: sentiment.ScoreAlert},
+		{Rule: sentiment.EntitySpikeAlert, Entity: "delivery"},
+	}
+
+	rules, alertsByRule := groupAlerts(alerts)
+
+	if strings.Join(rules, ",") != sentiment.EntitySpikeAlert+","+sentiment.ScoreAlert {
+		t.Fatalf("got rules %v, want entitySpike then score", rules)
+	}
+
+	if len(alertsByRule[sentiment.EntitySpikeAlert]) != 2 || len(alertsByRule[sentiment.ScoreAlert]) != 1 {
+		t.Errorf("got alerts by rule %v", alertsByRule)
+	}
+}
+
+func TestWithoutPubSubTopic(t *testing.T) {
+	wrapper, _ := newTestApp(t)
+	wrapper.alertRules = sentiment.DefaultAlertRules()
+
+	records := []sentiment.Record{
+		{ID: "a", Sentiment: sentiment.SentimentWrapper{Score: -0.9, ParsedSentiment: "negative"}},
+	}
+
+	if err := wrapper.publishAlerts("customer", "comments.csv", records); err != nil {
+		t.Errorf("alerts were not logged: %v", err)
+	}
+
+	if err := wrapper.triggerSentimentViaPubSub("posts.json"); err == nil {
+		t.Errorf("triggering an analysis did not fail")
+	}
+}
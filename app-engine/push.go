@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/api/idtoken"
+)
+
+// the events that start an analysis, their payload is the filename
+const (
+	entityEventType    = "update-post-entity"
+	sentimentEventType = "update-post-sentiment"
+	customerEventType  = "update-customer-sentiment"
+)
+
+// analysisEvents are the analysis each event type starts
+var analysisEvents = map[string]string{
+	entityEventType:    "entity",
+	sentimentEventType: "sentiment",
+	customerEventType:  "customer",
+}
+
+// PushEnvelope is the body of a request from a pubsub push subscription
+type PushEnvelope struct {
+	Message struct {
+		Data        string            `json:"data"`
+		Attributes  map[string]string `json:"attributes"`
+		MessageID   string            `json:"messageId"`
+		PublishTime string            `json:"publishTime"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// acknowledge replies with a success status and no body, so pubsub does not deliver the message again
+// a message that can never be processed is acknowledged too, retrying it would not help
+func acknowledge(w http.ResponseWriter, messageID string, reason string) {
+	log.Printf("acknowledged message \"%s\": %s\n", messageID, reason)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// inputExists checks for the file an analysis reads, the error is a storage failure that can pass
+func (wrapper appWrapper) inputExists(analysis string, filename string) (bool, error) {
+	storageCTX, storageCTXCancel := context.WithTimeout(wrapper.ctx, time.Duration(wrapper.config.Storage.Timeout))
+
+	defer storageCTXCancel()
+
+	prefix := wrapper.config.Storage.RedditPrefix
+
+	if analysis == "customer" {
+		prefix = wrapper.config.Storage.CustomerPrefix
+	}
+
+	return wrapper.store.Exists(storageCTX, prefix+"/"+filename)
+}
+
+// authorizePush checks the token query parameter and the OIDC token of a push request, the error is shown to the caller
+func authorizePush(r *http.Request, config PubSubConfig) error {
+	if config.PushToken != "" && subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(config.PushToken)) != 1 {
+		return fmt.Errorf("invalid token")
+	}
+
+	if config.PushAudience == "" {
+		return nil
+	}
+
+	authorization := r.Header.Get("Authorization")
+
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return fmt.Errorf("missing bearer token")
+	}
+
+	payload, err := idtoken.Validate(r.Context(), strings.TrimPrefix(authorization, "Bearer "), config.PushAudience)
+
+	if err != nil {
+		return fmt.Errorf("invalid bearer token: %v", err)
+	}
+
+	if config.PushServiceAccount == "" {
+		return nil
+	}
+
+	email, _ := payload.Claims["email"].(string)
+	verified, _ := payload.Claims["email_verified"].(bool)
+
+	if !verified || email != config.PushServiceAccount {
+		return fmt.Errorf("bearer token is not from %s", config.PushServiceAccount)
+	}
+
+	return nil
+}
+
+// validateEventParams checks the options of the analysis like the analyze endpoints do
+func (wrapper appWrapper) validateEventParams(analysis string, params url.Values) error {
+	if analysis == "customer" {
+		_, err := wrapper.parseCustomerOptions(params)
+
+		return err
+	}
+
+	_, err := parseExportOptions(params)
+
+	return err
+}
+
+// pushHandler starts the analysis of the PubSubEvent in a pushed message as a job, the attributes
+// of the message other than eventType are the options of the analyze endpoints, e.g. format=csv
+// any status other than 2xx makes pubsub deliver the message again, so it is only used for failures that can pass,
+// a wrong token or OIDC token is 403 and a storage failure is 503
+// e.g. /api/pubsub/push?token=secret as the endpoint of the push subscription, or an OIDC token with pubsub.pushAudience
+func (wrapper appWrapper) pushHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("must be POST request"))
+
+		return
+	}
+
+	if err := authorizePush(r, wrapper.config.PubSub); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(err.Error()))
+
+		return
+	}
+
+	var envelope PushEnvelope
+
+	if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+		acknowledge(w, "", fmt.Sprintf("invalid push envelope: %v", err))
+
+		return
+	}
+
+	messageID := envelope.Message.MessageID
+
+	if messageID == "" {
+		acknowledge(w, messageID, "invalid push envelope: missing message.messageId")
+
+		return
+	}
+
+	publishedAt, err := time.Parse(time.RFC3339Nano, envelope.Message.PublishTime)
+
+	if err != nil {
+		acknowledge(w, messageID, fmt.Sprintf("invalid push envelope: message.publishTime: %v", err))
+
+		return
+	}
+
+	data, err := base64.StdEncoding.DecodeString(envelope.Message.Data)
+
+	if err != nil {
+		acknowledge(w, messageID, fmt.Sprintf("data is not base64: %v", err))
+
+		return
+	}
+
+	var event PubSubEvent
+
+	if err := json.Unmarshal(data, &event); err != nil {
+		acknowledge(w, messageID, fmt.Sprintf("data is not an event: %v", err))
+
+		return
+	}
+
+	if event.EventType == alertEventType {
+		acknowledge(w, messageID, "alerts are for other subscribers")
+
+		return
+	}
+
+	analysis, ok := analysisEvents[event.EventType]
+
+	if !ok {
+		acknowledge(w, messageID, fmt.Sprintf("unknown event type \"%s\"", event.EventType))
+
+		return
+	}
+
+	filename := strings.TrimSpace(event.Payload)
+
+	if filename == "" {
+		acknowledge(w, messageID, "missing filename in the payload")
+
+		return
+	}
+
+	params := url.Values{}
+
+	for key, value := range envelope.Message.Attributes {
+		if key != "eventType" {
+			params.Set(key, value)
+		}
+	}
+
+	if err := wrapper.validateEventParams(analysis, params); err != nil {
+		acknowledge(w, messageID, fmt.Sprintf("invalid attributes: %v", err))
+
+		return
+	}
+
+	exists, err := wrapper.inputExists(analysis, filename)
+
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "checking \"%s\" failed: %v", filename, err)
+
+		return
+	}
+
+	if !exists {
+		acknowledge(w, messageID, fmt.Sprintf("\"%s\" does not exist", filename))
+
+		return
+	}
+
+	job, duplicate, err := wrapper.jobs.submitMessage(wrapper, messageID, publishedAt, analysis, filename, params)
+
+	if err != nil {
+		// the job may run, but pubsub must keep the message until the job is saved, the redelivery finds the job
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "queueing the job of message %s failed: %v", messageID, err)
+
+		return
+	}
+
+	if duplicate {
+		log.Printf("message %s was delivered again, it started job %s\n", messageID, job.ID)
+	}
+
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	writeJob(w, http.StatusAccepted, job)
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis/blob"
+)
+
+// the jobs are saved one json file per job, so a save never rewrites the other jobs
+const jobExtension = ".json"
+
+// newLeaseOwner names this instance in the leases it takes, GAE_INSTANCE is set on App Engine
+func newLeaseOwner() string {
+	random := make([]byte, 4)
+
+	if _, err := rand.Read(random); err != nil {
+		log.Printf("failed to read random lease owner: %v\n", err)
+	}
+
+	owner := hex.EncodeToString(random)
+
+	if instance := os.Getenv("GAE_INSTANCE"); instance != "" {
+		owner = instance + "-" + owner
+	}
+
+	return owner
+}
+
+// lease gives the job to this instance for another lease duration, the caller holds the lock
+func (tracker *jobTracker) lease(job *Job) {
+	expiresAt := time.Now().Add(time.Duration(tracker.config.Lease))
+
+	job.LeaseOwner = tracker.owner
+	job.LeaseExpiresAt = &expiresAt
+}
+
+// isLeaseExpired checks if no living instance works on the job
+func (job Job) isLeaseExpired(now time.Time) bool {
+	return job.LeaseOwner == "" || job.LeaseExpiresAt == nil || now.After(*job.LeaseExpiresAt)
+}
+
+func (tracker *jobTracker) jobName(id string) string {
+	return tracker.config.Prefix + "/" + id + jobExtension
+}
+
+// activeName marks an unfinished job, so resuming the jobs does not read the finished ones
+func (tracker *jobTracker) activeName(id string) string {
+	return tracker.config.Prefix + "/active/" + id
+}
+
+func (tracker *jobTracker) storageContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(tracker.wrapper.ctx, time.Duration(tracker.wrapper.config.Storage.Timeout))
+}
+
+// saveJob writes the job over the generation this instance saved last, a new job is only created
+// once another instance took the job over the save fails with blob.ErrChanged and the job is lost, the caller holds saveMu
+// a job is marked active before it is first saved, and unmarked once it is saved finished
+func (tracker *jobTracker) saveJob(job Job) error {
+	if !job.State.isFinished() && tracker.generations[job.ID] == blob.NoGeneration {
+		if err := tracker.markActive(job); err != nil {
+			return fmt.Errorf("marking job active failed: %v", err)
+		}
+	}
+
+	storageCTX, storageCTXCancel := tracker.storageContext()
+
+	defer storageCTXCancel()
+
+	storageWriter, err := tracker.store.NewConditionalWriter(storageCTX, tracker.jobName(job.ID), tracker.generations[job.ID])
+
+	if err != nil {
+		return fmt.Errorf("getting bucket writer failed: %v", err)
+	}
+
+	if err := json.NewEncoder(storageWriter).Encode(job); err != nil {
+		storageWriter.Discard()
+
+		return err
+	}
+
+	err = storageWriter.Close()
+
+	if errors.Is(err, blob.ErrChanged) {
+		tracker.lose(job.ID)
+
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !job.State.isFinished() {
+		tracker.generations[job.ID] = storageWriter.Generation()
+
+		return nil
+	}
+
+	delete(tracker.generations, job.ID)
+
+	// a mark left behind is removed when the jobs are resumed
+	if err := tracker.unmarkActive(job.ID); err != nil {
+		log.Printf("failed to unmark job %s: %v\n", job.ID, err)
+	}
+
+	return nil
+}
+
+// markActive saves the creation time of the job as its mark
+func (tracker *jobTracker) markActive(job Job) error {
+	storageCTX, storageCTXCancel := tracker.storageContext()
+
+	defer storageCTXCancel()
+
+	storageWriter, err := tracker.store.NewWriter(storageCTX, tracker.activeName(job.ID))
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := storageWriter.Write([]byte(job.CreatedAt.Format(time.RFC3339Nano))); err != nil {
+		storageWriter.Discard()
+
+		return err
+	}
+
+	return storageWriter.Close()
+}
+
+// isMarkAbandoned checks if the mark of a job that was never saved is older than a lease,
+// a younger mark may belong to a job that is being saved right now
+func (tracker *jobTracker) isMarkAbandoned(id string) (bool, error) {
+	storageCTX, storageCTXCancel := tracker.storageContext()
+
+	defer storageCTXCancel()
+
+	storageReader, err := tracker.store.NewReader(storageCTX, tracker.activeName(id))
+
+	if err != nil {
+		return false, err
+	}
+
+	defer storageReader.Close()
+
+	mark, err := ioutil.ReadAll(storageReader)
+
+	if err != nil {
+		return false, err
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, string(mark))
+
+	if err != nil {
+		// not a mark this server wrote
+		return true, nil
+	}
+
+	return time.Since(createdAt) > time.Duration(tracker.config.Lease), nil
+}
+
+func (tracker *jobTracker) unmarkActive(id string) error {
+	storageCTX, storageCTXCancel := tracker.storageContext()
+
+	defer storageCTXCancel()
+
+	err := tracker.store.Delete(storageCTX, tracker.activeName(id))
+
+	if errors.Is(err, blob.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// lose forgets a job another instance took over and stops it, without saving it again, the caller holds saveMu
+func (tracker *jobTracker) lose(id string) {
+	delete(tracker.generations, id)
+
+	tracker.mu.Lock()
+	cancel := tracker.cancels[id]
+	delete(tracker.jobs, id)
+	delete(tracker.cancels, id)
+	tracker.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+
+	log.Printf("lost job %s to another instance\n", id)
+}
+
+func (tracker *jobTracker) deleteJob(id string) error {
+	storageCTX, storageCTXCancel := tracker.storageContext()
+
+	defer storageCTXCancel()
+
+	return tracker.store.Delete(storageCTX, tracker.jobName(id))
+}
+
+// loadJob reads a saved job and the generation it was read at, a job that was never saved is errJobNotFound
+func (tracker *jobTracker) loadJob(id string) (Job, blob.Generation, error) {
+	storageCTX, storageCTXCancel := tracker.storageContext()
+
+	defer storageCTXCancel()
+
+	storageReader, generation, err := tracker.store.NewGenerationReader(storageCTX, tracker.jobName(id))
+
+	if errors.Is(err, blob.ErrNotExist) {
+		return Job{}, blob.NoGeneration, errJobNotFound
+	}
+
+	if err != nil {
+		return Job{}, blob.NoGeneration, fmt.Errorf("reading job %s failed: %v", id, err)
+	}
+
+	defer storageReader.Close()
+
+	var job Job
+
+	if err := json.NewDecoder(storageReader).Decode(&job); err != nil {
+		return Job{}, blob.NoGeneration, fmt.Errorf("parsing job %s failed: %v", id, err)
+	}
+
+	return job, generation, nil
+}
+
+// savedJobIDs lists the ids of the saved jobs
+func (tracker *jobTracker) savedJobIDs() ([]string, error) {
+	storageCTX, storageCTXCancel := tracker.storageContext()
+
+	defer storageCTXCancel()
+
+	names, err := tracker.store.List(storageCTX, tracker.config.Prefix+"/")
+
+	if err != nil {
+		return nil, fmt.Errorf("listing jobs failed: %v", err)
+	}
+
+	ids := make([]string, 0)
+
+	for _, name := range names {
+		filename := strings.TrimPrefix(name, tracker.config.Prefix+"/")
+
+		if strings.Contains(filename, "/") || !strings.HasSuffix(filename, jobExtension) {
+			continue
+		}
+
+		ids = append(ids, strings.TrimSuffix(filename, jobExtension))
+	}
+
+	return ids, nil
+}
+
+// activeJobIDs lists the ids of the jobs marked active
+func (tracker *jobTracker) activeJobIDs() ([]string, error) {
+	storageCTX, storageCTXCancel := tracker.storageContext()
+
+	defer storageCTXCancel()
+
+	names, err := tracker.store.List(storageCTX, tracker.activeName(""))
+
+	if err != nil {
+		return nil, fmt.Errorf("listing active jobs failed: %v", err)
+	}
+
+	ids := make([]string, 0)
+
+	for _, name := range names {
+		ids = append(ids, strings.TrimPrefix(name, tracker.activeName("")))
+	}
+
+	return ids, nil
+}
+
+// start resumes the saved jobs, then keeps the leases of this instance alive,
+// picks up the jobs of instances that stopped renewing theirs and prunes the finished jobs
+func (tracker *jobTracker) start(wrapper appWrapper) {
+	tracker.wrapper = wrapper
+
+	tracker.resume()
+	tracker.prune()
+
+	go func() {
+		renewTicker := time.NewTicker(time.Duration(tracker.config.Lease) / 3)
+		resumeTicker := time.NewTicker(time.Duration(tracker.config.Lease))
+
+		defer renewTicker.Stop()
+		defer resumeTicker.Stop()
+
+		for {
+			select {
+			case <-wrapper.ctx.Done():
+				return
+			case <-renewTicker.C:
+				tracker.renewLeases()
+			case <-resumeTicker.C:
+				tracker.resume()
+				tracker.prune()
+			}
+		}
+	}()
+}
+
+// renewLeases extends the leases of the queued and running jobs of this instance, the jobs
+// another instance took over in the meantime are stopped
+func (tracker *jobTracker) renewLeases() {
+	tracker.saveMu.Lock()
+	defer tracker.saveMu.Unlock()
+
+	tracker.mu.Lock()
+
+	leased := make([]Job, 0)
+
+	for _, job := range tracker.jobs {
+		if job.State.isFinished() || job.LeaseOwner != tracker.owner {
+			continue
+		}
+
+		tracker.lease(job)
+		leased = append(leased, *job)
+	}
+
+	tracker.mu.Unlock()
+
+	for _, job := range leased {
+		if err := tracker.saveJob(job); err != nil && !errors.Is(err, blob.ErrChanged) {
+			log.Printf("failed to renew the lease of job %s: %v\n", job.ID, err)
+		}
+	}
+}
+
+// resume queues the active jobs no instance holds a lease on, each job is read with a timeout of its own
+// the analysis overwrites its output, so running an interrupted job again is safe
+// the lease is taken with a save over the generation the job was read at, so only one instance takes an expired job
+func (tracker *jobTracker) resume() {
+	ids, err := tracker.activeJobIDs()
+
+	if err != nil {
+		log.Printf("failed to load jobs: %v\n", err)
+
+		return
+	}
+
+	for _, id := range ids {
+		tracker.mu.Lock()
+		_, known := tracker.jobs[id]
+		tracker.mu.Unlock()
+
+		if known {
+			continue
+		}
+
+		job, generation, err := tracker.loadJob(id)
+
+		if err != nil && err != errJobNotFound {
+			log.Printf("failed to load job %s: %v\n", id, err)
+
+			continue
+		}
+
+		// the instance died between marking the job and saving it
+		if err == errJobNotFound {
+			if abandoned, err := tracker.isMarkAbandoned(id); err != nil || !abandoned {
+				continue
+			}
+		}
+
+		// or between saving it finished and unmarking it
+		if err == errJobNotFound || job.State.isFinished() {
+			if err := tracker.unmarkActive(id); err != nil {
+				log.Printf("failed to unmark job %s: %v\n", id, err)
+			}
+
+			continue
+		}
+
+		now := time.Now()
+
+		if !job.isLeaseExpired(now) {
+			continue
+		}
+
+		if job.State == JobRunning {
+			log.Printf("job %s was interrupted on %s after %d attempts\n", job.ID, job.LeaseOwner, job.Attempts)
+
+			job.State = JobQueued
+		}
+
+		tracker.saveMu.Lock()
+		tracker.generations[job.ID] = generation
+		tracker.saveMu.Unlock()
+
+		if job.Attempts >= tracker.config.MaxAttempts {
+			tracker.abandon(job, fmt.Errorf("interrupted %d times, giving up", job.Attempts))
+
+			continue
+		}
+
+		log.Printf("resuming %s job %s for \"%s\"\n", job.Analysis, job.ID, job.Filename)
+
+		if _, err := tracker.enqueue(tracker.wrapper, &job); errors.Is(err, blob.ErrChanged) {
+			log.Printf("job %s was resumed by another instance first\n", job.ID)
+		}
+	}
+}
+
+// abandon fails a resumed queued job without running it
+func (tracker *jobTracker) abandon(job Job, reason error) {
+	tracker.mu.Lock()
+	tracker.jobs[job.ID] = &job
+	tracker.mu.Unlock()
+
+	err := tracker.transition(job.ID, JobFailed, func(job *Job) {
+		finishedAt := time.Now()
+		job.FinishedAt = &finishedAt
+		job.Error = reason.Error()
+		job.LeaseOwner = ""
+		job.LeaseExpiresAt = nil
+	})
+
+	if err != nil {
+		// another instance took the job over
+		if !errors.Is(err, blob.ErrChanged) {
+			log.Printf("failed to abandon job %s: %v\n", job.ID, err)
+		}
+
+		return
+	}
+
+	log.Printf("failed job %s: %v\n", job.ID, reason)
+}
+
+// prune deletes the oldest finished jobs beyond the history from the store and forgets them
+// a job is marked active before it is first saved, so listing the saved jobs before the marks
+// finds the mark of every unfinished job in the listing
+func (tracker *jobTracker) prune() {
+	ids, err := tracker.savedJobIDs()
+
+	if err != nil {
+		log.Printf("failed to prune jobs: %v\n", err)
+
+		return
+	}
+
+	activeIDs, err := tracker.activeJobIDs()
+
+	if err != nil {
+		log.Printf("failed to prune jobs: %v\n", err)
+
+		return
+	}
+
+	unfinished := make(map[string]bool)
+
+	for _, id := range activeIDs {
+		unfinished[id] = true
+	}
+
+	tracker.mu.Lock()
+
+	for id, job := range tracker.jobs {
+		if !job.State.isFinished() {
+			unfinished[id] = true
+		}
+	}
+
+	tracker.mu.Unlock()
+
+	finished := make([]string, 0)
+
+	for _, id := range ids {
+		if !unfinished[id] {
+			finished = append(finished, id)
+		}
+	}
+
+	if len(finished) <= tracker.config.History {
+		return
+	}
+
+	sort.Strings(finished)
+
+	for i := 0; i < len(finished)-tracker.config.History; i++ {
+		tracker.mu.Lock()
+
+		if job, ok := tracker.jobs[finished[i]]; ok && job.State.isFinished() {
+			delete(tracker.jobs, finished[i])
+		}
+
+		tracker.mu.Unlock()
+
+		// another instance pruned it first
+		if err := tracker.deleteJob(finished[i]); err != nil && !errors.Is(err, blob.ErrNotExist) {
+			log.Printf("failed to delete job %s: %v\n", finished[i], err)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+)
+
+// newRedactor uses the detectors of the config, the default detectors when there are none,
+// plus the names listed in the dictionary file, one name per line
+func newRedactor(config AnalysisConfig) (*sentiment.Redactor, error) {
+	var dictionary io.Reader
+
+	if config.RedactionDictionary != "" {
+		dictionaryFile, err := os.Open(config.RedactionDictionary)
+
+		if err != nil {
+			return nil, fmt.Errorf("opening redaction dictionary failed: %v", err)
+		}
+
+		defer dictionaryFile.Close()
+
+		log.Printf("redacting the names in \"%s\"\n", config.RedactionDictionary)
+
+		dictionary = dictionaryFile
+	}
+
+	return sentiment.LoadRedactor(config.RedactionDetectors, dictionary, config.RedactionNameToken)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+)
+
+// JobSummary is saved next to the analyzed output, so we know what a job did and what it cost
+type JobSummary struct {
+	Analysis       string                    `json:"analysis"`
+	Filename       string                    `json:"filename"`
+	OutputFilename string                    `json:"outputFilename"`
+	RecordCount    int                       `json:"recordCount"`
+	RejectedRows   []sentiment.RowError      `json:"rejectedRows,omitempty"`
+	Emotions       *sentiment.EmotionSummary `json:"emotions,omitempty"`
+	StartedAt      time.Time                 `json:"startedAt"`
+	FinishedAt     time.Time                 `json:"finishedAt"`
+	Usage          *sentiment.Usage          `json:"usage"`
+	Error          string                    `json:"error,omitempty"`
+}
+
+// DryRunEstimate is the reply of a dry run, nothing is sent to Google's api
+type DryRunEstimate struct {
+	Filename string           `json:"filename"`
+	Usage    *sentiment.Usage `json:"usage"`
+}
+
+func newJobSummary(analysis string, filename string) *JobSummary {
+	return &JobSummary{
+		Analysis:  analysis,
+		Filename:  filename,
+		StartedAt: time.Now(),
+		Usage:     sentiment.NewUsage(),
+	}
+}
+
+func (summary *JobSummary) finish(outputFilename string, recordCount int) {
+	summary.OutputFilename = outputFilename
+	summary.RecordCount = recordCount
+	summary.FinishedAt = time.Now()
+
+	log.Printf("analysis of \"%s\" used %s\n", summary.Filename, summary.Usage)
+}
+
+func summarizeWrapperEmotions(wrappedPosts []sentiment.AnalysisWrapper) *sentiment.EmotionSummary {
+	emotions := make([]*sentiment.EmotionScores, 0)
+
+	for i := 0; i < len(wrappedPosts); i++ {
+		emotions = append(emotions, wrappedPosts[i].Emotion)
+	}
+
+	summary := sentiment.SummarizeEmotions(emotions)
+
+	return &summary
+}
+
+func summarizeCustomerEmotions(comments []sentiment.CustomerAnalysis) *sentiment.EmotionSummary {
+	emotions := make([]*sentiment.EmotionScores, 0)
+
+	for i := 0; i < len(comments); i++ {
+		emotions = append(emotions, comments[i].Emotion)
+	}
+
+	summary := sentiment.SummarizeEmotions(emotions)
+
+	return &summary
+}
+
+func (wrapper appWrapper) saveJobSummary(bucket string, summary *JobSummary) error {
+	return wrapper.saveReport(bucket, appendToFilename(summary.OutputFilename, "summary"), summary)
+}
+
+// failJob saves the summary of a job that failed after its first call to Google's api, those calls are billed too
+// it returns err, so the caller can return it
+func (wrapper appWrapper) failJob(bucket string, outputFilename string, summary *JobSummary, err error) error {
+	summary.Error = err.Error()
+	summary.finish(outputFilename, 0)
+
+	// the context of a cancelled job is done, the summary is saved anyway
+	wrapper.ctx = context.Background()
+
+	if saveErr := wrapper.saveJobSummary(bucket, summary); saveErr != nil {
+		log.Printf("failed to upload job summary: %v\n", saveErr)
+	}
+
+	return err
+}
+
+// saveReport writes report as indented json, reports are read by people
+func (wrapper appWrapper) saveReport(bucket string, filename string, report interface{}) error {
+	storageCTX, storageCTXCancel := context.WithTimeout(wrapper.ctx, time.Duration(wrapper.config.Storage.Timeout))
+
+	defer storageCTXCancel()
+
+	storageWriter, err := wrapper.store.NewWriter(storageCTX, bucket+"/"+filename)
+
+	if err != nil {
+		return fmt.Errorf("getting bucket writer failed: %v", err)
+	}
+
+	encoder := json.NewEncoder(storageWriter)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(report); err != nil {
+		storageWriter.Discard()
+
+		return err
+	}
+
+	return storageWriter.Close()
+}
+
+// isDryRun checks for the optional dryRun query parameter
+func isDryRun(r *http.Request) bool {
+	dryRun, err := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+
+	return err == nil && dryRun
+}
+
+// estimatePosts reads the reddit posts the analysis would send to Google's api
+func (wrapper appWrapper) estimatePosts(filename string, feature sentiment.Feature) (*sentiment.Usage, error) {
+	// analyzed files are re-analyzed from their original posts
+	if isAnalysisFilename(filename) {
+		filename = strings.Replace(filename, "_analyzed", "", 1)
+	}
+
+	posts, err := wrapper.fetchRedditPosts(filename)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch reddit posts from \"%s\": %v", filename, err)
+	}
+
+	// the bodies are normalized before they are sent, like the analysis does
+	posts = sentiment.PrepareSignals(posts)
+
+	return sentiment.EstimatePosts(posts, feature), nil
+}
+
+func (wrapper appWrapper) estimateCustomerComments(filename string, options customerOptions) (*sentiment.Usage, error) {
+	comments, _, err := wrapper.fetchCustomerComments(filename, options.columnMapping, options.strictRows)
+
+	if err != nil {
+		return nil, fmt.Errorf("fetching customer comments failed: %v", err)
+	}
+
+	comments = sentiment.RedactCustomerComments(wrapper.redactor, comments)
+
+	return sentiment.EstimateCustomerComments(comments), nil
+}
+
+func writeEstimate(w http.ResponseWriter, filename string, usage *sentiment.Usage, err error) {
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	json.NewEncoder(w).Encode(DryRunEstimate{
+		Filename: filename,
+		Usage:    usage,
+	})
+}
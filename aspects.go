@@ -0,0 +1,178 @@
+package sentiment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Aspect is a part of the business customers talk about e.g. shipping.
+// an entity belongs to the aspect when its name is one of Entities or contains one of Keywords as whole words
+type Aspect struct {
+	Name     string   `json:"name"`
+	Keywords []string `json:"keywords,omitempty"`
+	Entities []string `json:"entities,omitempty"`
+}
+
+// AspectTaxonomy is the list of aspects comments are broken down by
+type AspectTaxonomy []Aspect
+
+// AspectSentiment is the sentiment of a comment towards a single aspect
+type AspectSentiment struct {
+	Aspect          string   `json:"aspect"`
+	Score           float32  `json:"score"`
+	ParsedSentiment string   `json:"parsedSentiment"`
+	Mentions        int      `json:"mentions"`
+	Entities        []string `json:"entities"`
+}
+
+// AspectRollup is the sentiment towards a single aspect across all comments
+type AspectRollup struct {
+	Aspect    string         `json:"aspect"`
+	Comments  int            `json:"comments"`
+	Mentions  int            `json:"mentions"`
+	MeanScore float64        `json:"meanScore"`
+	Labels    map[string]int `json:"labels"`
+}
+
+// DefaultAspectTaxonomy covers the usual topics of our customer feedback
+func DefaultAspectTaxonomy() AspectTaxonomy {
+	return AspectTaxonomy{
+		{Name: "product", Keywords: []string{"product", "item", "quality", "size", "fit", "color"}},
+		{Name: "shipping", Keywords: []string{"shipping", "delivery", "package", "courier", "arrival", "tracking"}},
+		{Name: "price", Keywords: []string{"price", "cost", "value", "discount", "refund", "money"}},
+		{Name: "support", Keywords: []string{"support", "service", "staff", "agent", "help", "representative"}},
+		{Name: "website", Keywords: []string{"website", "site", "app", "checkout", "account", "login"}},
+	}
+}
+
+// ParseAspectTaxonomy reads a json list of aspects
+func ParseAspectTaxonomy(r io.Reader) (AspectTaxonomy, error) {
+	var taxonomy AspectTaxonomy
+
+	if err := json.NewDecoder(r).Decode(&taxonomy); err != nil {
+		return taxonomy, fmt.Errorf("parsing aspect taxonomy failed: %v", err)
+	}
+
+	for i := 0; i < len(taxonomy); i++ {
+		if taxonomy[i].Name == "" {
+			return taxonomy, fmt.Errorf("aspect %d of the taxonomy has no name", i)
+		}
+	}
+
+	return taxonomy, nil
+}
+
+// matches checks if the entity named name belongs to the aspect
+func (aspect Aspect) matches(name string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	for _, entity := range aspect.Entities {
+		if strings.ToLower(strings.TrimSpace(entity)) == name {
+			return true
+		}
+	}
+
+	// padding with spaces only matches whole words
+	paddedName := " " + strings.Join(strings.Fields(name), " ") + " "
+
+	for _, keyword := range aspect.Keywords {
+		paddedKeyword := " " + strings.Join(strings.Fields(strings.ToLower(keyword)), " ") + " "
+
+		if strings.Contains(paddedName, paddedKeyword) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getAspects finds the aspects of the entities, the score of an aspect is weighted by the mentions of its entities
+func getAspects(entities []EntityWrapper, taxonomy AspectTaxonomy) []AspectSentiment {
+	aspects := make([]AspectSentiment, 0)
+
+	for _, aspect := range taxonomy {
+		aspectSentiment := AspectSentiment{
+			Aspect:   aspect.Name,
+			Entities: make([]string, 0),
+		}
+
+		weightedScore := float32(0)
+
+		for _, entity := range entities {
+			if !aspect.matches(entity.Keyword) {
+				continue
+			}
+
+			weightedScore += entity.Score * float32(entity.Count)
+			aspectSentiment.Mentions += entity.Count
+			aspectSentiment.Entities = append(aspectSentiment.Entities, entity.Keyword)
+		}
+
+		if aspectSentiment.Mentions == 0 {
+			continue
+		}
+
+		aspectSentiment.Score = weightedScore / float32(aspectSentiment.Mentions)
+		aspectSentiment.ParsedSentiment = parseSentiment(aspectSentiment.Score)
+
+		aspects = append(aspects, aspectSentiment)
+	}
+
+	return aspects
+}
+
+// AssignAspects breaks the entity sentiment of each analyzed comment down by the aspects of taxonomy
+func AssignAspects(comments []CustomerAnalysis, taxonomy AspectTaxonomy) []CustomerAnalysis {
+	for i := 0; i < len(comments); i++ {
+		comments[i].Aspects = getAspects(comments[i].Entity, taxonomy)
+	}
+
+	return comments
+}
+
+// RollupAspects sums up the aspects of every comment, the most discussed aspect comes first
+func RollupAspects(comments []CustomerAnalysis) []AspectRollup {
+	rollups := make(map[string]*AspectRollup)
+	scoreSums := make(map[string]float64)
+
+	for _, comment := range comments {
+		for _, aspect := range comment.Aspects {
+			rollup, ok := rollups[aspect.Aspect]
+
+			if !ok {
+				rollup = &AspectRollup{
+					Aspect: aspect.Aspect,
+					Labels: make(map[string]int),
+				}
+
+				rollups[aspect.Aspect] = rollup
+			}
+
+			rollup.Comments++
+			rollup.Mentions += aspect.Mentions
+			rollup.Labels[aspect.ParsedSentiment]++
+			scoreSums[aspect.Aspect] += float64(aspect.Score)
+		}
+	}
+
+	rolledUp := make([]AspectRollup, 0)
+
+	for name, rollup := range rollups {
+		rollup.MeanScore = scoreSums[name] / float64(rollup.Comments)
+
+		rolledUp = append(rolledUp, *rollup)
+	}
+
+	sort.Slice(rolledUp, func(i, j int) bool {
+		if rolledUp[i].Comments != rolledUp[j].Comments {
+			return rolledUp[i].Comments > rolledUp[j].Comments
+		}
+
+		return rolledUp[i].Aspect < rolledUp[j].Aspect
+	})
+
+	return rolledUp
+}
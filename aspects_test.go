@@ -0,0 +1,155 @@
+package sentiment
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestAssignAspects(t *testing.T) {
+	tests := []struct {
+		name     string
+		taxonomy AspectTaxonomy
+		entities []EntityWrapper
+		want     []AspectSentiment
+	}{
+		{
+			name:     "weights the score of an aspect by the mentions of its entities",
+			taxonomy: DefaultAspectTaxonomy(),
+			entities: []EntityWrapper{
+				{Keyword: "delivery", Count: 3, Score: -0.8},
+				{Keyword: "Tracking Number", Count: 1, Score: 0.4},
+				{Keyword: "soup", Count: 2, Score: 0.9},
+			},
+			want: []AspectSentiment{
+				{Aspect: "shipping", Score: -0.5, ParsedSentiment: "negative", Mentions: 4, Entities: []string{"delivery", "Tracking Number"}},
+			},
+		},
+		{
+			name:     "matches whole words only",
+			taxonomy: DefaultAspectTaxonomy(),
+			entities: []EntityWrapper{
+				{Keyword: "happiness", Count: 1, Score: 0.9},
+				{Keyword: "application", Count: 1, Score: 0.9},
+			},
+			want: []AspectSentiment{},
+		},
+		{
+			name:     "matches the listed entities exactly",
+			taxonomy: AspectTaxonomy{{Name: "staff", Entities: []string{"Bob"}}},
+			entities: []EntityWrapper{
+				{Keyword: " bob ", Count: 2, Score: 0.6},
+				{Keyword: "bobby", Count: 1, Score: -0.6},
+			},
+			want: []AspectSentiment{
+				{Aspect: "staff", Score: 0.6, ParsedSentiment: "positive", Mentions: 2, Entities: []string{" bob "}},
+			},
+		},
+		{
+			name:     "counts an entity in every aspect it matches",
+			taxonomy: DefaultAspectTaxonomy(),
+			entities: []EntityWrapper{
+				{Keyword: "support app", Count: 1, Score: -0.4},
+			},
+			want: []AspectSentiment{
+				{Aspect: "support", Score: -0.4, ParsedSentiment: "negative", Mentions: 1, Entities: []string{"support app"}},
+				{Aspect: "website", Score: -0.4, ParsedSentiment: "negative", Mentions: 1, Entities: []string{"support app"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			comments := AssignAspects([]CustomerAnalysis{{Entity: test.entities}}, test.taxonomy)
+			aspects := comments[0].Aspects
+
+			if len(aspects) != len(test.want) {
+				t.Fatalf("got aspects %+v, want %+v", aspects, test.want)
+			}
+
+			for i := 0; i < len(aspects); i++ {
+				got, want := aspects[i], test.want[i]
+
+				if got.Aspect != want.Aspect || got.Mentions != want.Mentions || got.ParsedSentiment != want.ParsedSentiment {
+					t.Errorf("got aspect %+v, want %+v", got, want)
+				}
+
+				if math.Abs(float64(got.Score-want.Score)) > 1e-6 {
+					t.Errorf("%s: got score %v, want %v", got.Aspect, got.Score, want.Score)
+				}
+
+				if strings.Join(got.Entities, ",") != strings.Join(want.Entities, ",") {
+					t.Errorf("%s: got entities %v, want %v", got.Aspect, got.Entities, want.Entities)
+				}
+			}
+		})
+	}
+}
+
+func TestRollupAspects(t *testing.T) {
+	comments := []CustomerAnalysis{
+		{Aspects: []AspectSentiment{
+			{Aspect: "shipping", Score: -0.6, ParsedSentiment: "negative", Mentions: 2},
+			{Aspect: "price", Score: 0.4, ParsedSentiment: "positive", Mentions: 1},
+		}},
+		{Aspects: []AspectSentiment{
+			{Aspect: "shipping", Score: 0.2, ParsedSentiment: "positive", Mentions: 1},
+		}},
+		{Aspects: []AspectSentiment{
+			{Aspect: "product", Score: 0.8, ParsedSentiment: "positive", Mentions: 1},
+		}},
+	}
+
+	rollups := RollupAspects(comments)
+
+	want := []AspectRollup{
+		{Aspect: "shipping", Comments: 2, Mentions: 3, MeanScore: -0.2},
+		{Aspect: "price", Comments: 1, Mentions: 1, MeanScore: 0.4},
+		{Aspect: "product", Comments: 1, Mentions: 1, MeanScore: 0.8},
+	}
+
+	if len(rollups) != len(want) {
+		t.Fatalf("got rollups %+v, want %+v", rollups, want)
+	}
+
+	for i := 0; i < len(rollups); i++ {
+		if rollups[i].Aspect != want[i].Aspect || rollups[i].Comments != want[i].Comments || rollups[i].Mentions != want[i].Mentions {
+			t.Errorf("rollup %d: got %+v, want %+v", i, rollups[i], want[i])
+		}
+
+		if math.Abs(rollups[i].MeanScore-want[i].MeanScore) > 1e-6 {
+			t.Errorf("%s: got mean score %v, want %v", rollups[i].Aspect, rollups[i].MeanScore, want[i].MeanScore)
+		}
+	}
+
+	if rollups[0].Labels["negative"] != 1 || rollups[0].Labels["positive"] != 1 {
+		t.Errorf("got shipping labels %v, want one negative and one positive", rollups[0].Labels)
+	}
+}
+
+func TestParseAspectTaxonomy(t *testing.T) {
+	tests := []struct {
+		name     string
+		taxonomy string
+		want     int
+		wantErr  bool
+	}{
+		{name: "reads the aspects", taxonomy: `[{"name": "food", "keywords": ["soup"]}, {"name": "staff", "entities": ["Bob"]}]`, want: 2},
+		{name: "rejects an aspect without a name", taxonomy: `[{"keywords": ["soup"]}]`, wantErr: true},
+		{name: "rejects invalid json", taxonomy: `{"name": "food"}`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			taxonomy, err := ParseAspectTaxonomy(strings.NewReader(test.taxonomy))
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+
+			if err == nil && len(taxonomy) != test.want {
+				t.Errorf("got %d aspects, want %d", len(taxonomy), test.want)
+			}
+		})
+	}
+}
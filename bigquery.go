@@ -0,0 +1,295 @@
+package sentiment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BigQueryField is a column of a BigQuery JSON schema, as taken by bq load --schema
+type BigQueryField struct {
+	Name   string          `json:"name"`
+	Type   string          `json:"type"`
+	Mode   string          `json:"mode"`
+	Fields []BigQueryField `json:"fields,omitempty"`
+}
+
+type BigQueryEntity struct {
+	Keyword string  `json:"keyword"`
+	Count   int     `json:"count"`
+	Score   float32 `json:"score"`
+}
+
+type BigQueryEmotion struct {
+	Emotion string  `json:"emotion"`
+	Score   float64 `json:"score"`
+}
+
+type BigQueryAspect struct {
+	Aspect    string  `json:"aspect"`
+	Score     float32 `json:"score"`
+	Sentiment string  `json:"sentiment"`
+	Mentions  int     `json:"mentions"`
+}
+
+type BigQueryRedaction struct {
+	Detector string `json:"detector"`
+	Count    int    `json:"count"`
+}
+
+type BigQueryExtra struct {
+	Column string `json:"column"`
+	Value  string `json:"value"`
+}
+
+// BigQueryPostRow is an analyzed post as a row of a BigQuery table
+type BigQueryPostRow struct {
+	ID              string            `json:"id" bigquery:"required"`
+	CreatedAt       *time.Time        `json:"created_at,omitempty"`
+	Score           float32           `json:"score"`
+	Sentiment       string            `json:"sentiment"`
+	Entities        []BigQueryEntity  `json:"entities"`
+	DominantEmotion string            `json:"dominant_emotion,omitempty"`
+	Emotions        []BigQueryEmotion `json:"emotions"`
+	SignalScore     *float32          `json:"signal_score,omitempty"`
+	RawScore        *float32          `json:"raw_score,omitempty"`
+	Sarcasm         *bool             `json:"sarcasm,omitempty"`
+	Shouting        *bool             `json:"shouting,omitempty"`
+	ClusterID       *int              `json:"cluster_id,omitempty"`
+	ClusterLabel    string            `json:"cluster_label,omitempty"`
+}
+
+// BigQueryCustomerRow is an analyzed customer comment as a row of a BigQuery table,
+// Timestamp is left null when the timestamp of the comment is in an unknown format
+type BigQueryCustomerRow struct {
+	Key             string              `json:"key" bigquery:"required"`
+	Timestamp       *time.Time          `json:"timestamp,omitempty"`
+	RawTimestamp    string              `json:"raw_timestamp"`
+	Email           string              `json:"email,omitempty"`
+	Comment         string              `json:"comment"`
+	Rating          *float64            `json:"rating,omitempty"`
+	Score           float32             `json:"score"`
+	Sentiment       string              `json:"sentiment"`
+	Entities        []BigQueryEntity    `json:"entities"`
+	Aspects         []BigQueryAspect    `json:"aspects"`
+	DominantEmotion string              `json:"dominant_emotion,omitempty"`
+	Emotions        []BigQueryEmotion   `json:"emotions"`
+	Redactions      []BigQueryRedaction `json:"redactions"`
+	Extra           []BigQueryExtra     `json:"extra"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// bigQueryType maps a go type to a BigQuery type, pointers are nullable columns of the type they point to
+func bigQueryType(t reflect.Type) (string, []BigQueryField) {
+	if t == timeType {
+		return "TIMESTAMP", nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "STRING", nil
+	case reflect.Bool:
+		return "BOOLEAN", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "INTEGER", nil
+	case reflect.Float32, reflect.Float64:
+		return "FLOAT", nil
+	case reflect.Struct:
+		return "RECORD", bigQueryFields(t)
+	}
+
+	panic(fmt.Sprintf("no BigQuery type for %s", t))
+}
+
+func bigQueryFields(t reflect.Type) []BigQueryField {
+	fields := make([]BigQueryField, 0)
+
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		name := strings.Split(structField.Tag.Get("json"), ",")[0]
+
+		if name == "-" || structField.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = structField.Name
+		}
+
+		field := BigQueryField{Name: name, Mode: "NULLABLE"}
+		fieldType := structField.Type
+
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		} else if fieldType.Kind() == reflect.Slice {
+			field.Mode = "REPEATED"
+			fieldType = fieldType.Elem()
+		}
+
+		if structField.Tag.Get("bigquery") == "required" {
+			field.Mode = "REQUIRED"
+		}
+
+		field.Type, field.Fields = bigQueryType(fieldType)
+
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// BigQuerySchema generates the schema of a row struct such as BigQueryPostRow from its json tags
+func BigQuerySchema(row interface{}) []BigQueryField {
+	return bigQueryFields(reflect.Indirect(reflect.ValueOf(row)).Type())
+}
+
+func bigQueryEntities(entities []EntityWrapper) []BigQueryEntity {
+	rows := make([]BigQueryEntity, 0)
+
+	for _, entity := range entities {
+		rows = append(rows, BigQueryEntity{Keyword: entity.Keyword, Count: entity.Count, Score: entity.Score})
+	}
+
+	return rows
+}
+
+func bigQueryEmotions(emotion *EmotionScores) (string, []BigQueryEmotion) {
+	rows := make([]BigQueryEmotion, 0)
+
+	if emotion == nil {
+		return "", rows
+	}
+
+	for _, name := range Emotions {
+		if score, ok := emotion.Scores[name]; ok {
+			rows = append(rows, BigQueryEmotion{Emotion: string(name), Score: score})
+		}
+	}
+
+	return string(emotion.Dominant), rows
+}
+
+// BigQueryPostRows turns analyzed posts into rows, the creation time is taken from the original posts when given
+func BigQueryPostRows(posts []AnalysisWrapper, originals []RedditPost) []BigQueryPostRow {
+	createdAt := make(map[string]time.Time)
+
+	for _, record := range PostRecords(originals) {
+		if !record.Time.IsZero() {
+			createdAt[record.ID] = record.Time
+		}
+	}
+
+	rows := make([]BigQueryPostRow, 0)
+
+	for i := 0; i < len(posts); i++ {
+		post := posts[i]
+
+		row := BigQueryPostRow{
+			ID:        post.ID,
+			Score:     post.Sentiment.Score,
+			Sentiment: post.Sentiment.ParsedSentiment,
+			Entities:  bigQueryEntities(post.Entity),
+		}
+
+		if created, ok := createdAt[post.ID]; ok {
+			row.CreatedAt = &created
+		}
+
+		row.DominantEmotion, row.Emotions = bigQueryEmotions(post.Emotion)
+
+		if post.Signals != nil {
+			row.SignalScore = &post.Signals.Score
+			row.RawScore = post.Signals.RawScore
+			row.Sarcasm = &post.Signals.Sarcasm
+			row.Shouting = &post.Signals.Shouting
+		}
+
+		if post.Cluster != nil {
+			row.ClusterID = &post.Cluster.ID
+			row.ClusterLabel = post.Cluster.Label
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// BigQueryCustomerRows turns analyzed customer comments into rows, keyed by CustomerKey
+func BigQueryCustomerRows(comments []CustomerAnalysis) []BigQueryCustomerRow {
+	rows := make([]BigQueryCustomerRow, 0)
+
+	for i := 0; i < len(comments); i++ {
+		comment := comments[i]
+
+		row := BigQueryCustomerRow{
+			Key:          CustomerKey(comment),
+			RawTimestamp: comment.Timestamp,
+			Email:        comment.Email,
+			Comment:      comment.Comment,
+			Rating:       comment.Rating,
+			Score:        comment.Sentiment.Score,
+			Sentiment:    comment.Sentiment.ParsedSentiment,
+			Entities:     bigQueryEntities(comment.Entity),
+			Aspects:      make([]BigQueryAspect, 0),
+			Redactions:   make([]BigQueryRedaction, 0),
+			Extra:        make([]BigQueryExtra, 0),
+		}
+
+		if timestamp, err := ParseTimestamp(comment.Timestamp); err == nil {
+			row.Timestamp = &timestamp
+		}
+
+		row.DominantEmotion, row.Emotions = bigQueryEmotions(comment.Emotion)
+
+		for _, aspect := range comment.Aspects {
+			row.Aspects = append(row.Aspects, BigQueryAspect{
+				Aspect:    aspect.Aspect,
+				Score:     aspect.Score,
+				Sentiment: aspect.ParsedSentiment,
+				Mentions:  aspect.Mentions,
+			})
+		}
+
+		for _, redaction := range comment.Redactions {
+			row.Redactions = append(row.Redactions, BigQueryRedaction{Detector: redaction.Detector, Count: redaction.Count})
+		}
+
+		for column, value := range comment.Extra {
+			row.Extra = append(row.Extra, BigQueryExtra{Column: column, Value: value})
+		}
+
+		sort.Slice(row.Extra, func(i, j int) bool {
+			return row.Extra[i].Column < row.Extra[j].Column
+		})
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// WriteNDJSON writes each element of the slice rows as a line of json
+func WriteNDJSON(w io.Writer, rows interface{}) error {
+	value := reflect.ValueOf(rows)
+
+	if value.Kind() != reflect.Slice {
+		return fmt.Errorf("rows must be a slice, not %s", value.Kind())
+	}
+
+	encoder := json.NewEncoder(w)
+
+	for i := 0; i < value.Len(); i++ {
+		if err := encoder.Encode(value.Index(i).Interface()); err != nil {
+			return fmt.Errorf("writing row %d failed: %v", i, err)
+		}
+	}
+
+	return nil
+}
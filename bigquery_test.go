@@ -0,0 +1,142 @@
+package sentiment
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestBigQuerySchema(t *testing.T) {
+	type nested struct {
+		Name string `json:"name"`
+	}
+
+	type row struct {
+		ID       string     `json:"id" bigquery:"required"`
+		Count    int        `json:"count"`
+		Score    float32    `json:"score"`
+		Flag     *bool      `json:"flag,omitempty"`
+		At       *time.Time `json:"at,omitempty"`
+		Tags     []string   `json:"tags"`
+		Children []nested   `json:"children"`
+		Skipped  string     `json:"-"`
+		hidden   string
+	}
+
+	tests := []struct {
+		name       string
+		wantType   string
+		wantMode   string
+		wantFields int
+	}{
+		{name: "id", wantType: "STRING", wantMode: "REQUIRED"},
+		{name: "count", wantType: "INTEGER", wantMode: "NULLABLE"},
+		{name: "score", wantType: "FLOAT", wantMode: "NULLABLE"},
+		{name: "flag", wantType: "BOOLEAN", wantMode: "NULLABLE"},
+		{name: "at", wantType: "TIMESTAMP", wantMode: "NULLABLE"},
+		{name: "tags", wantType: "STRING", wantMode: "REPEATED"},
+		{name: "children", wantType: "RECORD", wantMode: "REPEATED", wantFields: 1},
+	}
+
+	schema := BigQuerySchema(row{hidden: "unused"})
+
+	if len(schema) != len(tests) {
+		t.Fatalf("got schema %+v, want %d fields", schema, len(tests))
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			field := schema[i]
+
+			if field.Name != test.name || field.Type != test.wantType || field.Mode != test.wantMode || len(field.Fields) != test.wantFields {
+				t.Errorf("got field %+v, want %s %s %s with %d fields", field, test.name, test.wantType, test.wantMode, test.wantFields)
+			}
+		})
+	}
+}
+
+// schemaNames are the names of the fields of the schema
+func schemaNames(schema []BigQueryField) map[string]bool {
+	names := make(map[string]bool)
+
+	for _, field := range schema {
+		names[field.Name] = true
+	}
+
+	return names
+}
+
+func TestBigQueryRowsMatchTheirSchema(t *testing.T) {
+	rating := 4.0
+	signalScore := float32(0.3)
+
+	tests := []struct {
+		name string
+		row  interface{}
+		rows interface{}
+	}{
+		{
+			name: "posts",
+			row:  BigQueryPostRow{},
+			rows: BigQueryPostRows([]AnalysisWrapper{{
+				ID:        "a",
+				Sentiment: SentimentWrapper{Score: 0.5, ParsedSentiment: "positive"},
+				Entity:    []EntityWrapper{{Keyword: "pizza", Count: 1, Score: 0.5}},
+				Emotion:   &EmotionScores{Scores: map[Emotion]float64{Joy: 1}, Dominant: Joy},
+				Signals:   &TextSignals{Score: signalScore, Sarcasm: true, RawScore: &signalScore},
+				Cluster:   &ClusterAssignment{ID: 1, Label: "pizza"},
+			}}, []RedditPost{{ID: "a", CreatedAt: 1609459200}}),
+		},
+		{
+			name: "customer comments",
+			row:  BigQueryCustomerRow{},
+			rows: BigQueryCustomerRows([]CustomerAnalysis{{
+				Timestamp:  "2021-01-01 10:00:00",
+				Email:      "a@example.com",
+				Comment:    "great pizza",
+				Rating:     &rating,
+				Sentiment:  SentimentWrapper{Score: 0.5, ParsedSentiment: "positive"},
+				Entity:     []EntityWrapper{{Keyword: "pizza", Count: 1, Score: 0.5}},
+				Aspects:    []AspectSentiment{{Aspect: "product", Score: 0.5, ParsedSentiment: "positive", Mentions: 1}},
+				Emotion:    &EmotionScores{Scores: map[Emotion]float64{Joy: 1}, Dominant: Joy},
+				Redactions: []Redaction{{Detector: "email", Count: 1}},
+				Extra:      map[string]string{"store": "Paris"},
+			}}),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			names := schemaNames(BigQuerySchema(test.row))
+
+			var output bytes.Buffer
+
+			if err := WriteNDJSON(&output, test.rows); err != nil {
+				t.Fatalf("writing failed: %v", err)
+			}
+
+			var row map[string]interface{}
+
+			if err := json.Unmarshal(output.Bytes(), &row); err != nil {
+				t.Fatalf("parsing the row failed: %v", err)
+			}
+
+			for column := range row {
+				if !names[column] {
+					t.Errorf("column %s of the row is not in the schema", column)
+				}
+			}
+
+			if len(row) != len(names) {
+				t.Errorf("the row has %d of the %d columns of the schema", len(row), len(names))
+			}
+		})
+	}
+}
+
+func TestWriteNDJSONRejectsNonSlices(t *testing.T) {
+	if err := WriteNDJSON(&bytes.Buffer{}, BigQueryPostRow{}); err == nil {
+		t.Errorf("writing a single row did not fail")
+	}
+}
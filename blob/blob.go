@@ -0,0 +1,60 @@
+// Package blob stores the files of the server by name, in a Google Cloud Storage bucket or in a local directory
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotExist is wrapped in the error of reading or deleting a blob that does not exist, check it with errors.Is
+var ErrNotExist = errors.New("blob does not exist")
+
+// ErrChanged is wrapped in the error of closing a conditional writer when the blob is no longer at the
+// generation it was read at, check it with errors.Is
+var ErrChanged = errors.New("blob changed since it was read")
+
+// Generation is a version of a blob, every write of the blob gives it a new one
+type Generation int64
+
+// NoGeneration is the generation of a blob that does not exist
+const NoGeneration Generation = 0
+
+// Store holds blobs by slash separated names such as reddit/posts.json
+type Store interface {
+	// NewReader opens the blob name for reading
+	NewReader(ctx context.Context, name string) (io.ReadCloser, error)
+
+	// NewGenerationReader opens the blob name for reading along with the generation it reads
+	NewGenerationReader(ctx context.Context, name string) (io.ReadCloser, Generation, error)
+
+	// NewWriter creates or replaces the blob name, it is only written once the writer is closed
+	NewWriter(ctx context.Context, name string) (Writer, error)
+
+	// NewConditionalWriter is NewWriter that only replaces the blob while it is still at generation, NoGeneration
+	// only creates it, Close fails with ErrChanged when another write came first
+	NewConditionalWriter(ctx context.Context, name string, generation Generation) (Writer, error)
+
+	// List returns the sorted names of the blobs starting with prefix
+	List(ctx context.Context, prefix string) ([]string, error)
+
+	// Exists checks if the blob name exists
+	Exists(ctx context.Context, name string) (bool, error)
+
+	// Delete removes the blob name
+	Delete(ctx context.Context, name string) error
+
+	// Close releases the store
+	Close() error
+}
+
+// Writer writes a blob, Close commits it and its error must be checked, the blob is not written when it fails
+type Writer interface {
+	io.WriteCloser
+
+	// Discard drops what was written instead of committing it, the blob keeps what it held before
+	Discard()
+
+	// Generation is the generation of the blob written, once Close succeeded
+	Generation() Generation
+}
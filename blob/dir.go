@@ -0,0 +1,337 @@
+package blob
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DirStore keeps the blobs as files below a local directory, for development and tests
+type DirStore struct {
+	root string
+}
+
+// NewDirStore stores the blobs below root, which is created when missing
+func NewDirStore(root string) (*DirStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("creating \"%s\" failed: %v", root, err)
+	}
+
+	return &DirStore{root: root}, nil
+}
+
+// path maps a blob name to its file, names may not leave the root
+func (store *DirStore) path(name string) (string, error) {
+	cleaned := path.Clean("/" + name)
+
+	if name == "" || cleaned == "/" || cleaned != "/"+strings.TrimPrefix(name, "/") {
+		return "", fmt.Errorf("invalid blob name \"%s\"", name)
+	}
+
+	return filepath.Join(store.root, filepath.FromSlash(cleaned)), nil
+}
+
+func (store *DirStore) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	filename, err := store.path(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filename)
+
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotExist, name)
+	}
+
+	return file, err
+}
+
+func (store *DirStore) NewGenerationReader(ctx context.Context, name string) (io.ReadCloser, Generation, error) {
+	reader, err := store.NewReader(ctx, name)
+
+	if err != nil {
+		return nil, NoGeneration, err
+	}
+
+	// the file is never written in place, so the open file stays at its generation
+	info, err := reader.(*os.File).Stat()
+
+	if err != nil {
+		reader.Close()
+
+		return nil, NoGeneration, err
+	}
+
+	return reader, Generation(info.ModTime().UnixNano()), nil
+}
+
+// staleLockAge is when a lock is left behind by a process that died while holding it
+const staleLockAge = 30 * time.Second
+
+// lock keeps the other writers of filename, in this or another process, out until it is unlocked
+// the lock is created exclusively next to the file, it waits for the lock while ctx is not done
+func lock(ctx context.Context, filename string) (func(), error) {
+	lockFilename := filepath.Join(filepath.Dir(filename), "."+filepath.Base(filename)+".lock")
+
+	for {
+		lockFile, err := os.OpenFile(lockFilename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+
+		if err == nil {
+			lockFile.Close()
+
+			return func() { os.Remove(lockFilename) }, nil
+		}
+
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(lockFilename); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(lockFilename)
+
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// fileGeneration is the modification time of the file, Close makes it grow on every write
+func fileGeneration(filename string) (Generation, error) {
+	info, err := os.Stat(filename)
+
+	if os.IsNotExist(err) {
+		return NoGeneration, nil
+	}
+
+	if err != nil {
+		return NoGeneration, err
+	}
+
+	return Generation(info.ModTime().UnixNano()), nil
+}
+
+// dirWriter writes to a temporary file that replaces the blob on Close, so readers never see half a blob
+type dirWriter struct {
+	*os.File
+	ctx      context.Context
+	name     string
+	filename string
+
+	// a conditional writer only replaces the blob at generation
+	conditional bool
+	generation  Generation
+	written     Generation
+}
+
+func (writer *dirWriter) Close() error {
+	if err := writer.File.Close(); err != nil {
+		os.Remove(writer.File.Name())
+
+		return err
+	}
+
+	if err := writer.commit(); err != nil {
+		os.Remove(writer.File.Name())
+
+		return err
+	}
+
+	return nil
+}
+
+// commit renames the temporary file over the blob while no other writer commits
+func (writer *dirWriter) commit() error {
+	unlock, err := lock(writer.ctx, writer.filename)
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	current, err := fileGeneration(writer.filename)
+
+	if err != nil {
+		return err
+	}
+
+	if writer.conditional && current != writer.generation {
+		return fmt.Errorf("%w: %s", ErrChanged, writer.name)
+	}
+
+	// the generation must grow even when the clock did not move since the last write
+	modified := time.Now()
+
+	if modified.UnixNano() <= int64(current) {
+		modified = time.Unix(0, int64(current)).Add(time.Millisecond)
+	}
+
+	if err := os.Chtimes(writer.File.Name(), modified, modified); err != nil {
+		return err
+	}
+
+	written, err := fileGeneration(writer.File.Name())
+
+	if err != nil {
+		return err
+	}
+
+	if written <= current {
+		return fmt.Errorf("the modification time of \"%s\" cannot tell its generations apart", writer.name)
+	}
+
+	if err := os.Rename(writer.File.Name(), writer.filename); err != nil {
+		return err
+	}
+
+	writer.written = written
+
+	return nil
+}
+
+func (writer *dirWriter) Discard() {
+	writer.File.Close()
+	os.Remove(writer.File.Name())
+}
+
+func (writer *dirWriter) Generation() Generation {
+	return writer.written
+}
+
+func (store *DirStore) newWriter(ctx context.Context, name string) (*dirWriter, error) {
+	filename, err := store.path(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, err
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &dirWriter{File: file, ctx: ctx, name: name, filename: filename}, nil
+}
+
+func (store *DirStore) NewWriter(ctx context.Context, name string) (Writer, error) {
+	return store.newWriter(ctx, name)
+}
+
+func (store *DirStore) NewConditionalWriter(ctx context.Context, name string, generation Generation) (Writer, error) {
+	writer, err := store.newWriter(ctx, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	writer.conditional = true
+	writer.generation = generation
+
+	return writer, nil
+}
+
+func (store *DirStore) List(ctx context.Context, prefix string) ([]string, error) {
+	names := make([]string, 0)
+
+	err := filepath.Walk(store.root, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// skip directories and the temporary files of unfinished writes
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+
+		relative, err := filepath.Rel(store.root, filename)
+
+		if err != nil {
+			return err
+		}
+
+		if name := filepath.ToSlash(relative); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return names, fmt.Errorf("listing \"%s\" failed: %v", prefix, err)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (store *DirStore) Exists(ctx context.Context, name string) (bool, error) {
+	filename, err := store.path(name)
+
+	if err != nil {
+		return false, err
+	}
+
+	info, err := os.Stat(filename)
+
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return !info.IsDir(), nil
+}
+
+func (store *DirStore) Delete(ctx context.Context, name string) error {
+	filename, err := store.path(name)
+
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lock(ctx, filename)
+
+	// the folder of the blob does not exist either
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrNotExist, name)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	err = os.Remove(filename)
+
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrNotExist, name)
+	}
+
+	return err
+}
+
+func (store *DirStore) Close() error {
+	return nil
+}
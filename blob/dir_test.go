@@ -0,0 +1,194 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+// writeBlob writes content over generation and returns the generation it saved
+func writeBlob(store Store, name string, generation Generation, content string) (Generation, error) {
+	writer, err := store.NewConditionalWriter(context.Background(), name, generation)
+
+	if err != nil {
+		return NoGeneration, err
+	}
+
+	if _, err := writer.Write([]byte(content)); err != nil {
+		writer.Discard()
+
+		return NoGeneration, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return NoGeneration, err
+	}
+
+	return writer.Generation(), nil
+}
+
+// readBlob reads a blob and the generation it was read at
+func readBlob(t *testing.T, store Store, name string) (string, Generation) {
+	t.Helper()
+
+	reader, generation, err := store.NewGenerationReader(context.Background(), name)
+
+	if err != nil {
+		t.Fatalf("reading \"%s\" failed: %v", name, err)
+	}
+
+	defer reader.Close()
+
+	content, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+		t.Fatalf("reading \"%s\" failed: %v", name, err)
+	}
+
+	return string(content), generation
+}
+
+func TestDirStoreConditionalWriter(t *testing.T) {
+	tests := []struct {
+		name        string
+		existing    bool
+		stale       bool
+		generation  func(current Generation) Generation
+		wantErr     error
+		wantContent string
+	}{
+		{
+			name:        "creates a missing blob",
+			generation:  func(current Generation) Generation { return NoGeneration },
+			wantContent: "new",
+		},
+		{
+			name:        "does not create an existing blob",
+			existing:    true,
+			generation:  func(current Generation) Generation { return NoGeneration },
+			wantErr:     ErrChanged,
+			wantContent: "old",
+		},
+		{
+			name:        "writes over the generation it read",
+			existing:    true,
+			generation:  func(current Generation) Generation { return current },
+			wantContent: "new",
+		},
+		{
+			name:        "does not write over a newer generation",
+			existing:    true,
+			stale:       true,
+			generation:  func(current Generation) Generation { return current },
+			wantErr:     ErrChanged,
+			wantContent: "newer",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, err := NewDirStore(t.TempDir())
+
+			if err != nil {
+				t.Fatalf("creating store failed: %v", err)
+			}
+
+			current := NoGeneration
+
+			if test.existing {
+				if current, err = writeBlob(store, "jobs/a.json", NoGeneration, "old"); err != nil {
+					t.Fatalf("writing the existing blob failed: %v", err)
+				}
+			}
+
+			readGeneration := current
+
+			if test.stale {
+				if _, err := writeBlob(store, "jobs/a.json", current, "newer"); err != nil {
+					t.Fatalf("writing the newer blob failed: %v", err)
+				}
+			}
+
+			generation, err := writeBlob(store, "jobs/a.json", test.generation(readGeneration), "new")
+
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+
+			content, saved := readBlob(t, store, "jobs/a.json")
+
+			if content != test.wantContent {
+				t.Errorf("got \"%s\", want \"%s\"", content, test.wantContent)
+			}
+
+			if err == nil && generation != saved {
+				t.Errorf("writer reported generation %d, the blob has %d", generation, saved)
+			}
+		})
+	}
+}
+
+func TestDirStoreConcurrentCreate(t *testing.T) {
+	store, err := NewDirStore(t.TempDir())
+
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	created := 0
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := writeBlob(store, "messages/m", NoGeneration, "claimed")
+
+			if err != nil && !errors.Is(err, ErrChanged) {
+				t.Errorf("writing failed: %v", err)
+			}
+
+			if err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if created != 1 {
+		t.Errorf("%d writers created the blob, want 1", created)
+	}
+}
+
+func TestDirStoreDelete(t *testing.T) {
+	store, err := NewDirStore(t.TempDir())
+
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+
+	if err := store.Delete(context.Background(), "jobs/missing.json"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("deleting a missing blob: got %v, want %v", err, ErrNotExist)
+	}
+
+	if _, err := writeBlob(store, "jobs/a.json", NoGeneration, "a"); err != nil {
+		t.Fatalf("writing failed: %v", err)
+	}
+
+	if err := store.Delete(context.Background(), "jobs/a.json"); err != nil {
+		t.Fatalf("deleting failed: %v", err)
+	}
+
+	if exists, err := store.Exists(context.Background(), "jobs/a.json"); err != nil || exists {
+		t.Errorf("got exists %v and error %v after deleting", exists, err)
+	}
+}
@@ -0,0 +1,162 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+)
+
+// GCSStore keeps the blobs as objects of a Google Cloud Storage bucket
+type GCSStore struct {
+	client *storage.Client
+	bucket *storage.BucketHandle
+}
+
+// NewGCSStore stores the blobs in bucket, closing the store closes the client
+func NewGCSStore(client *storage.Client, bucket string) *GCSStore {
+	return &GCSStore{
+		client: client,
+		bucket: client.Bucket(bucket),
+	}
+}
+
+func (store *GCSStore) NewReader(ctx context.Context, name string) (io.ReadCloser, error) {
+	reader, err := store.bucket.Object(name).NewReader(ctx)
+
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotExist, name)
+	}
+
+	return reader, err
+}
+
+func (store *GCSStore) NewGenerationReader(ctx context.Context, name string) (io.ReadCloser, Generation, error) {
+	reader, err := store.bucket.Object(name).NewReader(ctx)
+
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, NoGeneration, fmt.Errorf("%w: %s", ErrNotExist, name)
+	}
+
+	if err != nil {
+		return nil, NoGeneration, err
+	}
+
+	return reader, Generation(reader.Attrs.Generation), nil
+}
+
+// gcsWriter uploads an object, cancelling its context stops the upload without creating the object
+type gcsWriter struct {
+	writer *storage.Writer
+	cancel context.CancelFunc
+	name   string
+}
+
+func (writer *gcsWriter) Write(p []byte) (int, error) {
+	return writer.writer.Write(p)
+}
+
+func (writer *gcsWriter) Close() error {
+	defer writer.cancel()
+
+	err := writer.writer.Close()
+
+	var apiErr *googleapi.Error
+
+	// a precondition of a conditional writer failed
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+		return fmt.Errorf("%w: %s", ErrChanged, writer.name)
+	}
+
+	return err
+}
+
+func (writer *gcsWriter) Discard() {
+	writer.cancel()
+	writer.writer.Close()
+}
+
+func (writer *gcsWriter) Generation() Generation {
+	if attrs := writer.writer.Attrs(); attrs != nil {
+		return Generation(attrs.Generation)
+	}
+
+	return NoGeneration
+}
+
+func (store *GCSStore) newWriter(ctx context.Context, name string, object *storage.ObjectHandle) *gcsWriter {
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &gcsWriter{
+		writer: object.NewWriter(ctx),
+		cancel: cancel,
+		name:   name,
+	}
+}
+
+func (store *GCSStore) NewWriter(ctx context.Context, name string) (Writer, error) {
+	return store.newWriter(ctx, name, store.bucket.Object(name)), nil
+}
+
+func (store *GCSStore) NewConditionalWriter(ctx context.Context, name string, generation Generation) (Writer, error) {
+	conditions := storage.Conditions{GenerationMatch: int64(generation)}
+
+	if generation == NoGeneration {
+		conditions = storage.Conditions{DoesNotExist: true}
+	}
+
+	return store.newWriter(ctx, name, store.bucket.Object(name).If(conditions)), nil
+}
+
+func (store *GCSStore) List(ctx context.Context, prefix string) ([]string, error) {
+	names := make([]string, 0)
+	objects := store.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+
+	for {
+		attrs, err := objects.Next()
+
+		if err == iterator.Done {
+			break
+		}
+
+		if err != nil {
+			return names, fmt.Errorf("listing \"%s\" failed: %v", prefix, err)
+		}
+
+		names = append(names, attrs.Name)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (store *GCSStore) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := store.bucket.Object(name).Attrs(ctx)
+
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (store *GCSStore) Delete(ctx context.Context, name string) error {
+	err := store.bucket.Object(name).Delete(ctx)
+
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotExist, name)
+	}
+
+	return err
+}
+
+func (store *GCSStore) Close() error {
+	return store.client.Close()
+}
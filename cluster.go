@@ -0,0 +1,395 @@
+package sentiment
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// stopwords are too common to tell topics apart
+var stopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "but": true, "not": true, "you": true, "all": true,
+	"any": true, "can": true, "had": true, "her": true, "was": true, "one": true, "our": true, "out": true,
+	"has": true, "have": true, "him": true, "his": true, "how": true, "its": true, "let": true, "may": true,
+	"who": true, "did": true, "get": true, "got": true, "she": true, "too": true, "use": true, "that": true,
+	"this": true, "with": true, "from": true, "they": true, "them": true, "then": true, "than": true,
+	"there": true, "their": true, "what": true, "when": true, "where": true, "which": true, "while": true,
+	"will": true, "would": true, "could": true, "should": true, "about": true, "been": true, "being": true,
+	"into": true, "just": true, "like": true, "more": true, "most": true, "some": true, "such": true,
+	"only": true, "other": true, "also": true, "very": true, "your": true, "yours": true, "were": true,
+	"because": true, "does": true, "doing": true, "here": true, "over": true, "after": true, "before": true,
+	"these": true, "those": true, "each": true, "even": true, "much": true, "many": true, "well": true,
+	"know": true, "think": true, "really": true, "make": true, "want": true, "need": true, "don't": true,
+	"i'm": true, "it's": true, "can't": true, "didn't": true, "doesn't": true, "i've": true, "anyone": true,
+	"http": true, "https": true, "www": true, "com": true,
+}
+
+// ClusterOptions configure ClusterPosts, zero values use the defaults
+type ClusterOptions struct {
+	// K is the amount of clusters, by default about the square root of half the posts
+	K int `json:"k"`
+
+	// Seed makes the clustering repeatable
+	Seed int64 `json:"seed"`
+
+	// MaxIterations stops k-means when it does not settle, 50 by default
+	MaxIterations int `json:"maxIterations"`
+
+	// TopTerms is the amount of terms describing a cluster, 5 by default
+	TopTerms int `json:"topTerms"`
+}
+
+// ClusterAssignment is the cluster a post belongs to
+type ClusterAssignment struct {
+	ID    int    `json:"id"`
+	Label string `json:"label"`
+}
+
+// Cluster is a theme found among the posts
+type Cluster struct {
+	ID        int            `json:"id"`
+	Label     string         `json:"label"`
+	TopTerms  []string       `json:"topTerms"`
+	Size      int            `json:"size"`
+	MeanScore float64        `json:"meanScore"`
+	Labels    map[string]int `json:"labels"`
+	PostIDs   []string       `json:"postIds"`
+}
+
+// sparseVector maps a term index to its weight
+type sparseVector map[int]float64
+
+func (vector sparseVector) dot(other sparseVector) float64 {
+	if len(other) < len(vector) {
+		vector, other = other, vector
+	}
+
+	sum := 0.0
+
+	for term, weight := range vector {
+		sum += weight * other[term]
+	}
+
+	return sum
+}
+
+func (vector sparseVector) normalize() sparseVector {
+	norm := math.Sqrt(vector.dot(vector))
+
+	if norm == 0 {
+		return vector
+	}
+
+	for term := range vector {
+		vector[term] /= norm
+	}
+
+	return vector
+}
+
+func clusterTerms(text string) []string {
+	terms := make([]string, 0)
+
+	for _, word := range tokenize(text) {
+		word = strings.Trim(word, "'")
+
+		if len(word) < 3 || stopwords[word] {
+			continue
+		}
+
+		terms = append(terms, word)
+	}
+
+	return terms
+}
+
+// vectorize builds the l2 normalized tf-idf vector of each document, terms in a single document
+// or in more than half of the documents do not describe a theme and are left out
+func vectorize(documents []string) ([]sparseVector, []string) {
+	documentTerms := make([][]string, 0)
+	documentFrequency := make(map[string]int)
+
+	for _, document := range documents {
+		terms := clusterTerms(document)
+		seen := make(map[string]bool)
+
+		for _, term := range terms {
+			if !seen[term] {
+				seen[term] = true
+				documentFrequency[term]++
+			}
+		}
+
+		documentTerms = append(documentTerms, terms)
+	}
+
+	vocabulary := make([]string, 0)
+
+	for term, frequency := range documentFrequency {
+		if frequency >= 2 && (len(documents) < 4 || float64(frequency) <= float64(len(documents))/2) {
+			vocabulary = append(vocabulary, term)
+		}
+	}
+
+	sort.Strings(vocabulary)
+
+	termIndexes := make(map[string]int)
+
+	for i, term := range vocabulary {
+		termIndexes[term] = i
+	}
+
+	vectors := make([]sparseVector, 0)
+
+	for _, terms := range documentTerms {
+		vector := make(sparseVector)
+
+		for _, term := range terms {
+			if index, ok := termIndexes[term]; ok {
+				vector[index]++
+			}
+		}
+
+		for index, count := range vector {
+			idf := math.Log(float64(len(documents))/float64(documentFrequency[vocabulary[index]])) + 1
+
+			vector[index] = (1 + math.Log(count)) * idf
+		}
+
+		vectors = append(vectors, vector.normalize())
+	}
+
+	return vectors, vocabulary
+}
+
+// initialCentroids picks the centroids with k-means++, each next centroid is likely far from the picked ones
+func initialCentroids(vectors []sparseVector, k int, random *rand.Rand) []sparseVector {
+	centroids := []sparseVector{copyVector(vectors[random.Intn(len(vectors))])}
+
+	for len(centroids) < k {
+		distances := make([]float64, len(vectors))
+		total := 0.0
+
+		for i, vector := range vectors {
+			closest := math.Inf(1)
+
+			for _, centroid := range centroids {
+				closest = math.Min(closest, 1-vector.dot(centroid))
+			}
+
+			distances[i] = closest * closest
+			total += distances[i]
+		}
+
+		// every post is already a centroid
+		if total == 0 {
+			break
+		}
+
+		target := random.Float64() * total
+
+		for i, distance := range distances {
+			target -= distance
+
+			if target <= 0 {
+				centroids = append(centroids, copyVector(vectors[i]))
+
+				break
+			}
+		}
+	}
+
+	return centroids
+}
+
+func copyVector(vector sparseVector) sparseVector {
+	copied := make(sparseVector)
+
+	for term, weight := range vector {
+		copied[term] = weight
+	}
+
+	return copied
+}
+
+// kMeans runs spherical k-means, the cosine similarity of normalized vectors is their dot product
+func kMeans(vectors []sparseVector, k int, maxIterations int, random *rand.Rand) ([]int, []sparseVector) {
+	centroids := initialCentroids(vectors, k, random)
+	assignments := make([]int, len(vectors))
+
+	for iteration := 0; iteration < maxIterations; iteration++ {
+		changed := false
+
+		for i, vector := range vectors {
+			best := 0
+			bestSimilarity := math.Inf(-1)
+
+			for c, centroid := range centroids {
+				if similarity := vector.dot(centroid); similarity > bestSimilarity {
+					best = c
+					bestSimilarity = similarity
+				}
+			}
+
+			if assignments[i] != best {
+				changed = true
+				assignments[i] = best
+			}
+		}
+
+		if !changed && iteration > 0 {
+			break
+		}
+
+		sums := make([]sparseVector, len(centroids))
+
+		for c := range sums {
+			sums[c] = make(sparseVector)
+		}
+
+		for i, vector := range vectors {
+			for term, weight := range vector {
+				sums[assignments[i]][term] += weight
+			}
+		}
+
+		for c := range centroids {
+			// an empty cluster keeps its centroid
+			if len(sums[c]) > 0 {
+				centroids[c] = sums[c].normalize()
+			}
+		}
+	}
+
+	return assignments, centroids
+}
+
+func topTerms(centroid sparseVector, vocabulary []string, count int) []string {
+	indexes := make([]int, 0)
+
+	for index := range centroid {
+		indexes = append(indexes, index)
+	}
+
+	sort.Slice(indexes, func(i, j int) bool {
+		if centroid[indexes[i]] != centroid[indexes[j]] {
+			return centroid[indexes[i]] > centroid[indexes[j]]
+		}
+
+		return indexes[i] < indexes[j]
+	})
+
+	terms := make([]string, 0)
+
+	for i := 0; i < len(indexes) && i < count; i++ {
+		terms = append(terms, vocabulary[indexes[i]])
+	}
+
+	return terms
+}
+
+// ClusterPosts groups the posts into themes by the tf-idf of their title and body with k-means.
+// each post gets its cluster assigned and the clusters are returned largest first
+func ClusterPosts(posts []RedditPost, options ClusterOptions) ([]RedditPost, []Cluster) {
+	clusters := make([]Cluster, 0)
+
+	if len(posts) == 0 {
+		return posts, clusters
+	}
+
+	if options.K <= 0 {
+		options.K = int(math.Max(2, math.Round(math.Sqrt(float64(len(posts))/2))))
+	}
+
+	if options.K > len(posts) {
+		options.K = len(posts)
+	}
+
+	if options.MaxIterations <= 0 {
+		options.MaxIterations = 50
+	}
+
+	if options.TopTerms <= 0 {
+		options.TopTerms = 5
+	}
+
+	documents := make([]string, 0)
+
+	for i := 0; i < len(posts); i++ {
+		documents = append(documents, posts[i].Title+"\n"+posts[i].Body)
+	}
+
+	vectors, vocabulary := vectorize(documents)
+	assignments, centroids := kMeans(vectors, options.K, options.MaxIterations, rand.New(rand.NewSource(options.Seed)))
+
+	clustersByID := make(map[int]*Cluster)
+	scoreSums := make(map[int]float64)
+
+	for i, assignment := range assignments {
+		cluster, ok := clustersByID[assignment]
+
+		if !ok {
+			terms := topTerms(centroids[assignment], vocabulary, options.TopTerms)
+			labelTerms := terms
+
+			if len(labelTerms) > 3 {
+				labelTerms = labelTerms[:3]
+			}
+
+			cluster = &Cluster{
+				TopTerms: terms,
+				Label:    strings.Join(labelTerms, " / "),
+				Labels:   make(map[string]int),
+				PostIDs:  make([]string, 0),
+			}
+
+			// posts sharing no terms with the others end up together
+			if cluster.Label == "" {
+				cluster.Label = "other"
+			}
+
+			clustersByID[assignment] = cluster
+		}
+
+		cluster.Size++
+		cluster.PostIDs = append(cluster.PostIDs, posts[i].ID)
+		cluster.Labels[posts[i].Analysis.Sentiment.ParsedSentiment]++
+		scoreSums[assignment] += float64(posts[i].Analysis.Sentiment.Score)
+	}
+
+	// number the clusters from the largest
+	centroidIDs := make([]int, 0)
+
+	for centroidID := range clustersByID {
+		centroidIDs = append(centroidIDs, centroidID)
+	}
+
+	sort.Slice(centroidIDs, func(i, j int) bool {
+		if clustersByID[centroidIDs[i]].Size != clustersByID[centroidIDs[j]].Size {
+			return clustersByID[centroidIDs[i]].Size > clustersByID[centroidIDs[j]].Size
+		}
+
+		return centroidIDs[i] < centroidIDs[j]
+	})
+
+	clusterIDs := make(map[int]int)
+
+	for id, centroidID := range centroidIDs {
+		cluster := clustersByID[centroidID]
+		cluster.ID = id
+		cluster.MeanScore = scoreSums[centroidID] / float64(cluster.Size)
+
+		clusterIDs[centroidID] = id
+		clusters = append(clusters, *cluster)
+	}
+
+	for i, assignment := range assignments {
+		posts[i].Analysis.Cluster = &ClusterAssignment{
+			ID:    clusterIDs[assignment],
+			Label: clustersByID[assignment].Label,
+		}
+	}
+
+	return posts, clusters
+}
@@ -0,0 +1,120 @@
+package sentiment
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// themedPosts are three posts about pizza and three about delivery
+func themedPosts() []RedditPost {
+	return []RedditPost{
+		{ID: "p1", Title: "pizza night", Body: "the cheese pizza from the oven"},
+		{ID: "d1", Title: "late delivery", Body: "the courier lost my package"},
+		{ID: "p2", Title: "best pizza", Body: "melted cheese and a hot oven"},
+		{ID: "d2", Title: "delivery again", Body: "package left by the courier in the rain"},
+		{ID: "p3", Title: "pizza dough", Body: "oven temperature for cheese"},
+		{ID: "d3", Title: "where is my package", Body: "no courier and no delivery"},
+	}
+}
+
+func TestClusterPosts(t *testing.T) {
+	tests := []struct {
+		name         string
+		posts        []RedditPost
+		options      ClusterOptions
+		wantClusters [][]string
+	}{
+		{
+			name:         "groups the posts by theme",
+			posts:        themedPosts(),
+			options:      ClusterOptions{K: 2, Seed: 1},
+			wantClusters: [][]string{{"d1", "d2", "d3"}, {"p1", "p2", "p3"}},
+		},
+		{
+			name:         "caps the clusters at the amount of posts",
+			posts:        themedPosts()[:1],
+			options:      ClusterOptions{K: 3},
+			wantClusters: [][]string{{"p1"}},
+		},
+		{
+			name:         "returns no clusters without posts",
+			posts:        []RedditPost{},
+			wantClusters: [][]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			posts, clusters := ClusterPosts(test.posts, test.options)
+
+			got := make([]string, 0)
+
+			for _, cluster := range clusters {
+				got = append(got, strings.Join(sortedCopy(cluster.PostIDs), ","))
+			}
+
+			want := make([]string, 0)
+
+			for _, ids := range test.wantClusters {
+				want = append(want, strings.Join(ids, ","))
+			}
+
+			if strings.Join(sortedCopy(got), "|") != strings.Join(sortedCopy(want), "|") {
+				t.Errorf("got clusters %v, want %v", got, want)
+			}
+
+			for i := 0; i < len(posts); i++ {
+				cluster := posts[i].Analysis.Cluster
+
+				if cluster == nil || !contains(clusters[cluster.ID].PostIDs, posts[i].ID) {
+					t.Errorf("post %s was not assigned to its cluster", posts[i].ID)
+				}
+			}
+		})
+	}
+}
+
+func TestClusterPostsLabels(t *testing.T) {
+	_, clusters := ClusterPosts(themedPosts(), ClusterOptions{K: 2, Seed: 1})
+
+	for _, cluster := range clusters {
+		theme := "delivery"
+
+		if strings.HasPrefix(cluster.PostIDs[0], "p") {
+			theme = "pizza"
+		}
+
+		if !contains(cluster.TopTerms, theme) {
+			t.Errorf("cluster of %v has top terms %v, want %s among them", cluster.PostIDs, cluster.TopTerms, theme)
+		}
+	}
+
+	// the same seed clusters the same way
+	_, again := ClusterPosts(themedPosts(), ClusterOptions{K: 2, Seed: 1})
+
+	for i := 0; i < len(clusters); i++ {
+		if clusters[i].Label != again[i].Label {
+			t.Errorf("cluster %d: got label \"%s\" then \"%s\"", i, clusters[i].Label, again[i].Label)
+		}
+	}
+}
+
+func sortedCopy(values []string) []string {
+	sorted := make([]string, len(values))
+	copy(sorted, values)
+
+	sort.Strings(sorted)
+
+	return sorted
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+)
+
+type analyzeOptions struct {
+	input    string
+	analysis string
+	backend  backendOptions
+
+	output       string
+	format       sentiment.OutputFormat
+	entityLayout sentiment.EntityLayout
+	entitiesOut  string
+	schemaOut    string
+
+	columns     string
+	strict      bool
+	emailPolicy sentiment.EmailPolicy
+
+	redaction           string
+	redactionDictionary string
+	redactionNameToken  string
+}
+
+func parseAnalyzeFlags(args []string) (analyzeOptions, string, error) {
+	options := analyzeOptions{}
+
+	flags := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: sentiment analyze [flags] [file]")
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&options.input, "input", "", "reddit or customer, by default customer for .csv files and reddit otherwise")
+	flags.StringVar(&options.analysis, "analysis", "sentiment", "sentiment or entity analysis of reddit posts, customer comments get both")
+	flags.StringVar(&options.backend.backend, "backend", "google", "google, emulator or replay")
+	flags.StringVar(&options.backend.fixture, "fixture", "", "recorded responses for the replay backend")
+	flags.StringVar(&options.backend.emulator, "emulator", "", "address of the emulator backend, LANGUAGE_EMULATOR_HOST by default")
+	flags.StringVar(&options.backend.record, "record", "", "record the responses of the backend to this fixture")
+	flags.StringVar(&options.output, "o", "-", "output file, - for stdout")
+	format := flags.String("format", "ndjson", "ndjson, csv, tsv, bigquery or parquet")
+	entityLayout := flags.String("entities", "columns", "columns or long, how csv and tsv hold the entities")
+	flags.StringVar(&options.entitiesOut, "entities-out", "", "file for the entities table of the long layout")
+	flags.StringVar(&options.schemaOut, "schema", "", "file for the BigQuery schema of the bigquery format")
+	flags.StringVar(&options.columns, "columns", "", "json file mapping the csv columns of customer comments")
+	flags.BoolVar(&options.strict, "strict", false, "fail the whole file on the first malformed customer row instead of skipping it")
+	flags.StringVar(&options.redaction, "redaction", "", "json file of the detectors redacting customer comments, the default detectors otherwise")
+	flags.StringVar(&options.redactionDictionary, "redaction-dictionary", "", "file of names to redact from customer comments, one per line")
+	flags.StringVar(&options.redactionNameToken, "redaction-name-token", "[NAME]", "token replacing the names of the redaction dictionary")
+	emailPolicy := flags.String("email", "keep", "keep, drop or pseudonymize the emails of customers, pseudonymize needs EMAIL_HMAC_KEY")
+
+	if err := flags.Parse(args); err != nil {
+		return options, "", err
+	}
+
+	if flags.NArg() > 1 {
+		return options, "", fmt.Errorf("analyze takes a single file, got %d", flags.NArg())
+	}
+
+	var err error
+
+	if options.format, err = sentiment.ParseOutputFormat(*format); err != nil {
+		return options, "", err
+	}
+
+	if options.entityLayout, err = sentiment.ParseEntityLayout(*entityLayout); err != nil {
+		return options, "", err
+	}
+
+	if options.emailPolicy, err = sentiment.ParseEmailPolicy(*emailPolicy); err != nil {
+		return options, "", err
+	}
+
+	// fail before paying for the analysis
+	if options.emailPolicy == sentiment.EmailPolicyPseudonymize && os.Getenv("EMAIL_HMAC_KEY") == "" {
+		return options, "", fmt.Errorf("-email pseudonymize requires EMAIL_HMAC_KEY to be set")
+	}
+
+	filename := flags.Arg(0)
+
+	if options.input == "" {
+		options.input = "reddit"
+
+		if strings.EqualFold(filepath.Ext(filename), ".csv") {
+			options.input = "customer"
+		}
+	}
+
+	if options.input != "reddit" && options.input != "customer" {
+		return options, "", fmt.Errorf("input must be reddit or customer")
+	}
+
+	if options.analysis != "sentiment" && options.analysis != "entity" {
+		return options, "", fmt.Errorf("analysis must be sentiment or entity")
+	}
+
+	return options, filename, nil
+}
+
+// runAnalyze runs the same analysis as the App Engine server on a local file
+func runAnalyze(args []string) error {
+	options, filename, err := parseAnalyzeFlags(args)
+
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	analyzer, closeAnalyzer, err := newAnalyzer(ctx, options.backend)
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := closeAnalyzer(); err != nil {
+			log.Printf("closing backend failed: %v\n", err)
+		}
+	}()
+
+	input, err := openInput(filename)
+
+	if err != nil {
+		return err
+	}
+
+	defer input.Close()
+
+	output, err := createOutput(options.output)
+
+	if err != nil {
+		return err
+	}
+
+	defer output.Close()
+
+	var entities io.WriteCloser
+
+	if options.entitiesOut != "" {
+		if entities, err = createOutput(options.entitiesOut); err != nil {
+			return err
+		}
+
+		defer entities.Close()
+	}
+
+	usage := sentiment.NewUsage()
+	ctx = sentiment.WithUsage(ctx, usage)
+
+	if options.input == "customer" {
+		err = analyzeCustomerFile(ctx, analyzer, input, output, entities, options)
+	} else {
+		err = analyzeRedditFile(ctx, analyzer, input, output, entities, options)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	log.Print(usage.String())
+
+	return nil
+}
+
+func analyzeRedditFile(ctx context.Context, analyzer sentiment.Analyzer, input io.Reader, output io.Writer, entities io.Writer, options analyzeOptions) error {
+	posts, err := sentiment.ReadRedditPosts(input)
+
+	if err != nil {
+		return err
+	}
+
+	log.Printf("analyzing %d posts\n", len(posts))
+
+	posts = sentiment.PrepareSignals(posts)
+
+	if options.analysis == "entity" {
+		posts, err = sentiment.AnalyzeEntitesInPosts(ctx, analyzer, posts)
+	} else {
+		posts, err = sentiment.AnalyzePosts(ctx, analyzer, posts)
+	}
+
+	if err != nil {
+		return fmt.Errorf("analyzing posts failed: %v", err)
+	}
+
+	posts = sentiment.AdjustPostSentiment(posts)
+	posts = sentiment.ClassifyPostEmotions(posts, sentiment.DefaultEmotionLexicon())
+
+	if options.format == sentiment.BigQueryFormat {
+		if err := writeSchema(options.schemaOut, sentiment.BigQueryPostRow{}); err != nil {
+			return err
+		}
+	}
+
+	return sentiment.WritePosts(output, entities, sentiment.WrapPosts(posts), posts, options.format, options.entityLayout)
+}
+
+func analyzeCustomerFile(ctx context.Context, analyzer sentiment.Analyzer, input io.Reader, output io.Writer, entities io.Writer, options analyzeOptions) error {
+	columnMapping := sentiment.DefaultColumnMapping()
+
+	if options.columns != "" {
+		columnsJSON, err := os.ReadFile(options.columns)
+
+		if err != nil {
+			return fmt.Errorf("reading column mapping failed: %v", err)
+		}
+
+		if err := json.Unmarshal(columnsJSON, &columnMapping); err != nil {
+			return fmt.Errorf("parsing column mapping failed: %v", err)
+		}
+	}
+
+	comments, rowErrors, err := sentiment.ParseCustomerComments(input, columnMapping, options.strict)
+
+	if err != nil {
+		return fmt.Errorf("parsing csv failed: %v", err)
+	}
+
+	for _, rowError := range rowErrors {
+		log.Printf("skipped row: %v\n", rowError)
+	}
+
+	log.Printf("analyzing %d customer comments\n", len(comments))
+
+	redactor, err := loadRedactor(options)
+
+	if err != nil {
+		return err
+	}
+
+	// customer comments are redacted before they reach the api
+	comments, err = sentiment.AnalyzeCustomerComments(ctx, analyzer, redactor, comments)
+
+	if err != nil {
+		return fmt.Errorf("analyzing customer comments failed: %v", err)
+	}
+
+	comments = sentiment.AssignAspects(comments, sentiment.DefaultAspectTaxonomy())
+	comments = sentiment.ClassifyCustomerEmotions(comments, sentiment.DefaultEmotionLexicon())
+
+	comments, err = sentiment.ApplyEmailPolicy(comments, options.emailPolicy, []byte(os.Getenv("EMAIL_HMAC_KEY")))
+
+	if err != nil {
+		return err
+	}
+
+	if options.format == sentiment.BigQueryFormat {
+		if err := writeSchema(options.schemaOut, sentiment.BigQueryCustomerRow{}); err != nil {
+			return err
+		}
+	}
+
+	return sentiment.WriteCustomerComments(output, entities, comments, options.format, options.entityLayout)
+}
+
+// loadRedactor reads the redaction detectors and dictionary of the flags
+func loadRedactor(options analyzeOptions) (*sentiment.Redactor, error) {
+	var detectorsJSON []byte
+
+	if options.redaction != "" {
+		var err error
+
+		if detectorsJSON, err = os.ReadFile(options.redaction); err != nil {
+			return nil, fmt.Errorf("reading redaction detectors failed: %v", err)
+		}
+	}
+
+	var dictionary io.Reader
+
+	if options.redactionDictionary != "" {
+		dictionaryFile, err := os.Open(options.redactionDictionary)
+
+		if err != nil {
+			return nil, fmt.Errorf("opening redaction dictionary failed: %v", err)
+		}
+
+		defer dictionaryFile.Close()
+
+		dictionary = dictionaryFile
+	}
+
+	return sentiment.LoadRedactor(detectorsJSON, dictionary, options.redactionNameToken)
+}
+
+// writeSchema writes the BigQuery schema of row to filename, if given
+func writeSchema(filename string, row interface{}) error {
+	if filename == "" {
+		return nil
+	}
+
+	schema, err := json.MarshalIndent(sentiment.BigQuerySchema(row), "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, append(schema, '\n'), 0644)
+}
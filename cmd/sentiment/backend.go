@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	language "cloud.google.com/go/language/apiv1"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+	"github.com/SADA-U-Session-3/sentiment-analysis/languagetest"
+)
+
+// backendOptions choose where the analysis comes from
+type backendOptions struct {
+	// backend is google, emulator or replay
+	backend string
+
+	// fixture is the recording the replay backend answers from
+	fixture string
+
+	// emulator is the address of a fake api, LANGUAGE_EMULATOR_HOST by default
+	emulator string
+
+	// record saves the responses of the google or emulator backend as a fixture
+	record string
+}
+
+// newAnalyzer connects to the backend, close releases the client and finishes the recording
+func newAnalyzer(ctx context.Context, options backendOptions) (sentiment.Analyzer, func() error, error) {
+	var client *language.Client
+	var err error
+
+	switch options.backend {
+	case "replay":
+		if options.fixture == "" {
+			return nil, nil, fmt.Errorf("the replay backend needs -fixture")
+		}
+
+		fixture, err := os.Open(options.fixture)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening fixture failed: %v", err)
+		}
+
+		defer fixture.Close()
+
+		replayer, err := sentiment.NewReplayer(fixture)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return replayer, func() error { return nil }, nil
+	case "emulator":
+		emulator := options.emulator
+
+		if emulator == "" {
+			emulator = os.Getenv("LANGUAGE_EMULATOR_HOST")
+		}
+
+		if emulator == "" {
+			return nil, nil, fmt.Errorf("the emulator backend needs -emulator or LANGUAGE_EMULATOR_HOST")
+		}
+
+		client, err = language.NewClient(ctx, languagetest.ClientOptions(emulator)...)
+	case "", "google":
+		client, err = language.NewClient(ctx)
+	default:
+		return nil, nil, fmt.Errorf("unknown backend \"%s\", must be google, emulator or replay", options.backend)
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating language client failed: %v", err)
+	}
+
+	if options.record == "" {
+		return client, client.Close, nil
+	}
+
+	recording, err := os.Create(options.record)
+
+	if err != nil {
+		client.Close()
+
+		return nil, nil, fmt.Errorf("creating record fixture failed: %v", err)
+	}
+
+	closeAll := func() error {
+		if err := client.Close(); err != nil {
+			recording.Close()
+
+			return err
+		}
+
+		return recording.Close()
+	}
+
+	return sentiment.NewRecorder(client, recording), closeAll, nil
+}
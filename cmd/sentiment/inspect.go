@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis"
+)
+
+// inspectOptions are the flags shared by the commands working on analyzed files
+type inspectOptions struct {
+	input  string
+	posts  string
+	asJSON bool
+}
+
+func newInspectFlags(command string, options *inspectOptions) *flag.FlagSet {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: sentiment %s [flags] [analyzed file]\n", command)
+		flags.PrintDefaults()
+	}
+
+	flags.StringVar(&options.input, "input", "", "reddit or customer, detected from the file by default")
+	flags.StringVar(&options.posts, "posts", "", "original reddit posts, to show the text of analyzed posts")
+	flags.BoolVar(&options.asJSON, "json", false, "write json instead of text")
+
+	return flags
+}
+
+// isCustomerAnalysis checks if the first json value of an analyzed file is a customer comment
+func isCustomerAnalysis(data []byte) bool {
+	var first map[string]json.RawMessage
+
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&first); err != nil {
+		return false
+	}
+
+	_, ok := first["comment"]
+
+	return ok
+}
+
+// readAnalyzedRecords reads an analyzed reddit or customer file
+func readAnalyzedRecords(filename string, options inspectOptions) ([]sentiment.Record, error) {
+	input, err := openInput(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer input.Close()
+
+	data, err := io.ReadAll(input)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch options.input {
+	case "":
+		if isCustomerAnalysis(data) {
+			return sentiment.ReadCustomerRecords(bytes.NewReader(data))
+		}
+	case "customer":
+		return sentiment.ReadCustomerRecords(bytes.NewReader(data))
+	case "reddit":
+	default:
+		return nil, fmt.Errorf("input must be reddit or customer")
+	}
+
+	records, err := sentiment.ReadPostRecords(bytes.NewReader(data))
+
+	if err != nil || options.posts == "" {
+		return records, err
+	}
+
+	postsFile, err := os.Open(options.posts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer postsFile.Close()
+
+	posts, err := sentiment.ReadRedditPosts(postsFile)
+
+	if err != nil {
+		return nil, fmt.Errorf("reading posts failed: %v", err)
+	}
+
+	return sentiment.JoinPosts(records, posts), nil
+}
+
+// parseInspectArgs parses the flags and reads the analyzed file they point to
+func parseInspectArgs(flags *flag.FlagSet, args []string, options *inspectOptions) ([]sentiment.Record, error) {
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if flags.NArg() > 1 {
+		return nil, fmt.Errorf("%s takes a single file, got %d", flags.Name(), flags.NArg())
+	}
+
+	return readAnalyzedRecords(flags.Arg(0), *options)
+}
+
+func writeJSON(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(value)
+}
+
+func writeRecords(records []sentiment.Record, asJSON bool) error {
+	if asJSON {
+		return sentiment.WriteNDJSON(os.Stdout, records)
+	}
+
+	sentiment.FprintRecords(os.Stdout, records)
+
+	return nil
+}
+
+// runReport prints the overall sentiment of an analyzed file
+func runReport(args []string) error {
+	options := inspectOptions{}
+	flags := newInspectFlags("report", &options)
+
+	records, err := parseInspectArgs(flags, args, &options)
+
+	if err != nil {
+		return err
+	}
+
+	summary := sentiment.SummarizeRecords(records)
+
+	if options.asJSON {
+		return writeJSON(summary)
+	}
+
+	sentiment.FprintReport(os.Stdout, summary)
+
+	return nil
+}
+
+// runTop prints the most positive or negative records of an analyzed file
+func runTop(args []string) error {
+	options := inspectOptions{}
+	flags := newInspectFlags("top", &options)
+
+	n := flags.Int("n", 10, "amount of records")
+	negative := flags.Bool("negative", false, "the most negative records instead of the most positive")
+
+	records, err := parseInspectArgs(flags, args, &options)
+
+	if err != nil {
+		return err
+	}
+
+	return writeRecords(sentiment.TopRecords(records, *n, *negative), options.asJSON)
+}
+
+// runEntities prints the entities of an analyzed file ranked by the amount of records they are in
+func runEntities(args []string) error {
+	options := inspectOptions{}
+	flags := newInspectFlags("entities", &options)
+
+	n := flags.Int("n", 20, "amount of entities, 0 for all")
+
+	records, err := parseInspectArgs(flags, args, &options)
+
+	if err != nil {
+		return err
+	}
+
+	ranks := sentiment.RankEntities(records)
+
+	if *n > 0 && *n < len(ranks) {
+		ranks = ranks[:*n]
+	}
+
+	if options.asJSON {
+		return writeJSON(ranks)
+	}
+
+	return sentiment.FprintEntities(os.Stdout, ranks)
+}
+
+// scoreFlag is an optional score, nil until set
+type scoreFlag struct {
+	score *float32
+}
+
+func (flag *scoreFlag) String() string {
+	if flag.score == nil {
+		return ""
+	}
+
+	return fmt.Sprint(*flag.score)
+}
+
+func (flag *scoreFlag) Set(value string) error {
+	score, err := strconv.ParseFloat(value, 32)
+
+	if err != nil {
+		return err
+	}
+
+	score32 := float32(score)
+	flag.score = &score32
+
+	return nil
+}
+
+// runGrep prints the records of an analyzed file matching a label, score range or entity
+func runGrep(args []string) error {
+	options := inspectOptions{}
+	flags := newInspectFlags("grep", &options)
+
+	filter := sentiment.RecordFilter{}
+	minScore := scoreFlag{}
+	maxScore := scoreFlag{}
+
+	flags.StringVar(&filter.Label, "label", "", "positive, neutral, mixed or negative")
+	flags.Var(&minScore, "min", "lowest score")
+	flags.Var(&maxScore, "max", "highest score")
+	flags.StringVar(&filter.Entity, "entity", "", "part of an entity keyword, case insensitive")
+
+	records, err := parseInspectArgs(flags, args, &options)
+
+	if err != nil {
+		return err
+	}
+
+	filter.MinScore = minScore.score
+	filter.MaxScore = maxScore.score
+
+	return writeRecords(sentiment.FilterRecords(records, filter), options.asJSON)
+}
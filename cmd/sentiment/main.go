@@ -0,0 +1,90 @@
+// Command sentiment analyzes reddit posts and customer comments from local files, without App Engine
+//
+//	sentiment analyze -backend replay -fixture fixture.ndjson -format csv -o posts_analyzed.csv posts.json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+const usage = `usage: sentiment <command> [flags] [file]
+
+commands:
+  analyze    analyze reddit posts (json or ndjson) or customer comments (csv)
+  report     summary and charts of an analyzed file
+  top        most positive or negative records of an analyzed file
+  entities   entities of an analyzed file ranked by the records they are in
+  grep       records of an analyzed file by label, score range or entity
+
+reads stdin when file is - or missing, run sentiment <command> -h for the flags of a command
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("sentiment: ")
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+
+	switch os.Args[1] {
+	case "analyze":
+		err = runAnalyze(os.Args[2:])
+	case "report":
+		err = runReport(os.Args[2:])
+	case "top":
+		err = runTop(os.Args[2:])
+	case "entities":
+		err = runEntities(os.Args[2:])
+	case "grep":
+		err = runGrep(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command \"%s\"\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err == flag.ErrHelp {
+		return
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// openInput opens filename, or stdin for - and no filename
+func openInput(filename string) (io.ReadCloser, error) {
+	if filename == "" || filename == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	return os.Open(filename)
+}
+
+// createOutput creates filename, or writes to stdout for - and no filename
+func createOutput(filename string) (io.WriteCloser, error) {
+	if filename == "" || filename == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+
+	return os.Create(filename)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,139 @@
+package sentiment
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"unicode/utf8"
+)
+
+// Feature is a billable feature of Google's Natural Language api
+type Feature string
+
+const (
+	SentimentFeature       Feature = "sentiment"
+	EntitySentimentFeature Feature = "entitySentiment"
+)
+
+// charactersPerUnit is the amount of characters Google bills as a single unit
+const charactersPerUnit = 1000
+
+// UnitPrices is the price in USD of a single 1,000 character unit for each feature
+// see https://cloud.google.com/natural-language/pricing
+var UnitPrices = map[Feature]float64{
+	SentimentFeature:       0.001,
+	EntitySentimentFeature: 0.002,
+}
+
+// FeatureUsage is the billable usage of a single feature
+type FeatureUsage struct {
+	Requests   int     `json:"requests"`
+	Characters int     `json:"characters"`
+	Units      int     `json:"units"`
+	Cost       float64 `json:"cost"`
+}
+
+// Usage keeps track of the billable units sent to Google's api
+type Usage struct {
+	DryRun     bool                     `json:"dryRun"`
+	Features   map[Feature]FeatureUsage `json:"features"`
+	TotalUnits int                      `json:"totalUnits"`
+	TotalCost  float64                  `json:"totalCost"`
+
+	mu sync.Mutex
+}
+
+// NewUsage creates an empty Usage
+func NewUsage() *Usage {
+	return &Usage{
+		Features: make(map[Feature]FeatureUsage),
+	}
+}
+
+// Record adds a single request of text for feature to the usage
+func (usage *Usage) Record(feature Feature, text string) {
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+
+	characters := utf8.RuneCountInString(text)
+	units := billableUnits(characters)
+	cost := float64(units) * UnitPrices[feature]
+
+	featureUsage := usage.Features[feature]
+	featureUsage.Requests++
+	featureUsage.Characters += characters
+	featureUsage.Units += units
+	featureUsage.Cost += cost
+
+	usage.Features[feature] = featureUsage
+	usage.TotalUnits += units
+	usage.TotalCost += cost
+}
+
+func (usage *Usage) String() string {
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+
+	return fmt.Sprintf("%d units ($%.4f)", usage.TotalUnits, usage.TotalCost)
+}
+
+// billableUnits rounds up the characters to the next unit, every request costs at least one unit
+func billableUnits(characters int) int {
+	units := (characters + charactersPerUnit - 1) / charactersPerUnit
+
+	if units == 0 {
+		return 1
+	}
+
+	return units
+}
+
+type usageKey struct{}
+
+// WithUsage returns a copy of ctx where every request sent to Google's api is recorded in usage
+func WithUsage(ctx context.Context, usage *Usage) context.Context {
+	return context.WithValue(ctx, usageKey{}, usage)
+}
+
+func recordUsage(ctx context.Context, feature Feature, text string) {
+	usage, ok := ctx.Value(usageKey{}).(*Usage)
+
+	if !ok || usage == nil {
+		return
+	}
+
+	usage.Record(feature, text)
+}
+
+// isBilled checks if Google bills the requests sent to client, the Replayer answers from a fixture
+func isBilled(client Analyzer) bool {
+	_, replayed := client.(*Replayer)
+
+	return !replayed
+}
+
+// EstimatePosts reports the units and cost of analyzing posts with feature without calling the api
+func EstimatePosts(posts []RedditPost, feature Feature) *Usage {
+	usage := NewUsage()
+	usage.DryRun = true
+
+	postsWithBodyText := pruneEmptyPosts(posts)
+
+	for i := 0; i < len(postsWithBodyText); i++ {
+		usage.Record(feature, postsWithBodyText[i].apiText())
+	}
+
+	return usage
+}
+
+// EstimateCustomerComments reports the units and cost of AnalyzeCustomerComments without calling the api
+func EstimateCustomerComments(comments []CustomerAnalysis) *Usage {
+	usage := NewUsage()
+	usage.DryRun = true
+
+	for i := 0; i < len(comments); i++ {
+		usage.Record(EntitySentimentFeature, comments[i].Comment)
+	}
+
+	return usage
+}
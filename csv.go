@@ -0,0 +1,235 @@
+package sentiment
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ColumnMapping maps the fields of CustomerAnalysis to the headers of a customer feedback csv.
+// each field lists its aliases, the first header matching an alias, case insensitive, is used
+type ColumnMapping struct {
+	Timestamp []string `json:"timestamp"`
+	Email     []string `json:"email"`
+	Comment   []string `json:"comment"`
+	Rating    []string `json:"rating,omitempty"`
+
+	// RatingScale rejects the ratings outside of it, any finite rating is accepted when nil
+	RatingScale *RatingScale `json:"ratingScale,omitempty"`
+
+	// Passthrough are extra columns copied as is into CustomerAnalysis.Extra
+	Passthrough []string `json:"passthrough,omitempty"`
+
+	// Fallback are the positions of the columns when none of the headers match an alias
+	Fallback *ColumnPositions `json:"fallback,omitempty"`
+}
+
+// ColumnPositions are the zero based positions of the columns of a csv
+type ColumnPositions struct {
+	Timestamp int `json:"timestamp"`
+	Email     int `json:"email"`
+	Comment   int `json:"comment"`
+}
+
+// DefaultColumnMapping knows the headers of our Google Forms exports and a few common variations,
+// files with other headers are read with the layout of the original form
+func DefaultColumnMapping() ColumnMapping {
+	return ColumnMapping{
+		Timestamp: []string{"timestamp", "time", "date", "submitted at", "created at"},
+		Email:     []string{"email address", "email", "e-mail"},
+		Comment:   []string{"comment", "comments", "feedback", "message"},
+		Rating:    []string{"rating", "score", "nps", "csat", "stars"},
+		Fallback:  &ColumnPositions{Timestamp: 0, Email: 3, Comment: 2},
+	}
+}
+
+// RowError describes a row of the csv that could not be used, Row is the line the row starts on
+type RowError struct {
+	Row    int    `json:"row"`
+	Reason string `json:"reason"`
+}
+
+func (rowError RowError) Error() string {
+	return fmt.Sprintf("row %d: %s", rowError.Row, rowError.Reason)
+}
+
+// columnIndexes are the positions of the mapped columns within a row, -1 when the csv does not have the column
+type columnIndexes struct {
+	timestamp   int
+	email       int
+	comment     int
+	rating      int
+	passthrough map[string]int
+}
+
+func normalizeHeader(header string) string {
+	// excel likes to start the file with a byte order mark
+	header = strings.TrimPrefix(header, "\ufeff")
+
+	return strings.ToLower(strings.TrimSpace(header))
+}
+
+func findColumn(headers []string, aliases []string) int {
+	for _, alias := range aliases {
+		alias = normalizeHeader(alias)
+
+		for i := 0; i < len(headers); i++ {
+			if normalizeHeader(headers[i]) == alias {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+func (mapping ColumnMapping) indexes(headers []string) (columnIndexes, error) {
+	indexes := columnIndexes{
+		timestamp:   findColumn(headers, mapping.Timestamp),
+		email:       findColumn(headers, mapping.Email),
+		comment:     findColumn(headers, mapping.Comment),
+		rating:      findColumn(headers, mapping.Rating),
+		passthrough: make(map[string]int),
+	}
+
+	if indexes.timestamp == -1 && indexes.email == -1 && indexes.comment == -1 && mapping.Fallback != nil {
+		indexes.timestamp = mapping.Fallback.Timestamp
+		indexes.email = mapping.Fallback.Email
+		indexes.comment = mapping.Fallback.Comment
+
+		if indexes.comment >= len(headers) {
+			return indexes, fmt.Errorf("no comment column found, looked for %q in %q and the csv has no column %d", mapping.Comment, headers, indexes.comment)
+		}
+	}
+
+	if indexes.comment == -1 {
+		return indexes, fmt.Errorf("no comment column found, looked for %q in %q", mapping.Comment, headers)
+	}
+
+	for _, column := range mapping.Passthrough {
+		index := findColumn(headers, []string{column})
+
+		if index == -1 {
+			return indexes, fmt.Errorf("passthrough column \"%s\" not found in %q", column, headers)
+		}
+
+		indexes.passthrough[column] = index
+	}
+
+	return indexes, nil
+}
+
+func cell(row []string, index int) string {
+	if index < 0 || index >= len(row) {
+		return ""
+	}
+
+	return row[index]
+}
+
+// ParseCustomerComments reads a customer feedback csv with a header row using mapping.
+// malformed rows are skipped and reported, unless strict where the first one fails the whole file
+func ParseCustomerComments(r io.Reader, mapping ColumnMapping, strict bool) ([]CustomerAnalysis, []RowError, error) {
+	comments := make([]CustomerAnalysis, 0)
+	rowErrors := make([]RowError, 0)
+
+	csvReader := csv.NewReader(r)
+
+	// row lengths are validated below, so a short row is reported instead of failing the whole file
+	csvReader.FieldsPerRecord = -1
+
+	headers, err := csvReader.Read()
+
+	if err == io.EOF {
+		return comments, rowErrors, fmt.Errorf("csv is empty")
+	}
+
+	if err != nil {
+		return comments, rowErrors, fmt.Errorf("parsing csv header failed: %v", err)
+	}
+
+	indexes, err := mapping.indexes(headers)
+
+	if err != nil {
+		return comments, rowErrors, err
+	}
+
+	for {
+		row, err := csvReader.Read()
+
+		if err == io.EOF {
+			break
+		}
+
+		var rowError *RowError
+
+		var parseError *csv.ParseError
+
+		// quoted comments can span lines, so rows are numbered by the line they start on
+		rowNumber := 0
+
+		if errors.As(err, &parseError) {
+			rowNumber = parseError.StartLine
+		} else if err == nil {
+			rowNumber, _ = csvReader.FieldPos(0)
+		}
+
+		if parseError != nil {
+			rowError = &RowError{Row: rowNumber, Reason: parseError.Err.Error()}
+		} else if err != nil {
+			return comments, rowErrors, fmt.Errorf("parsing csv failed: %v", err)
+		} else if len(row) != len(headers) {
+			rowError = &RowError{Row: rowNumber, Reason: fmt.Sprintf("expected %d columns, found %d", len(headers), len(row))}
+		} else if strings.TrimSpace(row[indexes.comment]) == "" {
+			rowError = &RowError{Row: rowNumber, Reason: "comment is empty"}
+		}
+
+		var rating *float64
+
+		if rowError == nil && strings.TrimSpace(cell(row, indexes.rating)) != "" {
+			parsedRating, err := strconv.ParseFloat(strings.TrimSpace(cell(row, indexes.rating)), 64)
+
+			// ParseFloat accepts NaN and Inf, which would break the grouping of the ratings
+			if err != nil || math.IsNaN(parsedRating) || math.IsInf(parsedRating, 0) {
+				rowError = &RowError{Row: rowNumber, Reason: fmt.Sprintf("rating \"%s\" is not a number", cell(row, indexes.rating))}
+			} else if scale := mapping.RatingScale; scale != nil && (parsedRating < scale.Min || parsedRating > scale.Max) {
+				rowError = &RowError{Row: rowNumber, Reason: fmt.Sprintf("rating %v is outside of the scale %v - %v", parsedRating, scale.Min, scale.Max)}
+			}
+
+			rating = &parsedRating
+		}
+
+		if rowError != nil {
+			if strict {
+				return comments, append(rowErrors, *rowError), *rowError
+			}
+
+			rowErrors = append(rowErrors, *rowError)
+
+			continue
+		}
+
+		comment := CustomerAnalysis{
+			Timestamp: cell(row, indexes.timestamp),
+			Email:     cell(row, indexes.email),
+			Comment:   cell(row, indexes.comment),
+			Rating:    rating,
+		}
+
+		if len(indexes.passthrough) > 0 {
+			comment.Extra = make(map[string]string)
+
+			for column, index := range indexes.passthrough {
+				comment.Extra[column] = cell(row, index)
+			}
+		}
+
+		comments = append(comments, comment)
+	}
+
+	return comments, rowErrors, nil
+}
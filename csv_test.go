@@ -0,0 +1,177 @@
+package sentiment
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCustomerComments(t *testing.T) {
+	tests := []struct {
+		name          string
+		mapping       ColumnMapping
+		csv           string
+		wantComments  []CustomerAnalysis
+		wantRowErrors []RowError
+		wantErr       bool
+	}{
+		{
+			name:    "maps the columns by header",
+			mapping: DefaultColumnMapping(),
+			csv:     "Feedback,E-mail,Submitted At\ngreat,a@example.com,2021-01-01\n",
+			wantComments: []CustomerAnalysis{
+				{Timestamp: "2021-01-01", Email: "a@example.com", Comment: "great"},
+			},
+		},
+		{
+			name:    "ignores the case, spaces and byte order mark of the headers",
+			mapping: DefaultColumnMapping(),
+			csv:     "\ufeffTimestamp, COMMENT \n2021-01-01,great\n",
+			wantComments: []CustomerAnalysis{
+				{Timestamp: "2021-01-01", Comment: "great"},
+			},
+		},
+		{
+			name:    "falls back to the layout of the original form without known headers",
+			mapping: DefaultColumnMapping(),
+			csv:     "Horodateur,Note,Commentaire,Adresse\n2021-01-01,5,great,a@example.com\n",
+			wantComments: []CustomerAnalysis{
+				{Timestamp: "2021-01-01", Email: "a@example.com", Comment: "great"},
+			},
+		},
+		{
+			name:    "does not fall back without a fallback",
+			mapping: ColumnMapping{Comment: []string{"comment"}},
+			csv:     "Horodateur,Note,Commentaire,Adresse\n2021-01-01,5,great,a@example.com\n",
+			wantErr: true,
+		},
+		{
+			name:    "fails when the fallback comment column is missing",
+			mapping: DefaultColumnMapping(),
+			csv:     "a,b\n1,2\n",
+			wantErr: true,
+		},
+		{
+			name:    "copies the passthrough columns",
+			mapping: ColumnMapping{Comment: []string{"comment"}, Passthrough: []string{"Store"}},
+			csv:     "comment,store\ngreat,Paris\n",
+			wantComments: []CustomerAnalysis{
+				{Comment: "great", Extra: map[string]string{"Store": "Paris"}},
+			},
+		},
+		{
+			name:    "fails on a missing passthrough column",
+			mapping: ColumnMapping{Comment: []string{"comment"}, Passthrough: []string{"store"}},
+			csv:     "comment\ngreat\n",
+			wantErr: true,
+		},
+		{
+			name:    "reports malformed rows by the line they start on",
+			mapping: DefaultColumnMapping(),
+			csv:     "timestamp,comment\n2021-01-01,\"great\nreally\"\n2021-01-02\n2021-01-03,\n2021-01-04,\"bad\"quote\n2021-01-05,fine\n",
+			wantComments: []CustomerAnalysis{
+				{Timestamp: "2021-01-01", Comment: "great\nreally"},
+				{Timestamp: "2021-01-05", Comment: "fine"},
+			},
+			wantRowErrors: []RowError{
+				{Row: 4, Reason: "expected 2 columns, found 1"},
+				{Row: 5, Reason: "comment is empty"},
+				{Row: 6},
+			},
+		},
+		{
+			name:    "reports ratings that are not finite numbers",
+			mapping: DefaultColumnMapping(),
+			csv:     "comment,rating\na,5\nb,NaN\nc,+Inf\nd,five\ne,\n",
+			wantComments: []CustomerAnalysis{
+				{Comment: "a", Rating: float64Pointer(5)},
+				{Comment: "e"},
+			},
+			wantRowErrors: []RowError{
+				{Row: 3, Reason: "rating \"NaN\" is not a number"},
+				{Row: 4, Reason: "rating \"+Inf\" is not a number"},
+				{Row: 5, Reason: "rating \"five\" is not a number"},
+			},
+		},
+		{
+			name:    "reports ratings outside of the scale",
+			mapping: ColumnMapping{Comment: []string{"comment"}, Rating: []string{"rating"}, RatingScale: &CSATScale},
+			csv:     "comment,rating\na,1\nb,0\nc,5\nd,6\n",
+			wantComments: []CustomerAnalysis{
+				{Comment: "a", Rating: float64Pointer(1)},
+				{Comment: "c", Rating: float64Pointer(5)},
+			},
+			wantRowErrors: []RowError{
+				{Row: 3, Reason: "rating 0 is outside of the scale 1 - 5"},
+				{Row: 5, Reason: "rating 6 is outside of the scale 1 - 5"},
+			},
+		},
+		{
+			name:    "fails on an empty csv",
+			mapping: DefaultColumnMapping(),
+			csv:     "",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			comments, rowErrors, err := ParseCustomerComments(strings.NewReader(test.csv), test.mapping, false)
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if len(comments) != len(test.wantComments) {
+				t.Fatalf("got %d comments, want %d", len(comments), len(test.wantComments))
+			}
+
+			for i := 0; i < len(comments); i++ {
+				got, want := comments[i], test.wantComments[i]
+
+				if got.Timestamp != want.Timestamp || got.Email != want.Email || got.Comment != want.Comment {
+					t.Errorf("comment %d: got %+v, want %+v", i, got, want)
+				}
+
+				if (got.Rating == nil) != (want.Rating == nil) || (got.Rating != nil && *got.Rating != *want.Rating) {
+					t.Errorf("comment %d: got rating %v, want %v", i, got.Rating, want.Rating)
+				}
+
+				for column, value := range want.Extra {
+					if got.Extra[column] != value {
+						t.Errorf("comment %d: got %s \"%s\", want \"%s\"", i, column, got.Extra[column], value)
+					}
+				}
+			}
+
+			if len(rowErrors) != len(test.wantRowErrors) {
+				t.Fatalf("got row errors %v, want %v", rowErrors, test.wantRowErrors)
+			}
+
+			for i := 0; i < len(rowErrors); i++ {
+				want := test.wantRowErrors[i]
+
+				if rowErrors[i].Row != want.Row || (want.Reason != "" && rowErrors[i].Reason != want.Reason) {
+					t.Errorf("got row error %v, want %v", rowErrors[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCustomerCommentsStrict(t *testing.T) {
+	csv := "timestamp,comment\n2021-01-01,great\n2021-01-02,\n2021-01-03,fine\n"
+
+	comments, rowErrors, err := ParseCustomerComments(strings.NewReader(csv), DefaultColumnMapping(), true)
+
+	if err == nil {
+		t.Fatalf("a malformed row did not fail a strict parse")
+	}
+
+	if len(comments) != 1 || len(rowErrors) != 1 || rowErrors[0].Row != 3 {
+		t.Errorf("got %d comments and row errors %v, want 1 comment and an error on row 3", len(comments), rowErrors)
+	}
+}
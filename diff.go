@@ -0,0 +1,172 @@
+package sentiment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// RecordChange is how the analysis of a single record changed between two runs
+type RecordChange struct {
+	ID             string           `json:"id"`
+	Before         SentimentWrapper `json:"before"`
+	After          SentimentWrapper `json:"after"`
+	ScoreDelta     float32          `json:"scoreDelta"`
+	LabelFlip      bool             `json:"labelFlip"`
+	EntitiesGained []string         `json:"entitiesGained"`
+	EntitiesLost   []string         `json:"entitiesLost"`
+}
+
+// RunDiff compares two analysis runs of the same records
+type RunDiff struct {
+	Compared       int            `json:"compared"`
+	Changed        int            `json:"changed"`
+	LabelFlips     int            `json:"labelFlips"`
+	MeanScoreDelta float64        `json:"meanScoreDelta"`
+	Changes        []RecordChange `json:"changes"`
+	OnlyInBefore   []string       `json:"onlyInBefore"`
+	OnlyInAfter    []string       `json:"onlyInAfter"`
+}
+
+// ReadPostRecords reads an analyzed reddit file, one json analysis per line
+func ReadPostRecords(r io.Reader) ([]Record, error) {
+	records := make([]Record, 0)
+	decoder := json.NewDecoder(r)
+
+	for decoder.More() {
+		var record Record
+
+		if err := decoder.Decode(&record); err != nil {
+			return records, fmt.Errorf("parsing json failed: %v", err)
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// ReadCustomerRecords reads an analyzed customer file, keyed by their time and the hash of their comment
+func ReadCustomerRecords(r io.Reader) ([]Record, error) {
+	comments := make([]CustomerAnalysis, 0)
+	decoder := json.NewDecoder(r)
+
+	for decoder.More() {
+		var comment CustomerAnalysis
+
+		if err := decoder.Decode(&comment); err != nil {
+			return nil, fmt.Errorf("parsing json failed: %v", err)
+		}
+
+		comments = append(comments, comment)
+	}
+
+	return CustomerRecords(comments), nil
+}
+
+// entityNames are the lowercase names of the entities
+func entityNames(entities []EntityWrapper) map[string]bool {
+	names := make(map[string]bool)
+
+	for _, entity := range entities {
+		names[strings.ToLower(entity.Keyword)] = true
+	}
+
+	return names
+}
+
+// missingNames are the sorted names of from that are not in to
+func missingNames(from map[string]bool, to map[string]bool) []string {
+	missing := make([]string, 0)
+
+	for name := range from {
+		if !to[name] {
+			missing = append(missing, name)
+		}
+	}
+
+	sort.Strings(missing)
+
+	return missing
+}
+
+// DiffRecords compares two runs by record id, a record changed when its label flipped,
+// its score moved by more than minScoreDelta or it gained or lost entities
+func DiffRecords(before []Record, after []Record, minScoreDelta float32) RunDiff {
+	diff := RunDiff{
+		Changes:      make([]RecordChange, 0),
+		OnlyInBefore: make([]string, 0),
+		OnlyInAfter:  make([]string, 0),
+	}
+
+	afterByID := make(map[string]Record)
+
+	for _, record := range after {
+		afterByID[record.ID] = record
+	}
+
+	beforeIDs := make(map[string]bool)
+	scoreDeltaSum := 0.0
+
+	for _, beforeRecord := range before {
+		beforeIDs[beforeRecord.ID] = true
+
+		afterRecord, ok := afterByID[beforeRecord.ID]
+
+		if !ok {
+			diff.OnlyInBefore = append(diff.OnlyInBefore, beforeRecord.ID)
+
+			continue
+		}
+
+		diff.Compared++
+
+		beforeEntities := entityNames(beforeRecord.Entity)
+		afterEntities := entityNames(afterRecord.Entity)
+
+		change := RecordChange{
+			ID:             beforeRecord.ID,
+			Before:         beforeRecord.Sentiment,
+			After:          afterRecord.Sentiment,
+			ScoreDelta:     afterRecord.Sentiment.Score - beforeRecord.Sentiment.Score,
+			LabelFlip:      beforeRecord.Sentiment.ParsedSentiment != afterRecord.Sentiment.ParsedSentiment,
+			EntitiesGained: missingNames(afterEntities, beforeEntities),
+			EntitiesLost:   missingNames(beforeEntities, afterEntities),
+		}
+
+		scoreDeltaSum += float64(change.ScoreDelta)
+
+		if change.LabelFlip {
+			diff.LabelFlips++
+		}
+
+		if !change.LabelFlip && float32(math.Abs(float64(change.ScoreDelta))) <= minScoreDelta &&
+			len(change.EntitiesGained) == 0 && len(change.EntitiesLost) == 0 {
+			continue
+		}
+
+		diff.Changes = append(diff.Changes, change)
+	}
+
+	for _, record := range after {
+		if !beforeIDs[record.ID] {
+			diff.OnlyInAfter = append(diff.OnlyInAfter, record.ID)
+		}
+	}
+
+	diff.Changed = len(diff.Changes)
+
+	if diff.Compared > 0 {
+		diff.MeanScoreDelta = scoreDeltaSum / float64(diff.Compared)
+	}
+
+	// the biggest moves first
+	sort.SliceStable(diff.Changes, func(i, j int) bool {
+		return math.Abs(float64(diff.Changes[i].ScoreDelta)) > math.Abs(float64(diff.Changes[j].ScoreDelta))
+	})
+
+	return diff
+}
@@ -0,0 +1,139 @@
+package sentiment
+
+import (
+	"strings"
+	"testing"
+)
+
+// diffRecord is a record scored score, mentioning entities
+func diffRecord(id string, score float32, entities ...string) Record {
+	record := Record{
+		ID:        id,
+		Sentiment: SentimentWrapper{Score: score, ParsedSentiment: parseSentiment(score)},
+	}
+
+	for _, entity := range entities {
+		record.Entity = append(record.Entity, EntityWrapper{Keyword: entity, Count: 1})
+	}
+
+	return record
+}
+
+func TestDiffRecords(t *testing.T) {
+	tests := []struct {
+		name             string
+		before           []Record
+		after            []Record
+		minScoreDelta    float32
+		wantCompared     int
+		wantChanges      []string
+		wantLabelFlips   int
+		wantOnlyInBefore []string
+		wantOnlyInAfter  []string
+	}{
+		{
+			name:          "ignores small moves",
+			before:        []Record{diffRecord("a", 0.5)},
+			after:         []Record{diffRecord("a", 0.55)},
+			minScoreDelta: 0.1,
+			wantCompared:  1,
+			wantChanges:   []string{},
+		},
+		{
+			name:           "reports flips and big moves, the biggest first",
+			before:         []Record{diffRecord("a", 0.5), diffRecord("b", 0.3), diffRecord("c", 0.9)},
+			after:          []Record{diffRecord("a", -0.5), diffRecord("b", 0.31), diffRecord("c", 0.2)},
+			minScoreDelta:  0.1,
+			wantCompared:   3,
+			wantChanges:    []string{"a", "c"},
+			wantLabelFlips: 1,
+		},
+		{
+			name:          "reports gained and lost entities",
+			before:        []Record{diffRecord("a", 0.5, "Pizza", "oven")},
+			after:         []Record{diffRecord("a", 0.5, "pizza", "delivery")},
+			minScoreDelta: 0.1,
+			wantCompared:  1,
+			wantChanges:   []string{"a"},
+		},
+		{
+			name:             "lists the records of a single run",
+			before:           []Record{diffRecord("a", 0.5), diffRecord("b", 0.5)},
+			after:            []Record{diffRecord("b", 0.5), diffRecord("c", 0.5)},
+			wantCompared:     1,
+			wantChanges:      []string{},
+			wantOnlyInBefore: []string{"a"},
+			wantOnlyInAfter:  []string{"c"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff := DiffRecords(test.before, test.after, test.minScoreDelta)
+
+			if diff.Compared != test.wantCompared || diff.LabelFlips != test.wantLabelFlips {
+				t.Errorf("compared %d with %d flips, want %d with %d", diff.Compared, diff.LabelFlips, test.wantCompared, test.wantLabelFlips)
+			}
+
+			ids := make([]string, 0)
+
+			for _, change := range diff.Changes {
+				ids = append(ids, change.ID)
+			}
+
+			if strings.Join(ids, ",") != strings.Join(test.wantChanges, ",") || diff.Changed != len(test.wantChanges) {
+				t.Errorf("got changes %v, want %v", ids, test.wantChanges)
+			}
+
+			if strings.Join(diff.OnlyInBefore, ",") != strings.Join(test.wantOnlyInBefore, ",") {
+				t.Errorf("got only in before %v, want %v", diff.OnlyInBefore, test.wantOnlyInBefore)
+			}
+
+			if strings.Join(diff.OnlyInAfter, ",") != strings.Join(test.wantOnlyInAfter, ",") {
+				t.Errorf("got only in after %v, want %v", diff.OnlyInAfter, test.wantOnlyInAfter)
+			}
+		})
+	}
+}
+
+func TestDiffRecordsEntities(t *testing.T) {
+	diff := DiffRecords(
+		[]Record{diffRecord("a", 0.5, "Pizza", "oven")},
+		[]Record{diffRecord("a", 0.5, "pizza", "delivery")},
+		0,
+	)
+
+	change := diff.Changes[0]
+
+	if strings.Join(change.EntitiesGained, ",") != "delivery" || strings.Join(change.EntitiesLost, ",") != "oven" {
+		t.Errorf("gained %v and lost %v, want delivery and oven", change.EntitiesGained, change.EntitiesLost)
+	}
+}
+
+func TestReadCustomerRecords(t *testing.T) {
+	analyzed := `{"timestamp": "2021-01-01", "email": "a@example.com", "comment": "cold soup", "sentiment": {"score": -0.5}}
+{"timestamp": "2021-01-01", "comment": "cold soup", "sentiment": {"score": -0.4}}
+{"timestamp": "2021-01-01", "comment": "hot soup", "sentiment": {"score": 0.4}}
+`
+
+	records, err := ReadCustomerRecords(strings.NewReader(analyzed))
+
+	if err != nil {
+		t.Fatalf("reading failed: %v", err)
+	}
+
+	ids := make(map[string]bool)
+
+	for _, record := range records {
+		ids[record.ID] = true
+	}
+
+	// the same comment sent twice at once is still told apart
+	if len(records) != 3 || len(ids) != 3 {
+		t.Errorf("got records %v, want 3 records with distinct ids", records)
+	}
+
+	if _, err := ReadCustomerRecords(strings.NewReader("{")); err == nil {
+		t.Errorf("reading invalid json did not fail")
+	}
+}
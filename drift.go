@@ -0,0 +1,317 @@
+package sentiment
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// DriftMethod is the way drift is detected over the buckets
+type DriftMethod string
+
+const (
+	// ZScoreDrift compares each bucket to the mean and deviation of the buckets right before it
+	ZScoreDrift DriftMethod = "zscore"
+	// CUSUMDrift accumulates the deviations from the first buckets, so it catches slow shifts
+	CUSUMDrift DriftMethod = "cusum"
+)
+
+const (
+	MeanScoreMetric     = "meanScore"
+	NegativeShareMetric = "negativeShare"
+)
+
+// the deviation used when the baseline does not vary, so a change after a flat baseline still stands out
+const minStdDev = 0.01
+
+// the records with the biggest part in an anomaly that are reported with it
+const maxDrivers = 5
+
+// DriftOptions configure DetectDrift, zero values use the defaults
+type DriftOptions struct {
+	Method DriftMethod `json:"method"`
+
+	// BucketSize is the span of time of a bucket, 24h by default
+	BucketSize Duration `json:"bucketSize"`
+
+	// Window is the amount of buckets the baseline is made of, 7 by default
+	Window int `json:"window"`
+
+	// Threshold is the z-score, or the CUSUM decision interval in standard deviations, 3 and 5 by default
+	Threshold float64 `json:"threshold"`
+
+	// Slack is the CUSUM allowance in standard deviations, 0.5 by default
+	Slack float64 `json:"slack"`
+
+	// MinRecords is the least records a bucket needs to be looked at, 1 by default
+	MinRecords int `json:"minRecords"`
+}
+
+// Bucket is the analysis of the records within a span of time
+type Bucket struct {
+	Start         time.Time `json:"start"`
+	Count         int       `json:"count"`
+	MeanScore     float64   `json:"meanScore"`
+	NegativeShare float64   `json:"negativeShare"`
+
+	records []Record
+}
+
+// Anomaly is a bucket where a metric shifted away from its baseline
+type Anomaly struct {
+	Bucket    time.Time `json:"bucket"`
+	Metric    string    `json:"metric"`
+	Value     float64   `json:"value"`
+	Expected  float64   `json:"expected"`
+	Magnitude float64   `json:"magnitude"`
+	Direction string    `json:"direction"`
+	Drivers   []string  `json:"drivers"`
+}
+
+func (options DriftOptions) withDefaults() (DriftOptions, error) {
+	if options.Method == "" {
+		options.Method = ZScoreDrift
+	}
+
+	if options.Method != ZScoreDrift && options.Method != CUSUMDrift {
+		return options, fmt.Errorf("unknown drift method \"%s\", must be zscore or cusum", options.Method)
+	}
+
+	if options.BucketSize <= 0 {
+		options.BucketSize = Duration(24 * time.Hour)
+	}
+
+	if options.Window <= 0 {
+		options.Window = 7
+	}
+
+	if options.Threshold <= 0 {
+		options.Threshold = 3
+
+		if options.Method == CUSUMDrift {
+			options.Threshold = 5
+		}
+	}
+
+	if options.Slack <= 0 {
+		options.Slack = 0.5
+	}
+
+	if options.MinRecords <= 0 {
+		options.MinRecords = 1
+	}
+
+	return options, nil
+}
+
+// BucketRecords groups the records by time, records without a time are skipped and empty buckets left out
+func BucketRecords(records []Record, bucketSize time.Duration) []Bucket {
+	bucketsByStart := make(map[time.Time]*Bucket)
+
+	for _, record := range records {
+		if record.Time.IsZero() {
+			continue
+		}
+
+		start := record.Time.Truncate(bucketSize)
+		bucket, ok := bucketsByStart[start]
+
+		if !ok {
+			bucket = &Bucket{Start: start}
+			bucketsByStart[start] = bucket
+		}
+
+		bucket.records = append(bucket.records, record)
+	}
+
+	buckets := make([]Bucket, 0)
+
+	for _, bucket := range bucketsByStart {
+		negative := 0
+		scoreSum := 0.0
+
+		for _, record := range bucket.records {
+			scoreSum += float64(record.Sentiment.Score)
+
+			if record.Sentiment.ParsedSentiment == "negative" {
+				negative++
+			}
+		}
+
+		bucket.Count = len(bucket.records)
+		bucket.MeanScore = scoreSum / float64(bucket.Count)
+		bucket.NegativeShare = float64(negative) / float64(bucket.Count)
+
+		buckets = append(buckets, *bucket)
+	}
+
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Start.Before(buckets[j].Start)
+	})
+
+	return buckets
+}
+
+// drivers are the records pulling the bucket in direction, the lowest scores for a drop in score
+// or a rise in negative share and the highest scores otherwise
+func (bucket Bucket) drivers(metric string, direction string) []string {
+	records := make([]Record, len(bucket.records))
+	copy(records, bucket.records)
+
+	lowestFirst := (metric == MeanScoreMetric && direction == "down") || (metric == NegativeShareMetric && direction == "up")
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if lowestFirst {
+			return records[i].Sentiment.Score < records[j].Sentiment.Score
+		}
+
+		return records[i].Sentiment.Score > records[j].Sentiment.Score
+	})
+
+	drivers := make([]string, 0)
+
+	for i := 0; i < len(records) && i < maxDrivers; i++ {
+		drivers = append(drivers, records[i].ID)
+	}
+
+	return drivers
+}
+
+func metricValue(bucket Bucket, metric string) float64 {
+	if metric == NegativeShareMetric {
+		return bucket.NegativeShare
+	}
+
+	return bucket.MeanScore
+}
+
+func direction(deviation float64) string {
+	if deviation < 0 {
+		return "down"
+	}
+
+	return "up"
+}
+
+func detectZScore(buckets []Bucket, metric string, options DriftOptions) []Anomaly {
+	anomalies := make([]Anomaly, 0)
+
+	for i := options.Window; i < len(buckets); i++ {
+		baseline := make([]float64, 0)
+
+		for _, bucket := range buckets[i-options.Window : i] {
+			baseline = append(baseline, metricValue(bucket, metric))
+		}
+
+		mean, stdDev := meanStdDev(baseline)
+		stdDev = math.Max(stdDev, minStdDev)
+
+		value := metricValue(buckets[i], metric)
+		zScore := (value - mean) / stdDev
+
+		if math.Abs(zScore) < options.Threshold {
+			continue
+		}
+
+		anomalies = append(anomalies, Anomaly{
+			Bucket:    buckets[i].Start,
+			Metric:    metric,
+			Value:     value,
+			Expected:  mean,
+			Magnitude: zScore,
+			Direction: direction(zScore),
+			Drivers:   buckets[i].drivers(metric, direction(zScore)),
+		})
+	}
+
+	return anomalies
+}
+
+// detectCUSUM runs a two sided CUSUM standardized by the first Window buckets, it restarts after each anomaly
+func detectCUSUM(buckets []Bucket, metric string, options DriftOptions) []Anomaly {
+	anomalies := make([]Anomaly, 0)
+
+	if len(buckets) <= options.Window {
+		return anomalies
+	}
+
+	baseline := make([]float64, 0)
+
+	for _, bucket := range buckets[:options.Window] {
+		baseline = append(baseline, metricValue(bucket, metric))
+	}
+
+	mean, stdDev := meanStdDev(baseline)
+	stdDev = math.Max(stdDev, minStdDev)
+
+	upper := 0.0
+	lower := 0.0
+
+	for i := options.Window; i < len(buckets); i++ {
+		value := metricValue(buckets[i], metric)
+		zScore := (value - mean) / stdDev
+
+		upper = math.Max(0, upper+zScore-options.Slack)
+		lower = math.Max(0, lower-zScore-options.Slack)
+
+		if upper < options.Threshold && lower < options.Threshold {
+			continue
+		}
+
+		magnitude := upper
+
+		if lower > upper {
+			magnitude = -lower
+		}
+
+		anomalies = append(anomalies, Anomaly{
+			Bucket:    buckets[i].Start,
+			Metric:    metric,
+			Value:     value,
+			Expected:  mean,
+			Magnitude: magnitude,
+			Direction: direction(magnitude),
+			Drivers:   buckets[i].drivers(metric, direction(magnitude)),
+		})
+
+		upper = 0
+		lower = 0
+	}
+
+	return anomalies
+}
+
+// DetectDrift buckets the records by time and looks for shifts of the mean score and the negative share
+func DetectDrift(records []Record, options DriftOptions) ([]Bucket, []Anomaly, error) {
+	options, err := options.withDefaults()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	allBuckets := BucketRecords(records, time.Duration(options.BucketSize))
+	buckets := make([]Bucket, 0)
+
+	for _, bucket := range allBuckets {
+		if bucket.Count >= options.MinRecords {
+			buckets = append(buckets, bucket)
+		}
+	}
+
+	anomalies := make([]Anomaly, 0)
+
+	for _, metric := range []string{MeanScoreMetric, NegativeShareMetric} {
+		if options.Method == CUSUMDrift {
+			anomalies = append(anomalies, detectCUSUM(buckets, metric, options)...)
+		} else {
+			anomalies = append(anomalies, detectZScore(buckets, metric, options)...)
+		}
+	}
+
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		return anomalies[i].Bucket.Before(anomalies[j].Bucket)
+	})
+
+	return buckets, anomalies, nil
+}
@@ -0,0 +1,121 @@
+package sentiment
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dailyRecords are count records a day, scored by the score of their day
+func dailyRecords(count int, scores ...float32) []Record {
+	records := make([]Record, 0)
+
+	for day, score := range scores {
+		for i := 0; i < count; i++ {
+			records = append(records, alertRecord(fmt.Sprintf("%d-%d", day, i), day*24+i, score, parseSentiment(score)))
+		}
+	}
+
+	return records
+}
+
+func TestDetectDrift(t *testing.T) {
+	tests := []struct {
+		name          string
+		records       []Record
+		options       DriftOptions
+		wantBuckets   int
+		wantAnomalies []string
+		wantErr       bool
+	}{
+		{
+			name:          "finds a drop after a steady baseline",
+			records:       dailyRecords(2, 0.5, 0.5, 0.5, -0.5),
+			options:       DriftOptions{Window: 3},
+			wantBuckets:   4,
+			wantAnomalies: []string{"meanScore down 3-0,3-1", "negativeShare up 3-0,3-1"},
+		},
+		{
+			name:        "finds nothing in a steady run",
+			records:     dailyRecords(2, 0.5, 0.5, 0.5, 0.5),
+			options:     DriftOptions{Window: 3},
+			wantBuckets: 4,
+		},
+		{
+			name:        "needs more buckets than the window",
+			records:     dailyRecords(2, 0.5, -0.5),
+			options:     DriftOptions{Window: 3},
+			wantBuckets: 2,
+		},
+		{
+			name:          "accumulates the shift with cusum",
+			records:       dailyRecords(2, 0.5, 0.5, 0.5, -0.5),
+			options:       DriftOptions{Method: CUSUMDrift, Window: 3},
+			wantBuckets:   4,
+			wantAnomalies: []string{"meanScore down 3-0,3-1", "negativeShare up 3-0,3-1"},
+		},
+		{
+			name:        "leaves out the buckets with too few records",
+			records:     append(dailyRecords(2, 0.5, 0.5, 0.5), alertRecord("late", 3*24, -0.5, "negative")),
+			options:     DriftOptions{Window: 3, MinRecords: 2},
+			wantBuckets: 3,
+		},
+		{
+			name:    "rejects an unknown method",
+			options: DriftOptions{Method: "ewma"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buckets, anomalies, err := DetectDrift(test.records, test.options)
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if len(buckets) != test.wantBuckets {
+				t.Errorf("got %d buckets, want %d", len(buckets), test.wantBuckets)
+			}
+
+			got := make([]string, 0)
+
+			for _, anomaly := range anomalies {
+				got = append(got, anomaly.Metric+" "+anomaly.Direction+" "+strings.Join(anomaly.Drivers, ","))
+			}
+
+			if strings.Join(got, "|") != strings.Join(test.wantAnomalies, "|") {
+				t.Errorf("got anomalies %v, want %v", got, test.wantAnomalies)
+			}
+		})
+	}
+}
+
+func TestBucketRecords(t *testing.T) {
+	records := []Record{
+		alertRecord("a", 1, 0.5, "positive"),
+		alertRecord("b", 30, -0.5, "negative"),
+		alertRecord("c", 2, -0.3, "negative"),
+		{ID: "untimed"},
+	}
+
+	buckets := BucketRecords(records, 24*time.Hour)
+
+	if len(buckets) != 2 {
+		t.Fatalf("got %d buckets, want 2", len(buckets))
+	}
+
+	if buckets[0].Count != 2 || buckets[0].NegativeShare != 0.5 || buckets[1].Count != 1 {
+		t.Errorf("got buckets %+v", buckets)
+	}
+
+	if !buckets[0].Start.Before(buckets[1].Start) {
+		t.Errorf("buckets are not ordered by time")
+	}
+}
@@ -0,0 +1,222 @@
+package sentiment
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Emotion is one of the basic emotions the lexicon classifies text into
+type Emotion string
+
+const (
+	Anger    Emotion = "anger"
+	Joy      Emotion = "joy"
+	Sadness  Emotion = "sadness"
+	Fear     Emotion = "fear"
+	Surprise Emotion = "surprise"
+	Disgust  Emotion = "disgust"
+	Trust    Emotion = "trust"
+)
+
+// Emotions are all the emotions classified, ties for the dominant emotion go to the first one
+var Emotions = []Emotion{Anger, Joy, Sadness, Fear, Surprise, Disgust, Trust}
+
+// EmotionLexicon maps a lowercase word to the emotions it is associated with
+type EmotionLexicon map[string][]Emotion
+
+// EmotionScores is the share of the emotional words of a text per emotion, the scores add up to 1
+type EmotionScores struct {
+	Scores   map[Emotion]float64 `json:"scores"`
+	Dominant Emotion             `json:"dominant,omitempty"`
+}
+
+// EmotionSummary sums up the emotions of many texts
+type EmotionSummary struct {
+	Dominant   map[Emotion]int     `json:"dominant"`
+	MeanScores map[Emotion]float64 `json:"meanScores"`
+}
+
+// negations flip the meaning of the next word, so it does not count
+var negations = map[string]bool{
+	"not": true, "no": true, "never": true, "dont": true, "don't": true, "didnt": true, "didn't": true,
+	"isnt": true, "isn't": true, "wasnt": true, "wasn't": true, "cant": true, "can't": true, "wont": true, "won't": true,
+}
+
+// DefaultEmotionLexicon is a small built-in lexicon of common words, load a full lexicon
+// such as the NRC Emotion Lexicon with ParseEmotionLexicon for better coverage
+func DefaultEmotionLexicon() EmotionLexicon {
+	lexicon := make(EmotionLexicon)
+
+	for emotion, words := range defaultEmotionWords {
+		for _, word := range words {
+			lexicon[word] = append(lexicon[word], emotion)
+		}
+	}
+
+	return lexicon
+}
+
+// ParseEmotionLexicon reads a lexicon in the NRC word level format: "word<tab>emotion<tab>0 or 1" per line.
+// emotions this package does not classify, such as anticipation, are skipped
+func ParseEmotionLexicon(r io.Reader) (EmotionLexicon, error) {
+	lexicon := make(EmotionLexicon)
+	known := make(map[Emotion]bool)
+
+	for _, emotion := range Emotions {
+		known[emotion] = true
+	}
+
+	scanner := bufio.NewScanner(r)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+
+		if len(fields) != 3 {
+			return lexicon, fmt.Errorf("line %d of the emotion lexicon must be \"word emotion association\"", lineNumber)
+		}
+
+		emotion := Emotion(strings.ToLower(fields[1]))
+
+		if !known[emotion] || fields[2] != "1" {
+			continue
+		}
+
+		word := strings.ToLower(fields[0])
+
+		lexicon[word] = append(lexicon[word], emotion)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return lexicon, fmt.Errorf("reading emotion lexicon failed: %v", err)
+	}
+
+	return lexicon, nil
+}
+
+// lookup finds the emotions of word, trying a few common suffixes when the word itself is unknown
+func (lexicon EmotionLexicon) lookup(word string) []Emotion {
+	if emotions, ok := lexicon[word]; ok {
+		return emotions
+	}
+
+	for _, suffix := range []string{"s", "es", "ed", "d", "ing", "ly"} {
+		if emotions, ok := lexicon[strings.TrimSuffix(word, suffix)]; ok && strings.HasSuffix(word, suffix) {
+			return emotions
+		}
+	}
+
+	return nil
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+}
+
+// Classify scores text by the emotions of its words, words right after a negation are skipped
+func (lexicon EmotionLexicon) Classify(text string) EmotionScores {
+	counts := make(map[Emotion]float64)
+	total := 0.0
+	negated := false
+
+	for _, word := range tokenize(text) {
+		if negations[word] {
+			negated = true
+
+			continue
+		}
+
+		if negated {
+			negated = false
+
+			continue
+		}
+
+		for _, emotion := range lexicon.lookup(word) {
+			counts[emotion]++
+			total++
+		}
+	}
+
+	scores := EmotionScores{
+		Scores: make(map[Emotion]float64),
+	}
+
+	for _, emotion := range Emotions {
+		if total > 0 {
+			scores.Scores[emotion] = counts[emotion] / total
+		} else {
+			scores.Scores[emotion] = 0
+		}
+
+		if counts[emotion] > 0 && (scores.Dominant == "" || counts[emotion] > counts[scores.Dominant]) {
+			scores.Dominant = emotion
+		}
+	}
+
+	return scores
+}
+
+// ClassifyPostEmotions classifies the title and body of each post
+func ClassifyPostEmotions(posts []RedditPost, lexicon EmotionLexicon) []RedditPost {
+	for i := 0; i < len(posts); i++ {
+		scores := lexicon.Classify(posts[i].Title + "\n" + posts[i].Body)
+
+		posts[i].Analysis.Emotion = &scores
+	}
+
+	return posts
+}
+
+// ClassifyCustomerEmotions classifies the comment of each customer
+func ClassifyCustomerEmotions(comments []CustomerAnalysis, lexicon EmotionLexicon) []CustomerAnalysis {
+	for i := 0; i < len(comments); i++ {
+		scores := lexicon.Classify(comments[i].Comment)
+
+		comments[i].Emotion = &scores
+	}
+
+	return comments
+}
+
+// SummarizeEmotions counts the dominant emotions and averages the scores, nil scores are skipped
+func SummarizeEmotions(emotions []*EmotionScores) EmotionSummary {
+	summary := EmotionSummary{
+		Dominant:   make(map[Emotion]int),
+		MeanScores: make(map[Emotion]float64),
+	}
+
+	count := 0
+
+	for _, scores := range emotions {
+		if scores == nil {
+			continue
+		}
+
+		count++
+
+		if scores.Dominant != "" {
+			summary.Dominant[scores.Dominant]++
+		}
+
+		for emotion, score := range scores.Scores {
+			summary.MeanScores[emotion] += score
+		}
+	}
+
+	for emotion := range summary.MeanScores {
+		summary.MeanScores[emotion] /= float64(count)
+	}
+
+	return summary
+}
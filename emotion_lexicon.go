@@ -0,0 +1,38 @@
+package sentiment
+
+// defaultEmotionWords are the words of the built-in emotion lexicon, a word may carry several emotions
+var defaultEmotionWords = map[Emotion][]string{
+	Anger: {
+		"angry", "anger", "furious", "rage", "mad", "annoyed", "annoying", "irritated", "outrage", "outraged",
+		"hate", "hostile", "frustrated", "frustrating", "livid", "infuriating", "unacceptable", "ridiculous",
+		"scam", "rude", "insult", "yell", "fight", "terrible", "worst", "awful", "damn", "pissed",
+	},
+	Joy: {
+		"happy", "joy", "glad", "love", "lovely", "great", "excellent", "amazing", "awesome", "wonderful",
+		"delighted", "pleased", "enjoy", "fun", "fantastic", "perfect", "excited", "thrilled", "smile",
+		"celebrate", "beautiful", "best", "good", "nice", "cheerful", "satisfied", "grateful", "thanks",
+	},
+	Sadness: {
+		"sad", "unhappy", "disappointed", "disappointing", "disappointment", "sorry", "miss", "lost", "lonely",
+		"depressed", "cry", "tears", "regret", "unfortunately", "heartbroken", "grief", "hurt", "broken",
+		"worst", "awful", "terrible", "gloomy", "miserable", "down",
+	},
+	Fear: {
+		"afraid", "fear", "scared", "scary", "worried", "worry", "anxious", "nervous", "panic", "terrified",
+		"risk", "danger", "dangerous", "threat", "unsafe", "concerned", "concern", "doubt", "uncertain",
+		"horrible", "creepy", "dread",
+	},
+	Surprise: {
+		"surprise", "surprised", "surprising", "unexpected", "unexpectedly", "shocked", "shocking", "amazed",
+		"astonished", "sudden", "suddenly", "wow", "whoa", "unbelievable", "incredible", "omg",
+	},
+	Disgust: {
+		"disgusting", "disgusted", "gross", "nasty", "filthy", "dirty", "vile", "revolting", "sick", "awful",
+		"horrible", "yuck", "ew", "smell", "stink", "rotten", "cheap", "garbage", "trash", "crap",
+	},
+	Trust: {
+		"trust", "reliable", "honest", "safe", "secure", "dependable", "recommend", "loyal", "faithful",
+		"confident", "guarantee", "professional", "helpful", "support", "fair", "quality", "consistent",
+		"sure", "true", "promise",
+	},
+}
@@ -0,0 +1,144 @@
+package sentiment
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	lexicon := EmotionLexicon{
+		"happy":  {Joy},
+		"angry":  {Anger},
+		"awful":  {Anger, Disgust},
+		"smell":  {Disgust},
+		"worry":  {Fear},
+		"refund": {Trust},
+	}
+
+	tests := []struct {
+		name         string
+		text         string
+		wantScores   map[Emotion]float64
+		wantDominant Emotion
+	}{
+		{
+			name:         "shares the scores among the emotional words",
+			text:         "Happy, happy and ANGRY",
+			wantScores:   map[Emotion]float64{Joy: 2.0 / 3, Anger: 1.0 / 3},
+			wantDominant: Joy,
+		},
+		{
+			name:         "counts every emotion of a word",
+			text:         "an awful smell",
+			wantScores:   map[Emotion]float64{Anger: 1.0 / 3, Disgust: 2.0 / 3},
+			wantDominant: Disgust,
+		},
+		{
+			name:         "skips the word after a negation",
+			text:         "i'm not happy, i'm angry",
+			wantScores:   map[Emotion]float64{Anger: 1},
+			wantDominant: Anger,
+		},
+		{
+			name:         "finds words by their suffix",
+			text:         "worrying about my refunds",
+			wantScores:   map[Emotion]float64{Fear: 0.5, Trust: 0.5},
+			wantDominant: Fear,
+		},
+		{
+			name:       "scores nothing without emotional words",
+			text:       "the package arrived on tuesday",
+			wantScores: map[Emotion]float64{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scores := lexicon.Classify(test.text)
+
+			if len(scores.Scores) != len(Emotions) {
+				t.Errorf("got scores %v, want a score for every emotion", scores.Scores)
+			}
+
+			for _, emotion := range Emotions {
+				if math.Abs(scores.Scores[emotion]-test.wantScores[emotion]) > 1e-9 {
+					t.Errorf("%s: got score %v, want %v", emotion, scores.Scores[emotion], test.wantScores[emotion])
+				}
+			}
+
+			if scores.Dominant != test.wantDominant {
+				t.Errorf("got dominant \"%s\", want \"%s\"", scores.Dominant, test.wantDominant)
+			}
+		})
+	}
+}
+
+func TestParseEmotionLexicon(t *testing.T) {
+	tests := []struct {
+		name    string
+		lexicon string
+		want    EmotionLexicon
+		wantErr bool
+	}{
+		{
+			name:    "reads the associated emotions and skips the unknown ones",
+			lexicon: "# nrc\nabandon\tfear\t1\nabandon\tjoy\t0\nabandon\tsadness\t1\nabandon\tanticipation\t1\n\nHappy\tJoy\t1\n",
+			want:    EmotionLexicon{"abandon": {Fear, Sadness}, "happy": {Joy}},
+		},
+		{
+			name:    "rejects a line without three fields",
+			lexicon: "abandon\tfear\n",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lexicon, err := ParseEmotionLexicon(strings.NewReader(test.lexicon))
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if len(lexicon) != len(test.want) {
+				t.Fatalf("got lexicon %v, want %v", lexicon, test.want)
+			}
+
+			for word, emotions := range test.want {
+				if len(lexicon[word]) != len(emotions) {
+					t.Errorf("%s: got emotions %v, want %v", word, lexicon[word], emotions)
+
+					continue
+				}
+
+				for i := 0; i < len(emotions); i++ {
+					if lexicon[word][i] != emotions[i] {
+						t.Errorf("%s: got emotions %v, want %v", word, lexicon[word], emotions)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSummarizeEmotions(t *testing.T) {
+	lexicon := DefaultEmotionLexicon()
+
+	happy := lexicon.Classify("happy")
+	angry := lexicon.Classify("furious")
+
+	summary := SummarizeEmotions([]*EmotionScores{&happy, nil, &angry, &happy})
+
+	if summary.Dominant[Joy] != 2 || summary.Dominant[Anger] != 1 {
+		t.Errorf("got dominant emotions %v, want 2 joy and 1 anger", summary.Dominant)
+	}
+
+	if math.Abs(summary.MeanScores[Joy]-2.0/3) > 1e-9 || math.Abs(summary.MeanScores[Anger]-1.0/3) > 1e-9 {
+		t.Errorf("got mean scores %v, want 2/3 joy and 1/3 anger", summary.MeanScores)
+	}
+}
@@ -0,0 +1,362 @@
+package sentiment
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OutputFormat is the file format analyzed records are written in
+type OutputFormat string
+
+const (
+	NDJSONFormat OutputFormat = "ndjson"
+	CSVFormat    OutputFormat = "csv"
+	TSVFormat    OutputFormat = "tsv"
+
+	// BigQueryFormat is ndjson shaped to a generated schema, so it loads into BigQuery as is
+	BigQueryFormat OutputFormat = "bigquery"
+
+	// ParquetFormat is columnar and compressed, entities and other lists are repeated groups
+	ParquetFormat OutputFormat = "parquet"
+)
+
+// EntityLayout is how the entity lists are flattened into a table
+type EntityLayout string
+
+const (
+	// EntityColumns joins the keywords, counts and scores of the entities into three columns
+	EntityColumns EntityLayout = "columns"
+	// EntityLongFormat writes the entities to a separate table, one row per record and entity
+	EntityLongFormat EntityLayout = "long"
+)
+
+// listSeparator joins the values of a list within a single cell
+const listSeparator = "; "
+
+// ParseOutputFormat reads an output format, an empty format is ndjson
+func ParseOutputFormat(format string) (OutputFormat, error) {
+	switch OutputFormat(strings.ToLower(format)) {
+	case "", NDJSONFormat, "json":
+		return NDJSONFormat, nil
+	case CSVFormat:
+		return CSVFormat, nil
+	case TSVFormat:
+		return TSVFormat, nil
+	case BigQueryFormat:
+		return BigQueryFormat, nil
+	case ParquetFormat:
+		return ParquetFormat, nil
+	}
+
+	return "", fmt.Errorf("unknown output format \"%s\", must be ndjson, csv, tsv, bigquery or parquet", format)
+}
+
+// Extension is the file extension of the format
+func (format OutputFormat) Extension() string {
+	if format == NDJSONFormat {
+		return ".json"
+	}
+
+	// the analysis itself is saved as .json
+	if format == BigQueryFormat {
+		return ".ndjson"
+	}
+
+	return "." + string(format)
+}
+
+// IsTable checks if the format is delimited text
+func (format OutputFormat) IsTable() bool {
+	return format == CSVFormat || format == TSVFormat
+}
+
+// ParseEntityLayout reads an entity layout, an empty layout is columns
+func ParseEntityLayout(layout string) (EntityLayout, error) {
+	switch EntityLayout(strings.ToLower(layout)) {
+	case "", EntityColumns:
+		return EntityColumns, nil
+	case EntityLongFormat:
+		return EntityLongFormat, nil
+	}
+
+	return "", fmt.Errorf("unknown entity layout \"%s\", must be columns or long", layout)
+}
+
+// Table is a header and rows of text ready to be written as csv or tsv
+type Table struct {
+	Header []string
+	Rows   [][]string
+}
+
+// Write writes the table delimited by the format, spreadsheets read both
+func (table Table) Write(w io.Writer, format OutputFormat) error {
+	writer := csv.NewWriter(w)
+
+	if format == TSVFormat {
+		writer.Comma = '\t'
+	} else if format != CSVFormat {
+		return fmt.Errorf("%s is not a table format", format)
+	}
+
+	if err := writer.Write(escapeCells(table.Header)); err != nil {
+		return fmt.Errorf("writing table failed: %v", err)
+	}
+
+	for _, row := range table.Rows {
+		if err := writer.Write(escapeCells(row)); err != nil {
+			return fmt.Errorf("writing table failed: %v", err)
+		}
+	}
+
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("writing table failed: %v", err)
+	}
+
+	return nil
+}
+
+// escapeCells prefixes the cells spreadsheets would run as a formula with a quote, e.g. =HYPERLINK(...) in a comment
+// numbers and lists of numbers like negative scores are left alone
+func escapeCells(cells []string) []string {
+	escaped := make([]string, len(cells))
+
+	for i := 0; i < len(cells); i++ {
+		escaped[i] = cells[i]
+
+		if cells[i] == "" || !strings.ContainsAny(cells[i][:1], "=+-@") || isNumberList(cells[i]) {
+			continue
+		}
+
+		escaped[i] = "'" + cells[i]
+	}
+
+	return escaped
+}
+
+// isNumberList checks if every value of the cell is a number
+func isNumberList(cell string) bool {
+	for _, value := range strings.Split(cell, listSeparator) {
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func formatScore(score float32) string {
+	return strconv.FormatFloat(float64(score), 'f', -1, 32)
+}
+
+// entityCells are the keywords, counts and scores of the entities, each joined in a single cell
+func entityCells(entities []EntityWrapper) []string {
+	keywords := make([]string, 0)
+	counts := make([]string, 0)
+	scores := make([]string, 0)
+
+	for _, entity := range entities {
+		keywords = append(keywords, entity.Keyword)
+		counts = append(counts, strconv.Itoa(entity.Count))
+		scores = append(scores, formatScore(entity.Score))
+	}
+
+	return []string{
+		strings.Join(keywords, listSeparator),
+		strings.Join(counts, listSeparator),
+		strings.Join(scores, listSeparator),
+	}
+}
+
+var entityHeader = []string{"entities", "entityCounts", "entityScores"}
+
+// entityTable has a row per record and entity, the long format of the entities
+func entityTable(idColumn string) Table {
+	return Table{
+		Header: []string{idColumn, "keyword", "count", "score"},
+		Rows:   make([][]string, 0),
+	}
+}
+
+func (table *Table) addEntityRows(id string, entities []EntityWrapper) {
+	for _, entity := range entities {
+		table.Rows = append(table.Rows, []string{id, entity.Keyword, strconv.Itoa(entity.Count), formatScore(entity.Score)})
+	}
+}
+
+func dominantEmotion(emotion *EmotionScores) string {
+	if emotion == nil {
+		return ""
+	}
+
+	return string(emotion.Dominant)
+}
+
+// PostTables flattens analyzed posts, the entities table is only filled in the long layout
+func PostTables(posts []AnalysisWrapper, layout EntityLayout) (Table, Table) {
+	table := Table{
+		Header: []string{"id", "score", "sentiment", "emotion", "signalScore", "sarcasm", "shouting", "cluster", "clusterLabel"},
+		Rows:   make([][]string, 0),
+	}
+
+	entities := entityTable("id")
+
+	if layout == EntityColumns {
+		table.Header = append(table.Header, entityHeader...)
+	}
+
+	for i := 0; i < len(posts); i++ {
+		post := posts[i]
+
+		row := []string{post.ID, formatScore(post.Sentiment.Score), post.Sentiment.ParsedSentiment, dominantEmotion(post.Emotion)}
+
+		if post.Signals != nil {
+			row = append(row, formatScore(post.Signals.Score), strconv.FormatBool(post.Signals.Sarcasm), strconv.FormatBool(post.Signals.Shouting))
+		} else {
+			row = append(row, "", "", "")
+		}
+
+		if post.Cluster != nil {
+			row = append(row, strconv.Itoa(post.Cluster.ID), post.Cluster.Label)
+		} else {
+			row = append(row, "", "")
+		}
+
+		if layout == EntityColumns {
+			row = append(row, entityCells(post.Entity)...)
+		} else {
+			entities.addEntityRows(post.ID, post.Entity)
+		}
+
+		table.Rows = append(table.Rows, row)
+	}
+
+	return table, entities
+}
+
+// CustomerTables flattens analyzed customer comments, a column is added for each passthrough column.
+// the comments are keyed by CustomerKey in the entities table, which is only filled in the long layout
+func CustomerTables(comments []CustomerAnalysis, layout EntityLayout) (Table, Table) {
+	extraColumns := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, comment := range comments {
+		for column := range comment.Extra {
+			if !seen[column] {
+				seen[column] = true
+				extraColumns = append(extraColumns, column)
+			}
+		}
+	}
+
+	sort.Strings(extraColumns)
+
+	table := Table{
+		Header: []string{"timestamp", "email", "comment", "rating", "score", "sentiment", "emotion", "aspects", "redactions"},
+		Rows:   make([][]string, 0),
+	}
+
+	entities := entityTable("key")
+
+	if layout == EntityColumns {
+		table.Header = append(table.Header, entityHeader...)
+	}
+
+	table.Header = append(table.Header, extraColumns...)
+
+	for _, comment := range comments {
+		rating := ""
+
+		if comment.Rating != nil {
+			rating = strconv.FormatFloat(*comment.Rating, 'f', -1, 64)
+		}
+
+		aspects := make([]string, 0)
+
+		for _, aspect := range comment.Aspects {
+			aspects = append(aspects, aspect.Aspect+":"+aspect.ParsedSentiment)
+		}
+
+		redactions := 0
+
+		for _, redaction := range comment.Redactions {
+			redactions += redaction.Count
+		}
+
+		row := []string{
+			comment.Timestamp,
+			comment.Email,
+			comment.Comment,
+			rating,
+			formatScore(comment.Sentiment.Score),
+			comment.Sentiment.ParsedSentiment,
+			dominantEmotion(comment.Emotion),
+			strings.Join(aspects, listSeparator),
+			strconv.Itoa(redactions),
+		}
+
+		if layout == EntityColumns {
+			row = append(row, entityCells(comment.Entity)...)
+		} else {
+			entities.addEntityRows(CustomerKey(comment), comment.Entity)
+		}
+
+		for _, column := range extraColumns {
+			row = append(row, comment.Extra[column])
+		}
+
+		table.Rows = append(table.Rows, row)
+	}
+
+	return table, entities
+}
+
+// WritePosts writes analyzed posts in format, the original posts give bigquery and parquet rows their creation time.
+// in the long layout of csv and tsv the entities table goes to entities, which may be nil to leave it out
+func WritePosts(w io.Writer, entities io.Writer, posts []AnalysisWrapper, originals []RedditPost, format OutputFormat, layout EntityLayout) error {
+	switch format {
+	case NDJSONFormat:
+		return WriteNDJSON(w, posts)
+	case BigQueryFormat:
+		return WriteNDJSON(w, BigQueryPostRows(posts, originals))
+	case ParquetFormat:
+		return WriteParquet(w, ParquetPostRows(posts, originals))
+	}
+
+	table, entityRows := PostTables(posts, layout)
+
+	return writeTables(w, entities, table, entityRows, format, layout)
+}
+
+// WriteCustomerComments writes analyzed customer comments in format, like WritePosts
+func WriteCustomerComments(w io.Writer, entities io.Writer, comments []CustomerAnalysis, format OutputFormat, layout EntityLayout) error {
+	switch format {
+	case NDJSONFormat:
+		return WriteNDJSON(w, comments)
+	case BigQueryFormat:
+		return WriteNDJSON(w, BigQueryCustomerRows(comments))
+	case ParquetFormat:
+		return WriteParquet(w, ParquetCustomerRows(comments))
+	}
+
+	table, entityRows := CustomerTables(comments, layout)
+
+	return writeTables(w, entities, table, entityRows, format, layout)
+}
+
+func writeTables(w io.Writer, entities io.Writer, table Table, entityRows Table, format OutputFormat, layout EntityLayout) error {
+	if err := table.Write(w, format); err != nil {
+		return err
+	}
+
+	if layout != EntityLongFormat || entities == nil {
+		return nil
+	}
+
+	return entityRows.Write(entities, format)
+}
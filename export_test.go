@@ -0,0 +1,97 @@
+package sentiment
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEscapeCells(t *testing.T) {
+	tests := []struct {
+		name string
+		cell string
+		want string
+	}{
+		{name: "keeps text", cell: "the soup was cold", want: "the soup was cold"},
+		{name: "keeps an empty cell", cell: "", want: ""},
+		{name: "escapes a formula", cell: "=HYPERLINK(\"http://evil\")", want: "'=HYPERLINK(\"http://evil\")"},
+		{name: "escapes a plus", cell: "+1+cmd|' /C calc'!A0", want: "'+1+cmd|' /C calc'!A0"},
+		{name: "escapes an at", cell: "@SUM(A1)", want: "'@SUM(A1)"},
+		{name: "escapes a dash that is not a number", cell: "-- great", want: "'-- great"},
+		{name: "keeps a negative score", cell: "-0.5", want: "-0.5"},
+		{name: "keeps a list of scores", cell: "-0.5; 0.2; -1", want: "-0.5; 0.2; -1"},
+		{name: "escapes a list hiding a formula", cell: "-0.5; =1+1", want: "'-0.5; =1+1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if escaped := escapeCells([]string{test.cell})[0]; escaped != test.want {
+				t.Errorf("got %s, want %s", escaped, test.want)
+			}
+		})
+	}
+}
+
+func TestWriteCustomerComments(t *testing.T) {
+	rating := 2.0
+
+	comments := []CustomerAnalysis{
+		{
+			Timestamp: "2021-01-01",
+			Comment:   "=cmd, \"quoted\"",
+			Rating:    &rating,
+			Sentiment: SentimentWrapper{Score: -0.5, ParsedSentiment: "negative"},
+			Entity:    []EntityWrapper{{Keyword: "soup", Count: 2, Score: -0.5}},
+			Extra:     map[string]string{"store": "Paris"},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		format       OutputFormat
+		layout       EntityLayout
+		wantLines    []string
+		wantEntities []string
+	}{
+		{
+			name:   "writes the entities as columns of csv",
+			format: CSVFormat,
+			layout: EntityColumns,
+			wantLines: []string{
+				"timestamp,email,comment,rating,score,sentiment,emotion,aspects,redactions,entities,entityCounts,entityScores,store",
+				"2021-01-01,,\"'=cmd, \"\"quoted\"\"\",2,-0.5,negative,,,0,soup,2,-0.5,Paris",
+			},
+		},
+		{
+			name:   "writes the entities to their own tsv table",
+			format: TSVFormat,
+			layout: EntityLongFormat,
+			wantLines: []string{
+				"timestamp\temail\tcomment\trating\tscore\tsentiment\temotion\taspects\tredactions\tstore",
+				"2021-01-01\t\t\"'=cmd, \"\"quoted\"\"\"\t2\t-0.5\tnegative\t\t\t0\tParis",
+			},
+			wantEntities: []string{
+				"key\tkeyword\tcount\tscore",
+				CustomerKey(comments[0]) + "\tsoup\t2\t-0.5",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var output, entities bytes.Buffer
+
+			if err := WriteCustomerComments(&output, &entities, comments, test.format, test.layout); err != nil {
+				t.Fatalf("writing failed: %v", err)
+			}
+
+			if got := strings.TrimSpace(output.String()); got != strings.Join(test.wantLines, "\n") {
+				t.Errorf("got:\n%s\nwant:\n%s", got, strings.Join(test.wantLines, "\n"))
+			}
+
+			if got := strings.TrimSpace(entities.String()); got != strings.Join(test.wantEntities, "\n") {
+				t.Errorf("got entities:\n%s\nwant:\n%s", got, strings.Join(test.wantEntities, "\n"))
+			}
+		})
+	}
+}
@@ -6,5 +6,10 @@ require (
 	cloud.google.com/go v0.84.0
 	cloud.google.com/go/pubsub v1.3.1
 	cloud.google.com/go/storage v1.10.0
+	github.com/googleapis/gax-go/v2 v2.0.5
+	github.com/xitongsys/parquet-go v1.6.2
+	google.golang.org/api v0.48.0
 	google.golang.org/genproto v0.0.0-20210608205507-b6d2f5bf0d7d
+	google.golang.org/grpc v1.38.0
+	google.golang.org/protobuf v1.26.0
 )
@@ -0,0 +1,269 @@
+package sentiment
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// GraphNode is an entity of the co-occurrence graph
+type GraphNode struct {
+	ID        string  `json:"id"`
+	Label     string  `json:"label"`
+	Records   int     `json:"records"`
+	Mentions  int     `json:"mentions"`
+	MeanScore float64 `json:"meanScore"`
+}
+
+// the records listed on an edge, its weight still counts all of them
+const maxEdgeRecordIDs = 10
+
+// GraphEdge links two entities mentioned in the same records, Weight is the amount of those records
+// and MeanScore the average entity score of both entities across them, RecordIDs are the first of them
+type GraphEdge struct {
+	Source    string   `json:"source"`
+	Target    string   `json:"target"`
+	Weight    int      `json:"weight"`
+	MeanScore float64  `json:"meanScore"`
+	RecordIDs []string `json:"recordIds"`
+}
+
+// EntityGraph is which entities are discussed together and with what tone
+type EntityGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+type graphNodeTotals struct {
+	node     GraphNode
+	scoreSum float64
+}
+
+type graphEdgeTotals struct {
+	edge     GraphEdge
+	scoreSum float64
+}
+
+// mergeSpellings adds up the mentions of two spellings of an entity, the first spelling is kept
+func mergeSpellings(first EntityWrapper, second EntityWrapper) EntityWrapper {
+	merged := EntityWrapper{
+		Keyword: first.Keyword,
+		Count:   first.Count + second.Count,
+	}
+
+	if merged.Count > 0 {
+		merged.Score = (first.Score*float32(first.Count) + second.Score*float32(second.Count)) / float32(merged.Count)
+	} else {
+		merged.Score = (first.Score + second.Score) / 2
+	}
+
+	return merged
+}
+
+// BuildEntityGraph links the entities of each record with each other, entities are matched case insensitive.
+// edges co-mentioned in fewer than minWeight records are left out, as are the entities left without an edge
+func BuildEntityGraph(records []Record, minWeight int) EntityGraph {
+	nodes := make(map[string]*graphNodeTotals)
+	edges := make(map[[2]string]*graphEdgeTotals)
+
+	for _, record := range records {
+		entities := make(map[string]EntityWrapper)
+
+		for _, entity := range record.Entity {
+			id := strings.ToLower(strings.TrimSpace(entity.Keyword))
+
+			if id == "" {
+				continue
+			}
+
+			// the same entity may be listed under several spellings, its score is averaged over their mentions
+			if existing, ok := entities[id]; ok {
+				entity = mergeSpellings(existing, entity)
+			}
+
+			entities[id] = entity
+		}
+
+		ids := make([]string, 0)
+
+		for id, entity := range entities {
+			totals, ok := nodes[id]
+
+			if !ok {
+				totals = &graphNodeTotals{node: GraphNode{ID: id, Label: entity.Keyword}}
+				nodes[id] = totals
+			}
+
+			totals.node.Records++
+			totals.node.Mentions += entity.Count
+			totals.scoreSum += float64(entity.Score)
+
+			ids = append(ids, id)
+		}
+
+		sort.Strings(ids)
+
+		for i := 0; i < len(ids); i++ {
+			for j := i + 1; j < len(ids); j++ {
+				key := [2]string{ids[i], ids[j]}
+				totals, ok := edges[key]
+
+				if !ok {
+					totals = &graphEdgeTotals{edge: GraphEdge{Source: ids[i], Target: ids[j], RecordIDs: make([]string, 0)}}
+					edges[key] = totals
+				}
+
+				totals.edge.Weight++
+
+				if len(totals.edge.RecordIDs) < maxEdgeRecordIDs {
+					totals.edge.RecordIDs = append(totals.edge.RecordIDs, record.ID)
+				}
+
+				totals.scoreSum += float64(entities[ids[i]].Score+entities[ids[j]].Score) / 2
+			}
+		}
+	}
+
+	graph := EntityGraph{
+		Nodes: make([]GraphNode, 0),
+		Edges: make([]GraphEdge, 0),
+	}
+
+	linked := make(map[string]bool)
+
+	for _, totals := range edges {
+		if totals.edge.Weight < minWeight {
+			continue
+		}
+
+		totals.edge.MeanScore = totals.scoreSum / float64(totals.edge.Weight)
+
+		linked[totals.edge.Source] = true
+		linked[totals.edge.Target] = true
+
+		graph.Edges = append(graph.Edges, totals.edge)
+	}
+
+	for id, totals := range nodes {
+		if !linked[id] {
+			continue
+		}
+
+		totals.node.MeanScore = totals.scoreSum / float64(totals.node.Records)
+
+		graph.Nodes = append(graph.Nodes, totals.node)
+	}
+
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		if graph.Nodes[i].Records != graph.Nodes[j].Records {
+			return graph.Nodes[i].Records > graph.Nodes[j].Records
+		}
+
+		return graph.Nodes[i].ID < graph.Nodes[j].ID
+	})
+
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].Weight != graph.Edges[j].Weight {
+			return graph.Edges[i].Weight > graph.Edges[j].Weight
+		}
+
+		if graph.Edges[i].Source != graph.Edges[j].Source {
+			return graph.Edges[i].Source < graph.Edges[j].Source
+		}
+
+		return graph.Edges[i].Target < graph.Edges[j].Target
+	})
+
+	return graph
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLDocument struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+// WriteGraphML writes the graph as GraphML, which Gephi, Cytoscape and yEd open
+func (graph EntityGraph) WriteGraphML(w io.Writer) error {
+	document := graphMLDocument{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "label", For: "node", Name: "label", Type: "string"},
+			{ID: "records", For: "node", Name: "records", Type: "int"},
+			{ID: "mentions", For: "node", Name: "mentions", Type: "int"},
+			{ID: "nodeScore", For: "node", Name: "meanScore", Type: "double"},
+			{ID: "weight", For: "edge", Name: "weight", Type: "int"},
+			{ID: "edgeScore", For: "edge", Name: "meanScore", Type: "double"},
+		},
+	}
+
+	document.Graph.ID = "entities"
+	document.Graph.EdgeDefault = "undirected"
+
+	for _, node := range graph.Nodes {
+		document.Graph.Nodes = append(document.Graph.Nodes, graphMLNode{
+			ID: node.ID,
+			Data: []graphMLData{
+				{Key: "label", Value: node.Label},
+				{Key: "records", Value: fmt.Sprint(node.Records)},
+				{Key: "mentions", Value: fmt.Sprint(node.Mentions)},
+				{Key: "nodeScore", Value: fmt.Sprint(node.MeanScore)},
+			},
+		})
+	}
+
+	for _, edge := range graph.Edges {
+		document.Graph.Edges = append(document.Graph.Edges, graphMLEdge{
+			Source: edge.Source,
+			Target: edge.Target,
+			Data: []graphMLData{
+				{Key: "weight", Value: fmt.Sprint(edge.Weight)},
+				{Key: "edgeScore", Value: fmt.Sprint(edge.MeanScore)},
+			},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	if err := encoder.Encode(document); err != nil {
+		return fmt.Errorf("writing graphml failed: %v", err)
+	}
+
+	return nil
+}
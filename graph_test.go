@@ -0,0 +1,131 @@
+package sentiment
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// graphRecord is a record mentioning the entities
+func graphRecord(id string, entities ...EntityWrapper) Record {
+	return Record{ID: id, Entity: entities}
+}
+
+func TestBuildEntityGraph(t *testing.T) {
+	tests := []struct {
+		name       string
+		records    []Record
+		minWeight  int
+		wantNodes  []string
+		wantEdges  []string
+		wantScores map[string]float64
+	}{
+		{
+			name: "links the entities of each record",
+			records: []Record{
+				graphRecord("a", EntityWrapper{Keyword: "Pizza", Count: 1, Score: 0.8}, EntityWrapper{Keyword: "oven", Count: 1, Score: 0.2}),
+				graphRecord("b", EntityWrapper{Keyword: "pizza", Count: 1, Score: 0.4}, EntityWrapper{Keyword: "oven", Count: 1, Score: 0}),
+				graphRecord("c", EntityWrapper{Keyword: "pizza", Count: 1, Score: 0.4}, EntityWrapper{Keyword: "delivery", Count: 1, Score: -0.6}),
+			},
+			minWeight:  1,
+			wantNodes:  []string{"pizza", "oven", "delivery"},
+			wantEdges:  []string{"oven-pizza:2", "delivery-pizza:1"},
+			wantScores: map[string]float64{"oven-pizza": 0.35, "delivery-pizza": -0.1},
+		},
+		{
+			name: "leaves out light edges and the entities left alone",
+			records: []Record{
+				graphRecord("a", EntityWrapper{Keyword: "pizza", Count: 1}, EntityWrapper{Keyword: "oven", Count: 1}),
+				graphRecord("b", EntityWrapper{Keyword: "pizza", Count: 1}, EntityWrapper{Keyword: "oven", Count: 1}),
+				graphRecord("c", EntityWrapper{Keyword: "pizza", Count: 1}, EntityWrapper{Keyword: "delivery", Count: 1}),
+			},
+			minWeight: 2,
+			wantNodes: []string{"pizza", "oven"},
+			wantEdges: []string{"oven-pizza:2"},
+		},
+		{
+			name: "averages the score over the mentions of merged spellings",
+			records: []Record{
+				graphRecord("a",
+					EntityWrapper{Keyword: "Pizza", Count: 1, Score: 0.8},
+					EntityWrapper{Keyword: "pizza ", Count: 3, Score: 0},
+					EntityWrapper{Keyword: "oven", Count: 1, Score: 0.4},
+				),
+			},
+			minWeight:  1,
+			wantNodes:  []string{"oven", "pizza"},
+			wantEdges:  []string{"oven-pizza:1"},
+			wantScores: map[string]float64{"pizza": 0.2, "oven-pizza": 0.3},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			graph := BuildEntityGraph(test.records, test.minWeight)
+
+			nodes := make([]string, 0)
+			scores := make(map[string]float64)
+
+			for _, node := range graph.Nodes {
+				nodes = append(nodes, node.ID)
+				scores[node.ID] = node.MeanScore
+			}
+
+			edges := make([]string, 0)
+
+			for _, edge := range graph.Edges {
+				key := edge.Source + "-" + edge.Target
+				edges = append(edges, fmt.Sprintf("%s:%d", key, edge.Weight))
+				scores[key] = edge.MeanScore
+			}
+
+			if strings.Join(nodes, ",") != strings.Join(test.wantNodes, ",") {
+				t.Errorf("got nodes %v, want %v", nodes, test.wantNodes)
+			}
+
+			if strings.Join(edges, ",") != strings.Join(test.wantEdges, ",") {
+				t.Errorf("got edges %v, want %v", edges, test.wantEdges)
+			}
+
+			for key, want := range test.wantScores {
+				if math.Abs(scores[key]-want) > 1e-6 {
+					t.Errorf("%s: got mean score %v, want %v", key, scores[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildEntityGraphCapsRecordIDs(t *testing.T) {
+	records := make([]Record, 0)
+
+	for i := 0; i < maxEdgeRecordIDs+5; i++ {
+		records = append(records, graphRecord(fmt.Sprint(i), EntityWrapper{Keyword: "pizza", Count: 1}, EntityWrapper{Keyword: "oven", Count: 1}))
+	}
+
+	graph := BuildEntityGraph(records, 1)
+
+	if graph.Edges[0].Weight != maxEdgeRecordIDs+5 || len(graph.Edges[0].RecordIDs) != maxEdgeRecordIDs {
+		t.Errorf("got weight %d with %d record ids, want %d with %d", graph.Edges[0].Weight, len(graph.Edges[0].RecordIDs), maxEdgeRecordIDs+5, maxEdgeRecordIDs)
+	}
+}
+
+func TestWriteGraphML(t *testing.T) {
+	graph := BuildEntityGraph([]Record{
+		graphRecord("a", EntityWrapper{Keyword: "Fish & Chips", Count: 1}, EntityWrapper{Keyword: "oven", Count: 1}),
+	}, 1)
+
+	var output bytes.Buffer
+
+	if err := graph.WriteGraphML(&output); err != nil {
+		t.Fatalf("writing failed: %v", err)
+	}
+
+	for _, want := range []string{`<node id="fish &amp; chips">`, `<edge source="fish &amp; chips" target="oven">`, `<data key="weight">1</data>`} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("graphml does not hold %s:\n%s", want, output.String())
+		}
+	}
+}
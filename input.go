@@ -0,0 +1,58 @@
+package sentiment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ReadRedditPosts reads scraped reddit posts as one json post per line, a json array of posts
+// or a Posts object with hot and top posts, json values may follow each other in any of these shapes
+func ReadRedditPosts(r io.Reader) ([]RedditPost, error) {
+	posts := make([]RedditPost, 0)
+	decoder := json.NewDecoder(r)
+
+	for decoder.More() {
+		var value json.RawMessage
+
+		if err := decoder.Decode(&value); err != nil {
+			return posts, fmt.Errorf("parsing json failed: %v", err)
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(string(value)), "[") {
+			var array []RedditPost
+
+			if err := json.Unmarshal(value, &array); err != nil {
+				return posts, fmt.Errorf("parsing json failed: %v", err)
+			}
+
+			posts = append(posts, array...)
+
+			continue
+		}
+
+		var scraped Posts
+
+		if err := json.Unmarshal(value, &scraped); err != nil {
+			return posts, fmt.Errorf("parsing json failed: %v", err)
+		}
+
+		if len(scraped.HotPosts) > 0 || len(scraped.TopPosts) > 0 {
+			posts = append(posts, scraped.HotPosts...)
+			posts = append(posts, scraped.TopPosts...)
+
+			continue
+		}
+
+		var post RedditPost
+
+		if err := json.Unmarshal(value, &post); err != nil {
+			return posts, fmt.Errorf("parsing json failed: %v", err)
+		}
+
+		posts = append(posts, post)
+	}
+
+	return posts, nil
+}
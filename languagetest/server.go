@@ -0,0 +1,248 @@
+// Package languagetest provides an in-process fake of Google's Natural Language api,
+// so the sentiment library and the app-engine handlers can run without Google's services
+package languagetest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	language "cloud.google.com/go/language/apiv1"
+	"google.golang.org/api/option"
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+	"google.golang.org/grpc"
+)
+
+// Call is a single request the fake server received
+type Call struct {
+	Method string
+	Text   string
+}
+
+type sentimentReply struct {
+	response *languagepb.AnalyzeSentimentResponse
+	err      error
+}
+
+type entitySentimentReply struct {
+	response *languagepb.AnalyzeEntitySentimentResponse
+	err      error
+}
+
+// Server implements the parts of the LanguageService used by the sentiment library.
+// Queued replies are served first in order, after that SentimentFunc and EntitySentimentFunc
+// answer the requests and when those are nil an empty analysis is returned
+type Server struct {
+	languagepb.UnimplementedLanguageServiceServer
+
+	// Addr is the host:port the server is listening on
+	Addr string
+
+	// SentimentFunc answers AnalyzeSentiment requests once the queue is empty
+	SentimentFunc func(text string) (*languagepb.AnalyzeSentimentResponse, error)
+
+	// EntitySentimentFunc answers AnalyzeEntitySentiment requests once the queue is empty
+	EntitySentimentFunc func(text string) (*languagepb.AnalyzeEntitySentimentResponse, error)
+
+	mu                     sync.Mutex
+	latency                time.Duration
+	sentimentReplies       []sentimentReply
+	entitySentimentReplies []entitySentimentReply
+	calls                  []Call
+
+	listener   net.Listener
+	grpcServer *grpc.Server
+}
+
+// NewServer starts a fake server listening on a random local port
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		return nil, fmt.Errorf("listening failed: %v", err)
+	}
+
+	server := &Server{
+		Addr:       listener.Addr().String(),
+		listener:   listener,
+		grpcServer: grpc.NewServer(),
+	}
+
+	languagepb.RegisterLanguageServiceServer(server.grpcServer, server)
+
+	go server.grpcServer.Serve(listener)
+
+	return server, nil
+}
+
+// ClientOptions are the options needed for a language client to talk to the server listening on addr
+func ClientOptions(addr string) []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(addr),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithInsecure()),
+	}
+}
+
+// NewClient creates a language client connected to the fake server
+func (server *Server) NewClient(ctx context.Context) (*language.Client, error) {
+	return language.NewClient(ctx, ClientOptions(server.Addr)...)
+}
+
+// Close stops the server immediately
+func (server *Server) Close() {
+	server.grpcServer.Stop()
+}
+
+// SetLatency delays every reply by latency, or until the request is cancelled
+func (server *Server) SetLatency(latency time.Duration) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.latency = latency
+}
+
+// QueueSentiment scripts the reply of the next AnalyzeSentiment request
+func (server *Server) QueueSentiment(response *languagepb.AnalyzeSentimentResponse, err error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.sentimentReplies = append(server.sentimentReplies, sentimentReply{response, err})
+}
+
+// QueueEntitySentiment scripts the reply of the next AnalyzeEntitySentiment request
+func (server *Server) QueueEntitySentiment(response *languagepb.AnalyzeEntitySentimentResponse, err error) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.entitySentimentReplies = append(server.entitySentimentReplies, entitySentimentReply{response, err})
+}
+
+// Calls returns every request received so far
+func (server *Server) Calls() []Call {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	calls := make([]Call, len(server.calls))
+	copy(calls, server.calls)
+
+	return calls
+}
+
+// receive records the call and waits out the latency
+func (server *Server) receive(ctx context.Context, method string, document *languagepb.Document) error {
+	server.mu.Lock()
+	server.calls = append(server.calls, Call{
+		Method: method,
+		Text:   document.GetContent(),
+	})
+	latency := server.latency
+	server.mu.Unlock()
+
+	if latency == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(latency)
+
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// AnalyzeSentiment serves the next queued reply or asks SentimentFunc
+func (server *Server) AnalyzeSentiment(ctx context.Context, req *languagepb.AnalyzeSentimentRequest) (*languagepb.AnalyzeSentimentResponse, error) {
+	if err := server.receive(ctx, "AnalyzeSentiment", req.Document); err != nil {
+		return nil, err
+	}
+
+	server.mu.Lock()
+
+	if len(server.sentimentReplies) > 0 {
+		reply := server.sentimentReplies[0]
+		server.sentimentReplies = server.sentimentReplies[1:]
+		server.mu.Unlock()
+
+		return reply.response, reply.err
+	}
+
+	sentimentFunc := server.SentimentFunc
+	server.mu.Unlock()
+
+	if sentimentFunc != nil {
+		return sentimentFunc(req.Document.GetContent())
+	}
+
+	return &languagepb.AnalyzeSentimentResponse{
+		DocumentSentiment: &languagepb.Sentiment{},
+	}, nil
+}
+
+// AnalyzeEntitySentiment serves the next queued reply or asks EntitySentimentFunc
+func (server *Server) AnalyzeEntitySentiment(ctx context.Context, req *languagepb.AnalyzeEntitySentimentRequest) (*languagepb.AnalyzeEntitySentimentResponse, error) {
+	if err := server.receive(ctx, "AnalyzeEntitySentiment", req.Document); err != nil {
+		return nil, err
+	}
+
+	server.mu.Lock()
+
+	if len(server.entitySentimentReplies) > 0 {
+		reply := server.entitySentimentReplies[0]
+		server.entitySentimentReplies = server.entitySentimentReplies[1:]
+		server.mu.Unlock()
+
+		return reply.response, reply.err
+	}
+
+	entitySentimentFunc := server.EntitySentimentFunc
+	server.mu.Unlock()
+
+	if entitySentimentFunc != nil {
+		return entitySentimentFunc(req.Document.GetContent())
+	}
+
+	return &languagepb.AnalyzeEntitySentimentResponse{}, nil
+}
+
+// SentimentResponse builds an AnalyzeSentiment reply with score for the whole document
+func SentimentResponse(score float32) *languagepb.AnalyzeSentimentResponse {
+	return &languagepb.AnalyzeSentimentResponse{
+		DocumentSentiment: &languagepb.Sentiment{
+			Score: score,
+		},
+	}
+}
+
+// Entity builds an entity with a mention for every score
+func Entity(name string, scores ...float32) *languagepb.Entity {
+	entity := &languagepb.Entity{
+		Name: name,
+	}
+
+	for _, score := range scores {
+		entity.Mentions = append(entity.Mentions, &languagepb.EntityMention{
+			Text: &languagepb.TextSpan{
+				Content: name,
+			},
+			Sentiment: &languagepb.Sentiment{
+				Score: score,
+			},
+		})
+	}
+
+	return entity
+}
+
+// EntitySentimentResponse builds an AnalyzeEntitySentiment reply with entities
+func EntitySentimentResponse(entities ...*languagepb.Entity) *languagepb.AnalyzeEntitySentimentResponse {
+	return &languagepb.AnalyzeEntitySentimentResponse{
+		Entities: entities,
+	}
+}
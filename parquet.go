@@ -0,0 +1,221 @@
+package sentiment
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// the amount of goroutines the parquet writer encodes with
+const parquetParallelism = 4
+
+type ParquetEntity struct {
+	Keyword string  `parquet:"name=keyword, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Count   int64   `parquet:"name=count, type=INT64"`
+	Score   float32 `parquet:"name=score, type=FLOAT"`
+}
+
+type ParquetEmotion struct {
+	Emotion string  `parquet:"name=emotion, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Score   float64 `parquet:"name=score, type=DOUBLE"`
+}
+
+type ParquetAspect struct {
+	Aspect    string  `parquet:"name=aspect, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Score     float32 `parquet:"name=score, type=FLOAT"`
+	Sentiment string  `parquet:"name=sentiment, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Mentions  int64   `parquet:"name=mentions, type=INT64"`
+}
+
+type ParquetRedaction struct {
+	Detector string `parquet:"name=detector, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Count    int64  `parquet:"name=count, type=INT64"`
+}
+
+type ParquetExtra struct {
+	Column string `parquet:"name=column, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Value  string `parquet:"name=value, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+// ParquetPostRow is an analyzed post as a row of a parquet file, the columns match BigQueryPostRow
+type ParquetPostRow struct {
+	ID              string           `parquet:"name=id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	CreatedAt       *int64           `parquet:"name=created_at, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+	Score           float32          `parquet:"name=score, type=FLOAT"`
+	Sentiment       string           `parquet:"name=sentiment, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Entities        []ParquetEntity  `parquet:"name=entities, repetitiontype=REPEATED"`
+	DominantEmotion *string          `parquet:"name=dominant_emotion, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Emotions        []ParquetEmotion `parquet:"name=emotions, repetitiontype=REPEATED"`
+	SignalScore     *float32         `parquet:"name=signal_score, type=FLOAT, repetitiontype=OPTIONAL"`
+	RawScore        *float32         `parquet:"name=raw_score, type=FLOAT, repetitiontype=OPTIONAL"`
+	Sarcasm         *bool            `parquet:"name=sarcasm, type=BOOLEAN, repetitiontype=OPTIONAL"`
+	Shouting        *bool            `parquet:"name=shouting, type=BOOLEAN, repetitiontype=OPTIONAL"`
+	ClusterID       *int64           `parquet:"name=cluster_id, type=INT64, repetitiontype=OPTIONAL"`
+	ClusterLabel    *string          `parquet:"name=cluster_label, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+}
+
+// ParquetCustomerRow is an analyzed customer comment as a row of a parquet file, the columns match BigQueryCustomerRow
+type ParquetCustomerRow struct {
+	Key             string             `parquet:"name=key, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Timestamp       *int64             `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+	RawTimestamp    string             `parquet:"name=raw_timestamp, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Email           *string            `parquet:"name=email, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Comment         string             `parquet:"name=comment, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Rating          *float64           `parquet:"name=rating, type=DOUBLE, repetitiontype=OPTIONAL"`
+	Score           float32            `parquet:"name=score, type=FLOAT"`
+	Sentiment       string             `parquet:"name=sentiment, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Entities        []ParquetEntity    `parquet:"name=entities, repetitiontype=REPEATED"`
+	Aspects         []ParquetAspect    `parquet:"name=aspects, repetitiontype=REPEATED"`
+	DominantEmotion *string            `parquet:"name=dominant_emotion, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Emotions        []ParquetEmotion   `parquet:"name=emotions, repetitiontype=REPEATED"`
+	Redactions      []ParquetRedaction `parquet:"name=redactions, repetitiontype=REPEATED"`
+	Extra           []ParquetExtra     `parquet:"name=extra, repetitiontype=REPEATED"`
+}
+
+func parquetTime(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+
+	millis := t.UnixNano() / int64(time.Millisecond)
+
+	return &millis
+}
+
+// parquetString leaves empty strings null
+func parquetString(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
+
+func parquetEntities(entities []BigQueryEntity) []ParquetEntity {
+	rows := make([]ParquetEntity, 0)
+
+	for _, entity := range entities {
+		rows = append(rows, ParquetEntity{Keyword: entity.Keyword, Count: int64(entity.Count), Score: entity.Score})
+	}
+
+	return rows
+}
+
+func parquetEmotions(emotions []BigQueryEmotion) []ParquetEmotion {
+	rows := make([]ParquetEmotion, 0)
+
+	for _, emotion := range emotions {
+		rows = append(rows, ParquetEmotion{Emotion: emotion.Emotion, Score: emotion.Score})
+	}
+
+	return rows
+}
+
+// ParquetPostRows turns analyzed posts into rows, the creation time is taken from the original posts when given
+func ParquetPostRows(posts []AnalysisWrapper, originals []RedditPost) []ParquetPostRow {
+	rows := make([]ParquetPostRow, 0)
+
+	for _, post := range BigQueryPostRows(posts, originals) {
+		row := ParquetPostRow{
+			ID:              post.ID,
+			CreatedAt:       parquetTime(post.CreatedAt),
+			Score:           post.Score,
+			Sentiment:       post.Sentiment,
+			Entities:        parquetEntities(post.Entities),
+			DominantEmotion: parquetString(post.DominantEmotion),
+			Emotions:        parquetEmotions(post.Emotions),
+			SignalScore:     post.SignalScore,
+			RawScore:        post.RawScore,
+			Sarcasm:         post.Sarcasm,
+			Shouting:        post.Shouting,
+			ClusterLabel:    parquetString(post.ClusterLabel),
+		}
+
+		if post.ClusterID != nil {
+			clusterID := int64(*post.ClusterID)
+			row.ClusterID = &clusterID
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// ParquetCustomerRows turns analyzed customer comments into rows, keyed by CustomerKey
+func ParquetCustomerRows(comments []CustomerAnalysis) []ParquetCustomerRow {
+	rows := make([]ParquetCustomerRow, 0)
+
+	for _, comment := range BigQueryCustomerRows(comments) {
+		row := ParquetCustomerRow{
+			Key:             comment.Key,
+			Timestamp:       parquetTime(comment.Timestamp),
+			RawTimestamp:    comment.RawTimestamp,
+			Email:           parquetString(comment.Email),
+			Comment:         comment.Comment,
+			Rating:          comment.Rating,
+			Score:           comment.Score,
+			Sentiment:       comment.Sentiment,
+			Entities:        parquetEntities(comment.Entities),
+			Aspects:         make([]ParquetAspect, 0),
+			DominantEmotion: parquetString(comment.DominantEmotion),
+			Emotions:        parquetEmotions(comment.Emotions),
+			Redactions:      make([]ParquetRedaction, 0),
+			Extra:           make([]ParquetExtra, 0),
+		}
+
+		for _, aspect := range comment.Aspects {
+			row.Aspects = append(row.Aspects, ParquetAspect{
+				Aspect:    aspect.Aspect,
+				Score:     aspect.Score,
+				Sentiment: aspect.Sentiment,
+				Mentions:  int64(aspect.Mentions),
+			})
+		}
+
+		for _, redaction := range comment.Redactions {
+			row.Redactions = append(row.Redactions, ParquetRedaction{Detector: redaction.Detector, Count: int64(redaction.Count)})
+		}
+
+		for _, extra := range comment.Extra {
+			row.Extra = append(row.Extra, ParquetExtra{Column: extra.Column, Value: extra.Value})
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// WriteParquet writes the slice rows of ParquetPostRow or ParquetCustomerRow as a snappy compressed parquet file
+func WriteParquet(w io.Writer, rows interface{}) error {
+	value := reflect.ValueOf(rows)
+
+	if value.Kind() != reflect.Slice {
+		return fmt.Errorf("rows must be a slice, not %s", value.Kind())
+	}
+
+	parquetWriter, err := writer.NewParquetWriterFromWriter(w, reflect.New(value.Type().Elem()).Interface(), parquetParallelism)
+
+	if err != nil {
+		return fmt.Errorf("creating parquet writer failed: %v", err)
+	}
+
+	parquetWriter.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	for i := 0; i < value.Len(); i++ {
+		if err := parquetWriter.Write(value.Index(i).Interface()); err != nil {
+			return fmt.Errorf("writing row %d failed: %v", i, err)
+		}
+	}
+
+	if err := parquetWriter.WriteStop(); err != nil {
+		return fmt.Errorf("finishing parquet file failed: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,311 @@
+package sentiment
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// the widest bar of a chart
+const chartWidth = 40
+
+// labels in the order they are charted
+var sentimentLabels = []string{"positive", "neutral", "mixed", "negative"}
+
+// RecordSummary is the overall sentiment of analyzed records
+type RecordSummary struct {
+	Count     int            `json:"count"`
+	MeanScore float64        `json:"meanScore"`
+	StdDev    float64        `json:"stdDev"`
+	Labels    map[string]int `json:"labels"`
+
+	// Histogram counts the scores in 10 bins of 0.2 from -1 to 1
+	Histogram []int `json:"histogram"`
+}
+
+// EntityRank is an entity across all the records it was found in
+type EntityRank struct {
+	Keyword   string  `json:"keyword"`
+	Records   int     `json:"records"`
+	Mentions  int     `json:"mentions"`
+	MeanScore float64 `json:"meanScore"`
+}
+
+// RecordFilter selects records, zero values match every record
+type RecordFilter struct {
+	Label    string
+	MinScore *float32
+	MaxScore *float32
+
+	// Entity matches case insensitive on a part of the keyword
+	Entity string
+}
+
+// PrintAnalysis prints the results of the posts from the Sentiment Analysis api
+func PrintAnalysis(posts []RedditPost) {
+	FprintAnalysis(os.Stdout, posts)
+}
+
+// FprintAnalysis writes the id, title, body, sentiment and score of each post
+func FprintAnalysis(w io.Writer, posts []RedditPost) {
+	for i := 0; i < len(posts); i++ {
+		post := posts[i]
+
+		fmt.Fprintf(w, "post id: \"%s\"\n\ttitle: \"%s\"\n\tbody: \"%s\"\n\tsentiment for post: %s\n\tsentiment score: %f\n",
+			post.ID,
+			post.Title,
+			post.Body,
+			post.Analysis.Sentiment.ParsedSentiment,
+			post.Analysis.Sentiment.Score,
+		)
+	}
+}
+
+// PrintSentimentChart prints the sentiment analysis chart
+func PrintSentimentChart() {
+	FprintSentimentChart(os.Stdout)
+}
+
+// FprintSentimentChart writes how to interpret the scores
+func FprintSentimentChart(w io.Writer) {
+	fmt.Fprintf(w, "To interpret the scores:\n\tpositive: > 0.1\n\tnegative: < 0.0\n\tneutral: 0.1\n\tmixed: 0.0 - 0.1\n")
+}
+
+// FprintRecords writes the id, text, sentiment and score of each record
+func FprintRecords(w io.Writer, records []Record) {
+	for _, record := range records {
+		fmt.Fprintf(w, "id: \"%s\"\n", record.ID)
+
+		if record.Text != "" {
+			fmt.Fprintf(w, "\ttext: \"%s\"\n", record.Text)
+		}
+
+		fmt.Fprintf(w, "\tsentiment: %s\n\tscore: %f\n", record.Sentiment.ParsedSentiment, record.Sentiment.Score)
+
+		if len(record.Entity) > 0 {
+			keywords := make([]string, 0)
+
+			for _, entity := range record.Entity {
+				keywords = append(keywords, entity.Keyword)
+			}
+
+			fmt.Fprintf(w, "\tentities: %s\n", strings.Join(keywords, ", "))
+		}
+	}
+}
+
+// SummarizeRecords counts the labels and spreads the scores of the records
+func SummarizeRecords(records []Record) RecordSummary {
+	summary := RecordSummary{
+		Count:     len(records),
+		Labels:    make(map[string]int),
+		Histogram: make([]int, 10),
+	}
+
+	scores := make([]float64, 0)
+
+	for _, record := range records {
+		score := float64(record.Sentiment.Score)
+		scores = append(scores, score)
+
+		summary.Labels[record.Sentiment.ParsedSentiment]++
+
+		bin := int(math.Floor((score + 1) / 0.2))
+
+		if bin < 0 {
+			bin = 0
+		} else if bin > 9 {
+			bin = 9
+		}
+
+		summary.Histogram[bin]++
+	}
+
+	summary.MeanScore, summary.StdDev = meanStdDev(scores)
+
+	return summary
+}
+
+func bar(count int, max int) string {
+	if max == 0 {
+		return ""
+	}
+
+	return strings.Repeat("#", int(math.Round(float64(count)/float64(max)*chartWidth)))
+}
+
+// FprintReport writes the summary with a chart of the labels and of the scores
+func FprintReport(w io.Writer, summary RecordSummary) {
+	fmt.Fprintf(w, "records: %d\nmean score: %.3f\nstd dev: %.3f\n\n", summary.Count, summary.MeanScore, summary.StdDev)
+
+	maxLabel := 0
+	labels := append([]string{}, sentimentLabels...)
+
+	for label, count := range summary.Labels {
+		if count > maxLabel {
+			maxLabel = count
+		}
+
+		known := false
+
+		for _, sentimentLabel := range sentimentLabels {
+			known = known || label == sentimentLabel
+		}
+
+		if !known {
+			labels = append(labels, label)
+		}
+	}
+
+	fmt.Fprintln(w, "labels:")
+
+	for _, label := range labels {
+		count := summary.Labels[label]
+
+		if label == "" {
+			label = "(none)"
+		}
+
+		fmt.Fprintf(w, "  %-9s %5d %s\n", label, count, bar(count, maxLabel))
+	}
+
+	maxBin := 0
+
+	for _, count := range summary.Histogram {
+		if count > maxBin {
+			maxBin = count
+		}
+	}
+
+	fmt.Fprintln(w, "\nscores:")
+
+	for i, count := range summary.Histogram {
+		from := -1 + float64(i)*0.2
+
+		fmt.Fprintf(w, "  %+.1f..%+.1f %5d %s\n", from, from+0.2, count, bar(count, maxBin))
+	}
+
+	fmt.Fprintln(w)
+	FprintSentimentChart(w)
+}
+
+// TopRecords are the n most positive records, or the n most negative ones
+func TopRecords(records []Record, n int, negative bool) []Record {
+	sorted := make([]Record, len(records))
+	copy(sorted, records)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if negative {
+			return sorted[i].Sentiment.Score < sorted[j].Sentiment.Score
+		}
+
+		return sorted[i].Sentiment.Score > sorted[j].Sentiment.Score
+	})
+
+	if n > 0 && n < len(sorted) {
+		sorted = sorted[:n]
+	}
+
+	return sorted
+}
+
+// RankEntities ranks the entities by the amount of records they were found in, entities are matched case insensitive
+func RankEntities(records []Record) []EntityRank {
+	ranks := make(map[string]*EntityRank)
+	scoreSums := make(map[string]float64)
+
+	for _, record := range records {
+		for _, entity := range record.Entity {
+			key := strings.ToLower(entity.Keyword)
+			rank, ok := ranks[key]
+
+			if !ok {
+				rank = &EntityRank{Keyword: entity.Keyword}
+				ranks[key] = rank
+			}
+
+			rank.Records++
+			rank.Mentions += entity.Count
+			scoreSums[key] += float64(entity.Score)
+		}
+	}
+
+	ranked := make([]EntityRank, 0)
+
+	for key, rank := range ranks {
+		rank.MeanScore = scoreSums[key] / float64(rank.Records)
+
+		ranked = append(ranked, *rank)
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Records != ranked[j].Records {
+			return ranked[i].Records > ranked[j].Records
+		}
+
+		if ranked[i].Mentions != ranked[j].Mentions {
+			return ranked[i].Mentions > ranked[j].Mentions
+		}
+
+		return strings.ToLower(ranked[i].Keyword) < strings.ToLower(ranked[j].Keyword)
+	})
+
+	return ranked
+}
+
+// FprintEntities writes the ranked entities as an aligned table
+func FprintEntities(w io.Writer, ranks []EntityRank) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(table, "ENTITY\tRECORDS\tMENTIONS\tMEAN SCORE")
+
+	for _, rank := range ranks {
+		fmt.Fprintf(table, "%s\t%d\t%d\t%.3f\n", rank.Keyword, rank.Records, rank.Mentions, rank.MeanScore)
+	}
+
+	return table.Flush()
+}
+
+// Matches checks if the record passes the filter
+func (filter RecordFilter) Matches(record Record) bool {
+	if filter.Label != "" && !strings.EqualFold(filter.Label, record.Sentiment.ParsedSentiment) {
+		return false
+	}
+
+	if filter.MinScore != nil && record.Sentiment.Score < *filter.MinScore {
+		return false
+	}
+
+	if filter.MaxScore != nil && record.Sentiment.Score > *filter.MaxScore {
+		return false
+	}
+
+	if filter.Entity == "" {
+		return true
+	}
+
+	for _, entity := range record.Entity {
+		if strings.Contains(strings.ToLower(entity.Keyword), strings.ToLower(filter.Entity)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FilterRecords keeps the records that pass the filter
+func FilterRecords(records []Record, filter RecordFilter) []Record {
+	filtered := make([]Record, 0)
+
+	for _, record := range records {
+		if filter.Matches(record) {
+			filtered = append(filtered, record)
+		}
+	}
+
+	return filtered
+}
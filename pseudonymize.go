@@ -0,0 +1,73 @@
+package sentiment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// EmailPolicy decides what happens to a customer's email in the analyzed output
+type EmailPolicy string
+
+const (
+	// EmailPolicyKeep writes the email as is
+	EmailPolicyKeep EmailPolicy = "keep"
+	// EmailPolicyDrop removes the email
+	EmailPolicyDrop EmailPolicy = "drop"
+	// EmailPolicyPseudonymize replaces the email with a keyed HMAC, so the same customer
+	// can be tracked across files without exposing the address
+	EmailPolicyPseudonymize EmailPolicy = "pseudonymize"
+)
+
+// ParseEmailPolicy parses the name of a policy, an empty name keeps the email
+func ParseEmailPolicy(name string) (EmailPolicy, error) {
+	switch policy := EmailPolicy(strings.ToLower(name)); policy {
+	case "":
+		return EmailPolicyKeep, nil
+	case EmailPolicyKeep, EmailPolicyDrop, EmailPolicyPseudonymize:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown email policy \"%s\", must be one of keep, drop or pseudonymize", name)
+	}
+}
+
+// PseudonymizeEmail returns the hex HMAC-SHA256 of the normalized email keyed with key
+func PseudonymizeEmail(email string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(email))))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ApplyEmailPolicy keeps, drops or pseudonymizes the email of each comment
+// key is required to pseudonymize and must stay the same for the pseudonyms to match across files
+func ApplyEmailPolicy(comments []CustomerAnalysis, policy EmailPolicy, key []byte) ([]CustomerAnalysis, error) {
+	switch policy {
+	case EmailPolicyKeep:
+		return comments, nil
+	case EmailPolicyDrop:
+		for i := 0; i < len(comments); i++ {
+			comments[i].Email = ""
+		}
+
+		return comments, nil
+	case EmailPolicyPseudonymize:
+		if len(key) == 0 {
+			return comments, fmt.Errorf("pseudonymizing emails requires a key")
+		}
+
+		for i := 0; i < len(comments); i++ {
+			if comments[i].Email == "" {
+				continue
+			}
+
+			comments[i].Email = PseudonymizeEmail(comments[i].Email, key)
+		}
+
+		return comments, nil
+	default:
+		return comments, fmt.Errorf("unknown email policy \"%s\"", policy)
+	}
+}
@@ -0,0 +1,121 @@
+package sentiment
+
+import (
+	"testing"
+)
+
+func TestPseudonymizeEmail(t *testing.T) {
+	key := []byte("secret")
+
+	if PseudonymizeEmail(" Jane@Example.com ", key) != PseudonymizeEmail("jane@example.com", key) {
+		t.Errorf("the pseudonym of an email depends on its case and spaces")
+	}
+
+	if PseudonymizeEmail("jane@example.com", key) == PseudonymizeEmail("jane@example.com", []byte("other")) {
+		t.Errorf("the pseudonym of an email does not depend on the key")
+	}
+
+	if pseudonym := PseudonymizeEmail("jane@example.com", key); len(pseudonym) != 64 {
+		t.Errorf("got pseudonym \"%s\", want 64 hex digits", pseudonym)
+	}
+}
+
+func TestApplyEmailPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  EmailPolicy
+		key     string
+		emails  []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "keeps the emails",
+			policy: EmailPolicyKeep,
+			emails: []string{"jane@example.com", ""},
+			want:   []string{"jane@example.com", ""},
+		},
+		{
+			name:   "drops the emails",
+			policy: EmailPolicyDrop,
+			emails: []string{"jane@example.com", ""},
+			want:   []string{"", ""},
+		},
+		{
+			name:   "pseudonymizes the emails and leaves missing ones empty",
+			policy: EmailPolicyPseudonymize,
+			key:    "secret",
+			emails: []string{"jane@example.com", "", "JANE@example.com"},
+			want: []string{
+				PseudonymizeEmail("jane@example.com", []byte("secret")),
+				"",
+				PseudonymizeEmail("jane@example.com", []byte("secret")),
+			},
+		},
+		{
+			name:    "requires a key to pseudonymize",
+			policy:  EmailPolicyPseudonymize,
+			emails:  []string{"jane@example.com"},
+			wantErr: true,
+		},
+		{
+			name:    "rejects an unknown policy",
+			policy:  EmailPolicy("hash"),
+			emails:  []string{"jane@example.com"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			comments := make([]CustomerAnalysis, 0)
+
+			for _, email := range test.emails {
+				comments = append(comments, CustomerAnalysis{Email: email})
+			}
+
+			comments, err := ApplyEmailPolicy(comments, test.policy, []byte(test.key))
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			for i := 0; i < len(comments); i++ {
+				if comments[i].Email != test.want[i] {
+					t.Errorf("comment %d: got email \"%s\", want \"%s\"", i, comments[i].Email, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseEmailPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    EmailPolicy
+		wantErr bool
+	}{
+		{name: "", want: EmailPolicyKeep},
+		{name: "Drop", want: EmailPolicyDrop},
+		{name: "pseudonymize", want: EmailPolicyPseudonymize},
+		{name: "hash", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := ParseEmailPolicy(test.name)
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+
+			if policy != test.want {
+				t.Errorf("got policy \"%s\", want \"%s\"", policy, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package sentiment
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RatingScale is the range of the numeric rating customers give in the feedback form
+type RatingScale struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+var (
+	// NPSScale is the 0 - 10 "how likely are you to recommend us" scale
+	NPSScale = RatingScale{Min: 0, Max: 10}
+	// CSATScale is the 1 - 5 satisfaction scale
+	CSATScale = RatingScale{Min: 1, Max: 5}
+)
+
+// a rating in the top or bottom quarter of the scale disagrees with a negative or positive comment
+const disagreementThreshold = 0.25
+
+// ParseRatingScale parses "nps", "csat" or a "min-max" range such as "1-7"
+func ParseRatingScale(name string) (RatingScale, error) {
+	switch strings.ToLower(name) {
+	case "nps":
+		return NPSScale, nil
+	case "csat":
+		return CSATScale, nil
+	}
+
+	bounds := strings.SplitN(name, "-", 2)
+
+	if len(bounds) != 2 {
+		return RatingScale{}, fmt.Errorf("unknown rating scale \"%s\", must be nps, csat or min-max", name)
+	}
+
+	min, minErr := strconv.ParseFloat(bounds[0], 64)
+	max, maxErr := strconv.ParseFloat(bounds[1], 64)
+
+	if minErr != nil || maxErr != nil || min >= max {
+		return RatingScale{}, fmt.Errorf("invalid rating scale \"%s\", must be min-max with min < max", name)
+	}
+
+	return RatingScale{Min: min, Max: max}, nil
+}
+
+// InferRatingScale guesses NPS when a rating is above 5 or 0, otherwise CSAT
+func InferRatingScale(comments []CustomerAnalysis) RatingScale {
+	for i := 0; i < len(comments); i++ {
+		rating := comments[i].Rating
+
+		if rating != nil && (*rating > CSATScale.Max || *rating < CSATScale.Min) {
+			return NPSScale
+		}
+	}
+
+	return CSATScale
+}
+
+// normalize places rating between 0 and 1 on the scale
+func (scale RatingScale) normalize(rating float64) float64 {
+	return (rating - scale.Min) / (scale.Max - scale.Min)
+}
+
+// RatingDistribution describes the sentiment of the comments that gave the same rating
+type RatingDistribution struct {
+	Rating    float64        `json:"rating"`
+	Count     int            `json:"count"`
+	MeanScore float64        `json:"meanScore"`
+	MinScore  float64        `json:"minScore"`
+	MaxScore  float64        `json:"maxScore"`
+	StdDev    float64        `json:"stdDev"`
+	Labels    map[string]int `json:"labels"`
+}
+
+// Disagreement is a comment where the rating and the sentiment of the text contradict each other
+// e.g. 5 stars with a negative comment
+type Disagreement struct {
+	Timestamp string  `json:"timestamp"`
+	Email     string  `json:"email,omitempty"`
+	Comment   string  `json:"comment"`
+	Rating    float64 `json:"rating"`
+	Score     float32 `json:"score"`
+	Sentiment string  `json:"sentiment"`
+}
+
+// NPSCounts are the promoters, passives and detractors of a group of comments
+type NPSCounts struct {
+	Promoters  int `json:"promoters"`
+	Passives   int `json:"passives"`
+	Detractors int `json:"detractors"`
+}
+
+// NPSBreakdown is the net promoter score overall and per sentiment label
+type NPSBreakdown struct {
+	NPSCounts
+	Score   float64              `json:"score"`
+	ByLabel map[string]NPSCounts `json:"byLabel"`
+}
+
+// RatingReport correlates the ratings customers gave with the sentiment of their comments
+type RatingReport struct {
+	Scale         RatingScale          `json:"scale"`
+	Count         int                  `json:"count"`
+	Correlation   float64              `json:"correlation"`
+	Distributions []RatingDistribution `json:"distributions"`
+	Disagreements []Disagreement       `json:"disagreements"`
+	NPS           *NPSBreakdown        `json:"nps,omitempty"`
+}
+
+// ReportRatings builds the report from analyzed comments, comments without a rating are ignored.
+// the NPS breakdown is only included for the NPS scale
+func ReportRatings(comments []CustomerAnalysis, scale RatingScale) RatingReport {
+	report := RatingReport{
+		Scale:         scale,
+		Distributions: make([]RatingDistribution, 0),
+		Disagreements: make([]Disagreement, 0),
+	}
+
+	ratings := make([]float64, 0)
+	scores := make([]float64, 0)
+	scoresByRating := make(map[float64][]float64)
+	labelsByRating := make(map[float64]map[string]int)
+
+	if scale == NPSScale {
+		report.NPS = &NPSBreakdown{
+			ByLabel: make(map[string]NPSCounts),
+		}
+	}
+
+	for i := 0; i < len(comments); i++ {
+		comment := comments[i]
+
+		if comment.Rating == nil {
+			continue
+		}
+
+		rating := *comment.Rating
+		score := float64(comment.Sentiment.Score)
+		label := comment.Sentiment.ParsedSentiment
+
+		ratings = append(ratings, rating)
+		scores = append(scores, score)
+		scoresByRating[rating] = append(scoresByRating[rating], score)
+
+		if _, ok := labelsByRating[rating]; !ok {
+			labelsByRating[rating] = make(map[string]int)
+		}
+
+		labelsByRating[rating][label]++
+
+		normalized := scale.normalize(rating)
+
+		if (normalized >= 1-disagreementThreshold && label == "negative") || (normalized <= disagreementThreshold && label == "positive") {
+			report.Disagreements = append(report.Disagreements, Disagreement{
+				Timestamp: comment.Timestamp,
+				Email:     comment.Email,
+				Comment:   comment.Comment,
+				Rating:    rating,
+				Score:     comment.Sentiment.Score,
+				Sentiment: label,
+			})
+		}
+
+		if report.NPS != nil {
+			counts := report.NPS.ByLabel[label]
+			addNPS(&counts, rating)
+			report.NPS.ByLabel[label] = counts
+
+			addNPS(&report.NPS.NPSCounts, rating)
+		}
+	}
+
+	report.Count = len(ratings)
+	report.Correlation = pearson(ratings, scores)
+
+	for rating, ratingScores := range scoresByRating {
+		mean, stdDev := meanStdDev(ratingScores)
+		min, max := ratingScores[0], ratingScores[0]
+
+		for _, score := range ratingScores {
+			min = math.Min(min, score)
+			max = math.Max(max, score)
+		}
+
+		report.Distributions = append(report.Distributions, RatingDistribution{
+			Rating:    rating,
+			Count:     len(ratingScores),
+			MeanScore: mean,
+			MinScore:  min,
+			MaxScore:  max,
+			StdDev:    stdDev,
+			Labels:    labelsByRating[rating],
+		})
+	}
+
+	sort.Slice(report.Distributions, func(i, j int) bool {
+		return report.Distributions[i].Rating < report.Distributions[j].Rating
+	})
+
+	if report.NPS != nil && report.Count > 0 {
+		report.NPS.Score = 100 * float64(report.NPS.Promoters-report.NPS.Detractors) / float64(report.Count)
+	}
+
+	return report
+}
+
+// addNPS counts 9 - 10 as promoter, 7 - 8 as passive and 0 - 6 as detractor
+func addNPS(counts *NPSCounts, rating float64) {
+	if rating >= 9 {
+		counts.Promoters++
+	} else if rating >= 7 {
+		counts.Passives++
+	} else {
+		counts.Detractors++
+	}
+}
+
+func meanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+
+	sum := 0.0
+
+	for _, value := range values {
+		sum += value
+	}
+
+	mean := sum / float64(len(values))
+	variance := 0.0
+
+	for _, value := range values {
+		variance += (value - mean) * (value - mean)
+	}
+
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
+
+// pearson is the correlation coefficient of x and y, 0 when either does not vary
+func pearson(x []float64, y []float64) float64 {
+	meanX, stdDevX := meanStdDev(x)
+	meanY, stdDevY := meanStdDev(y)
+
+	if len(x) == 0 || stdDevX == 0 || stdDevY == 0 {
+		return 0
+	}
+
+	covariance := 0.0
+
+	for i := 0; i < len(x); i++ {
+		covariance += (x[i] - meanX) * (y[i] - meanY)
+	}
+
+	covariance /= float64(len(x))
+
+	return covariance / (stdDevX * stdDevY)
+}
@@ -0,0 +1,199 @@
+package sentiment
+
+import (
+	"math"
+	"testing"
+)
+
+func float64Pointer(value float64) *float64 {
+	return &value
+}
+
+// ratedComment is an analyzed comment with a rating, a nil rating leaves the comment unrated
+func ratedComment(rating *float64, score float32, label string) CustomerAnalysis {
+	return CustomerAnalysis{
+		Comment:   "comment",
+		Rating:    rating,
+		Sentiment: SentimentWrapper{Score: score, ParsedSentiment: label},
+	}
+}
+
+func TestParseRatingScale(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    RatingScale
+		wantErr bool
+	}{
+		{name: "NPS", want: NPSScale},
+		{name: "csat", want: CSATScale},
+		{name: "1-7", want: RatingScale{Min: 1, Max: 7}},
+		{name: "7-1", wantErr: true},
+		{name: "stars", wantErr: true},
+		{name: "1-many", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scale, err := ParseRatingScale(test.name)
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+
+			if scale != test.want {
+				t.Errorf("got scale %v, want %v", scale, test.want)
+			}
+		})
+	}
+}
+
+func TestInferRatingScale(t *testing.T) {
+	tests := []struct {
+		name    string
+		ratings []*float64
+		want    RatingScale
+	}{
+		{name: "csat without ratings", ratings: []*float64{nil}, want: CSATScale},
+		{name: "csat within 1 - 5", ratings: []*float64{float64Pointer(1), float64Pointer(5)}, want: CSATScale},
+		{name: "nps above 5", ratings: []*float64{float64Pointer(3), float64Pointer(9)}, want: NPSScale},
+		{name: "nps at 0", ratings: []*float64{float64Pointer(0), float64Pointer(3)}, want: NPSScale},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			comments := make([]CustomerAnalysis, 0)
+
+			for _, rating := range test.ratings {
+				comments = append(comments, ratedComment(rating, 0, "neutral"))
+			}
+
+			if scale := InferRatingScale(comments); scale != test.want {
+				t.Errorf("got scale %v, want %v", scale, test.want)
+			}
+		})
+	}
+}
+
+func TestReportRatings(t *testing.T) {
+	tests := []struct {
+		name              string
+		scale             RatingScale
+		comments          []CustomerAnalysis
+		wantCount         int
+		wantRatings       []float64
+		wantDisagreements int
+		wantNPS           *NPSBreakdown
+	}{
+		{
+			name:  "breaks the nps down per label",
+			scale: NPSScale,
+			comments: []CustomerAnalysis{
+				ratedComment(float64Pointer(10), 0.8, "positive"),
+				ratedComment(float64Pointer(9), 0.5, "positive"),
+				ratedComment(float64Pointer(7), 0, "neutral"),
+				ratedComment(float64Pointer(2), -0.6, "negative"),
+				ratedComment(float64Pointer(10), -0.7, "negative"),
+				ratedComment(nil, 0.9, "positive"),
+			},
+			wantCount:         5,
+			wantRatings:       []float64{2, 7, 9, 10},
+			wantDisagreements: 1,
+			wantNPS: &NPSBreakdown{
+				NPSCounts: NPSCounts{Promoters: 3, Passives: 1, Detractors: 1},
+				Score:     40,
+				ByLabel: map[string]NPSCounts{
+					"positive": {Promoters: 2},
+					"neutral":  {Passives: 1},
+					"negative": {Promoters: 1, Detractors: 1},
+				},
+			},
+		},
+		{
+			name:  "leaves the nps out of other scales",
+			scale: CSATScale,
+			comments: []CustomerAnalysis{
+				ratedComment(float64Pointer(1), 0.9, "positive"),
+				ratedComment(float64Pointer(3), 0, "neutral"),
+				ratedComment(float64Pointer(5), 0.9, "positive"),
+			},
+			wantCount:         3,
+			wantRatings:       []float64{1, 3, 5},
+			wantDisagreements: 1,
+		},
+		{
+			name:        "reports nothing without ratings",
+			scale:       NPSScale,
+			comments:    []CustomerAnalysis{ratedComment(nil, 0.9, "positive")},
+			wantRatings: []float64{},
+			wantNPS:     &NPSBreakdown{ByLabel: map[string]NPSCounts{}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := ReportRatings(test.comments, test.scale)
+
+			if report.Count != test.wantCount {
+				t.Errorf("got count %d, want %d", report.Count, test.wantCount)
+			}
+
+			if len(report.Distributions) != len(test.wantRatings) {
+				t.Fatalf("got distributions %v, want ratings %v", report.Distributions, test.wantRatings)
+			}
+
+			for i := 0; i < len(report.Distributions); i++ {
+				if report.Distributions[i].Rating != test.wantRatings[i] {
+					t.Errorf("distribution %d: got rating %v, want %v", i, report.Distributions[i].Rating, test.wantRatings[i])
+				}
+			}
+
+			if len(report.Disagreements) != test.wantDisagreements {
+				t.Errorf("got disagreements %v, want %d", report.Disagreements, test.wantDisagreements)
+			}
+
+			if (report.NPS == nil) != (test.wantNPS == nil) {
+				t.Fatalf("got nps %v, want %v", report.NPS, test.wantNPS)
+			}
+
+			if report.NPS == nil {
+				return
+			}
+
+			if report.NPS.NPSCounts != test.wantNPS.NPSCounts || report.NPS.Score != test.wantNPS.Score {
+				t.Errorf("got nps %+v, want %+v", *report.NPS, *test.wantNPS)
+			}
+
+			if len(report.NPS.ByLabel) != len(test.wantNPS.ByLabel) {
+				t.Errorf("got nps by label %v, want %v", report.NPS.ByLabel, test.wantNPS.ByLabel)
+			}
+
+			for label, counts := range test.wantNPS.ByLabel {
+				if report.NPS.ByLabel[label] != counts {
+					t.Errorf("%s: got nps %+v, want %+v", label, report.NPS.ByLabel[label], counts)
+				}
+			}
+		})
+	}
+}
+
+func TestPearson(t *testing.T) {
+	tests := []struct {
+		name string
+		x    []float64
+		y    []float64
+		want float64
+	}{
+		{name: "correlated", x: []float64{1, 2, 3}, y: []float64{0.1, 0.2, 0.3}, want: 1},
+		{name: "anti correlated", x: []float64{1, 2, 3}, y: []float64{3, 2, 1}, want: -1},
+		{name: "constant", x: []float64{1, 2, 3}, y: []float64{0.5, 0.5, 0.5}, want: 0},
+		{name: "empty", x: []float64{}, y: []float64{}, want: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := pearson(test.x, test.y); math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package sentiment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Record is an analyzed reddit post or customer comment reduced to what the reports look at
+type Record struct {
+	ID        string           `json:"id"`
+	Time      time.Time        `json:"time"`
+	Text      string           `json:"text,omitempty"`
+	Sentiment SentimentWrapper `json:"sentiment"`
+	Entity    []EntityWrapper  `json:"entity"`
+}
+
+// timestampLayouts are the formats customer feedback timestamps come in, Google Forms uses the second one
+var timestampLayouts = []string{
+	time.RFC3339,
+	"1/2/2006 15:04:05",
+	"1/2/2006 15:04",
+	"2006-01-02 15:04:05",
+	"2006/01/02 15:04:05",
+	"2006-01-02",
+	"1/2/2006",
+}
+
+// ParseTimestamp parses the timestamp of a customer comment in any of the known layouts
+func ParseTimestamp(timestamp string) (time.Time, error) {
+	timestamp = strings.TrimSpace(timestamp)
+
+	for _, layout := range timestampLayouts {
+		parsed, err := time.Parse(layout, timestamp)
+
+		if err == nil {
+			return parsed, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unknown timestamp format \"%s\"", timestamp)
+}
+
+// CustomerKey identifies a customer comment across files, customers do not get an id
+// the hash of the comment tells apart the comments sent at once, e.g. when the drop email policy removed the emails
+func CustomerKey(comment CustomerAnalysis) string {
+	commentHash := sha256.Sum256([]byte(comment.Comment))
+
+	return comment.Email + "|" + comment.Timestamp + "|" + hex.EncodeToString(commentHash[:8])
+}
+
+// PostRecords reduces analyzed reddit posts to records
+func PostRecords(posts []RedditPost) []Record {
+	records := make([]Record, 0)
+
+	for i := 0; i < len(posts); i++ {
+		post := posts[i]
+
+		record := Record{
+			ID:        post.ID,
+			Text:      strings.TrimSpace(post.Title + "\n" + post.Body),
+			Sentiment: post.Analysis.Sentiment,
+			Entity:    post.Analysis.Entity,
+		}
+
+		if post.CreatedAt != 0 {
+			record.Time = time.Unix(int64(post.CreatedAt), 0).UTC()
+		}
+
+		records = append(records, record)
+	}
+
+	return records
+}
+
+// customerRecordID identifies a comment within records, unlike CustomerKey it leaves out the email
+// since records leave the analyzed file through alerts and reports
+func customerRecordID(comment CustomerAnalysis) string {
+	commentHash := sha256.Sum256([]byte(comment.Comment))
+
+	return comment.Timestamp + "|" + hex.EncodeToString(commentHash[:8])
+}
+
+// CustomerRecords reduces analyzed customer comments to records, unparsable timestamps leave the time zero
+func CustomerRecords(comments []CustomerAnalysis) []Record {
+	records := make([]Record, 0)
+	keyCounts := make(map[string]int)
+
+	for i := 0; i < len(comments); i++ {
+		comment := comments[i]
+
+		// a comment without a known time is still worth looking at
+		timestamp, _ := ParseTimestamp(comment.Timestamp)
+
+		// the same comment sent twice at once is told apart by its order
+		key := customerRecordID(comment)
+		keyCounts[key]++
+
+		if keyCounts[key] > 1 {
+			key = fmt.Sprintf("%s#%d", key, keyCounts[key])
+		}
+
+		records = append(records, Record{
+			ID:        key,
+			Time:      timestamp,
+			Text:      comment.Comment,
+			Sentiment: comment.Sentiment,
+			Entity:    comment.Entity,
+		})
+	}
+
+	return records
+}
+
+// JoinPosts fills in the time and text of records read from an analyzed reddit file from the original posts
+func JoinPosts(records []Record, posts []RedditPost) []Record {
+	postRecords := make(map[string]Record)
+
+	for _, record := range PostRecords(posts) {
+		postRecords[record.ID] = record
+	}
+
+	for i := 0; i < len(records); i++ {
+		if post, ok := postRecords[records[i].ID]; ok {
+			records[i].Time = post.Time
+			records[i].Text = post.Text
+		}
+	}
+
+	return records
+}
@@ -0,0 +1,242 @@
+package sentiment
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Redaction records a kind of personal information replaced in a comment before it was sent to Google's api
+// the redacted values themselves are never kept
+type Redaction struct {
+	Detector string `json:"detector"`
+	Token    string `json:"token"`
+	Count    int    `json:"count"`
+}
+
+// Detector finds a kind of personal information and replaces it with Token
+type Detector struct {
+	Name    string
+	Token   string
+	Pattern *regexp.Regexp
+}
+
+// NewRegexDetector creates a detector replacing every match of pattern
+func NewRegexDetector(name string, token string, pattern string) (Detector, error) {
+	compiled, err := regexp.Compile(pattern)
+
+	if err != nil {
+		return Detector{}, fmt.Errorf("compiling pattern of detector \"%s\" failed: %v", name, err)
+	}
+
+	return Detector{
+		Name:    name,
+		Token:   token,
+		Pattern: compiled,
+	}, nil
+}
+
+// NewDictionaryDetector creates a detector replacing the whole words, case insensitive, found in words
+func NewDictionaryDetector(name string, token string, words []string) Detector {
+	quotedWords := make([]string, 0)
+
+	for i := 0; i < len(words); i++ {
+		word := strings.TrimSpace(words[i])
+
+		if word == "" {
+			continue
+		}
+
+		quotedWords = append(quotedWords, regexp.QuoteMeta(word))
+	}
+
+	// a pattern that never matches when there are no words
+	pattern := `[^\s\S]`
+
+	if len(quotedWords) > 0 {
+		pattern = `(?i)\b(?:` + strings.Join(quotedWords, "|") + `)\b`
+	}
+
+	return Detector{
+		Name:    name,
+		Token:   token,
+		Pattern: regexp.MustCompile(pattern),
+	}
+}
+
+// DefaultDetectors finds emails, order numbers, card numbers and phone numbers.
+// order numbers and card numbers run before phone numbers, so their digits are not mistaken as a phone number
+func DefaultDetectors() []Detector {
+	return []Detector{
+		{
+			Name:    "email",
+			Token:   "[EMAIL]",
+			Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		},
+		{
+			Name:    "order",
+			Token:   "[ORDER]",
+			Pattern: regexp.MustCompile(`(?i)\border\s*(?:number|num|no\.?|id)?\s*[:#]?\s*[A-Z0-9-]*\d[A-Z0-9-]{3,}`),
+		},
+		{
+			Name:    "card",
+			Token:   "[CARD]",
+			Pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		},
+		{
+			Name:    "phone",
+			Token:   "[PHONE]",
+			Pattern: regexp.MustCompile(`(?:\+?\d{1,3}[\s.-]?)?(?:\(\d{3}\)|\b\d{3})[\s.-]?\d{3}[\s.-]?\d{4}\b`),
+		},
+	}
+}
+
+// DetectorConfig is a regex detector in json, e.g. {"name": "ssn", "token": "[SSN]", "pattern": "\\b\\d{3}-\\d{2}-\\d{4}\\b"}
+// a config naming a default detector without a pattern keeps the default pattern with its own token
+type DetectorConfig struct {
+	Name    string `json:"name"`
+	Token   string `json:"token"`
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// NewDetectors creates the detectors of configs, they run in the order of configs
+func NewDetectors(configs []DetectorConfig) ([]Detector, error) {
+	defaults := make(map[string]Detector)
+
+	for _, detector := range DefaultDetectors() {
+		defaults[detector.Name] = detector
+	}
+
+	detectors := make([]Detector, 0)
+
+	for i := 0; i < len(configs); i++ {
+		config := configs[i]
+
+		if config.Name == "" || config.Token == "" {
+			return nil, fmt.Errorf("detector %d needs a name and a token", i+1)
+		}
+
+		if config.Pattern == "" {
+			detector, ok := defaults[config.Name]
+
+			if !ok {
+				return nil, fmt.Errorf("detector \"%s\" needs a pattern, there is no default detector of that name", config.Name)
+			}
+
+			detector.Token = config.Token
+			detectors = append(detectors, detector)
+
+			continue
+		}
+
+		detector, err := NewRegexDetector(config.Name, config.Token, config.Pattern)
+
+		if err != nil {
+			return nil, err
+		}
+
+		detectors = append(detectors, detector)
+	}
+
+	return detectors, nil
+}
+
+// LoadRedactor creates a redactor from json detector configs, the default detectors when detectorsJSON is empty,
+// and adds a dictionary detector replacing the names in dictionary, one per line, with nameToken when dictionary is not nil
+func LoadRedactor(detectorsJSON []byte, dictionary io.Reader, nameToken string) (*Redactor, error) {
+	detectors := DefaultDetectors()
+
+	if len(detectorsJSON) > 0 {
+		var configs []DetectorConfig
+
+		if err := json.Unmarshal(detectorsJSON, &configs); err != nil {
+			return nil, fmt.Errorf("parsing redaction detectors failed: %v", err)
+		}
+
+		var err error
+
+		if detectors, err = NewDetectors(configs); err != nil {
+			return nil, err
+		}
+	}
+
+	if dictionary == nil {
+		return NewRedactor(detectors...), nil
+	}
+
+	if nameToken == "" {
+		return nil, fmt.Errorf("a redaction dictionary needs a name token")
+	}
+
+	var names []string
+
+	scanner := bufio.NewScanner(dictionary)
+
+	for scanner.Scan() {
+		names = append(names, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading redaction dictionary failed: %v", err)
+	}
+
+	detectors = append(detectors, NewDictionaryDetector("name", nameToken, names))
+
+	return NewRedactor(detectors...), nil
+}
+
+// Redactor replaces personal information in text, the detectors run in order
+type Redactor struct {
+	Detectors []Detector
+}
+
+// NewRedactor creates a redactor running detectors in order
+func NewRedactor(detectors ...Detector) *Redactor {
+	return &Redactor{
+		Detectors: detectors,
+	}
+}
+
+// Redact replaces the matches of every detector in text with the detector's token
+func (redactor *Redactor) Redact(text string) (string, []Redaction) {
+	redactions := make([]Redaction, 0)
+
+	for i := 0; i < len(redactor.Detectors); i++ {
+		detector := redactor.Detectors[i]
+		count := 0
+
+		text = detector.Pattern.ReplaceAllStringFunc(text, func(match string) string {
+			count++
+
+			return detector.Token
+		})
+
+		if count == 0 {
+			continue
+		}
+
+		redactions = append(redactions, Redaction{
+			Detector: detector.Name,
+			Token:    detector.Token,
+			Count:    count,
+		})
+	}
+
+	return text, redactions
+}
+
+// RedactCustomerComments replaces the personal information in each comment and records the redactions,
+// AnalyzeCustomerComments runs it before any comment is sent
+func RedactCustomerComments(redactor *Redactor, comments []CustomerAnalysis) []CustomerAnalysis {
+	for i := 0; i < len(comments); i++ {
+		redacted, redactions := redactor.Redact(comments[i].Comment)
+
+		comments[i].Comment = redacted
+		comments[i].Redactions = append(comments[i].Redactions, redactions...)
+	}
+
+	return comments
+}
@@ -0,0 +1,188 @@
+package sentiment
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis/languagetest"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		want      string
+		wantNames []string
+	}{
+		{
+			name: "keeps text without personal information",
+			text: "the soup was cold",
+			want: "the soup was cold",
+		},
+		{
+			name:      "replaces emails",
+			text:      "write me at jane.doe@example.com please",
+			want:      "write me at [EMAIL] please",
+			wantNames: []string{"email"},
+		},
+		{
+			name:      "replaces order numbers before phone numbers",
+			text:      "order #A1234567890 never came, call 555-123-4567",
+			want:      "[ORDER] never came, call [PHONE]",
+			wantNames: []string{"order", "phone"},
+		},
+		{
+			name:      "replaces card numbers",
+			text:      "charged twice on 4111 1111 1111 1111",
+			want:      "charged twice on [CARD]",
+			wantNames: []string{"card"},
+		},
+	}
+
+	redactor := NewRedactor(DefaultDetectors()...)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			redacted, redactions := redactor.Redact(test.text)
+
+			if redacted != test.want {
+				t.Errorf("got \"%s\", want \"%s\"", redacted, test.want)
+			}
+
+			names := make([]string, 0)
+
+			for _, redaction := range redactions {
+				names = append(names, redaction.Detector)
+			}
+
+			if strings.Join(names, ",") != strings.Join(test.wantNames, ",") {
+				t.Errorf("got redactions %v, want %v", names, test.wantNames)
+			}
+		})
+	}
+}
+
+func TestLoadRedactor(t *testing.T) {
+	tests := []struct {
+		name       string
+		detectors  string
+		dictionary string
+		nameToken  string
+		text       string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name: "uses the default detectors without a config",
+			text: "mail bob@example.com",
+			want: "mail [EMAIL]",
+		},
+		{
+			name:      "uses only the configured detectors",
+			detectors: `[{"name": "ssn", "token": "[SSN]", "pattern": "\\b\\d{3}-\\d{2}-\\d{4}\\b"}]`,
+			text:      "ssn 123-45-6789 mail bob@example.com",
+			want:      "ssn [SSN] mail bob@example.com",
+		},
+		{
+			name:      "renames the token of a default detector",
+			detectors: `[{"name": "email", "token": "<email>"}]`,
+			text:      "mail bob@example.com",
+			want:      "mail <email>",
+		},
+		{
+			name:       "replaces the names of the dictionary",
+			dictionary: "Alice\nBob\n",
+			nameToken:  "[NAME]",
+			text:       "alice helped me, BOB did not",
+			want:       "[NAME] helped me, [NAME] did not",
+		},
+		{
+			name:      "rejects an unknown detector without a pattern",
+			detectors: `[{"name": "ssn", "token": "[SSN]"}]`,
+			wantErr:   true,
+		},
+		{
+			name:      "rejects an invalid pattern",
+			detectors: `[{"name": "ssn", "token": "[SSN]", "pattern": "("}]`,
+			wantErr:   true,
+		},
+		{
+			name:       "rejects a dictionary without a name token",
+			dictionary: "Alice\n",
+			wantErr:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var dictionary io.Reader
+
+			if test.dictionary != "" {
+				dictionary = strings.NewReader(test.dictionary)
+			}
+
+			redactor, err := LoadRedactor([]byte(test.detectors), dictionary, test.nameToken)
+
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if redacted, _ := redactor.Redact(test.text); redacted != test.want {
+				t.Errorf("got \"%s\", want \"%s\"", redacted, test.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeCustomerCommentsRedacts(t *testing.T) {
+	tests := []struct {
+		name     string
+		redactor *Redactor
+		comment  string
+		wantText string
+	}{
+		{
+			name:     "redacts with the default detectors without a redactor",
+			comment:  "refund to jane@example.com",
+			wantText: "refund to [EMAIL]",
+		},
+		{
+			name:     "redacts with the given redactor",
+			redactor: NewRedactor(NewDictionaryDetector("name", "[NAME]", []string{"Jane"})),
+			comment:  "Jane was rude",
+			wantText: "[NAME] was rude",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, client := newTestClient(t)
+
+			server.QueueEntitySentiment(languagetest.EntitySentimentResponse(), nil)
+
+			comments, err := AnalyzeCustomerComments(context.Background(), client, test.redactor, []CustomerAnalysis{
+				{Comment: test.comment},
+			})
+
+			if err != nil {
+				t.Fatalf("analyzing failed: %v", err)
+			}
+
+			calls := server.Calls()
+
+			if len(calls) != 1 || calls[0].Text != test.wantText {
+				t.Fatalf("got calls %v, want a single call with \"%s\"", calls, test.wantText)
+			}
+
+			if comments[0].Comment != test.wantText || len(comments[0].Redactions) != 1 {
+				t.Errorf("got comment \"%s\" with %d redactions", comments[0].Comment, len(comments[0].Redactions))
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package sentiment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/googleapis/gax-go/v2"
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	sentimentMethod       = "AnalyzeSentiment"
+	entitySentimentMethod = "AnalyzeEntitySentiment"
+)
+
+// ErrUnmatchedRequest is returned by the Replayer for requests that are not in its fixture
+var ErrUnmatchedRequest = errors.New("request not found in fixture")
+
+// fixtureEntry is a single request/response pair, written as a line of json in a fixture file
+type fixtureEntry struct {
+	Method   string          `json:"method"`
+	Text     string          `json:"text"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Code     codes.Code      `json:"code,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// Recorder is an Analyzer that forwards every request to another Analyzer
+// and writes the request/response pairs to a fixture for the Replayer
+type Recorder struct {
+	analyzer Analyzer
+
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewRecorder records the requests sent to analyzer into fixture
+func NewRecorder(analyzer Analyzer, fixture io.Writer) *Recorder {
+	return &Recorder{
+		analyzer: analyzer,
+		encoder:  json.NewEncoder(fixture),
+	}
+}
+
+func (recorder *Recorder) record(method string, text string, response proto.Message, err error) error {
+	entry := fixtureEntry{
+		Method: method,
+		Text:   text,
+	}
+
+	if err != nil {
+		entry.Code = status.Code(err)
+		entry.Error = status.Convert(err).Message()
+	} else {
+		responseBytes, err := protojson.Marshal(response)
+
+		if err != nil {
+			return fmt.Errorf("encoding response failed: %v", err)
+		}
+
+		entry.Response = responseBytes
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	if err := recorder.encoder.Encode(entry); err != nil {
+		return fmt.Errorf("writing fixture failed: %v", err)
+	}
+
+	return nil
+}
+
+// AnalyzeSentiment forwards the request and records the response
+func (recorder *Recorder) AnalyzeSentiment(ctx context.Context, req *languagepb.AnalyzeSentimentRequest, opts ...gax.CallOption) (*languagepb.AnalyzeSentimentResponse, error) {
+	response, err := recorder.analyzer.AnalyzeSentiment(ctx, req, opts...)
+
+	if recordErr := recorder.record(sentimentMethod, req.Document.GetContent(), response, err); recordErr != nil {
+		return nil, recordErr
+	}
+
+	return response, err
+}
+
+// AnalyzeEntitySentiment forwards the request and records the response
+func (recorder *Recorder) AnalyzeEntitySentiment(ctx context.Context, req *languagepb.AnalyzeEntitySentimentRequest, opts ...gax.CallOption) (*languagepb.AnalyzeEntitySentimentResponse, error) {
+	response, err := recorder.analyzer.AnalyzeEntitySentiment(ctx, req, opts...)
+
+	if recordErr := recorder.record(entitySentimentMethod, req.Document.GetContent(), response, err); recordErr != nil {
+		return nil, recordErr
+	}
+
+	return response, err
+}
+
+// Replayer is an Analyzer that serves the responses of a fixture written by the Recorder.
+// Requests are matched on their method and text, a request recorded several times
+// is replayed in the recorded order and the last response repeats after that.
+// replayed requests are not billed, so they are left out of the Usage
+type Replayer struct {
+	mu      sync.Mutex
+	entries map[string][]fixtureEntry
+}
+
+// NewReplayer reads every request/response pair of fixture
+func NewReplayer(fixture io.Reader) (*Replayer, error) {
+	replayer := &Replayer{
+		entries: make(map[string][]fixtureEntry),
+	}
+
+	decoder := json.NewDecoder(fixture)
+
+	for decoder.More() {
+		var entry fixtureEntry
+
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("parsing fixture failed: %v", err)
+		}
+
+		key := fixtureKey(entry.Method, entry.Text)
+
+		replayer.entries[key] = append(replayer.entries[key], entry)
+	}
+
+	return replayer, nil
+}
+
+func fixtureKey(method string, text string) string {
+	return method + "\x00" + text
+}
+
+// next finds the entry of the request and unmarshals its response, a done ctx fails like a call to Google's api
+func (replayer *Replayer) next(ctx context.Context, method string, text string, response proto.Message) error {
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+
+	replayer.mu.Lock()
+
+	key := fixtureKey(method, text)
+	entries := replayer.entries[key]
+
+	if len(entries) == 0 {
+		replayer.mu.Unlock()
+
+		return fmt.Errorf("%w: %s %q", ErrUnmatchedRequest, method, text)
+	}
+
+	entry := entries[0]
+
+	if len(entries) > 1 {
+		replayer.entries[key] = entries[1:]
+	}
+
+	replayer.mu.Unlock()
+
+	if entry.Error != "" || entry.Code != codes.OK {
+		return status.Error(entry.Code, entry.Error)
+	}
+
+	if err := protojson.Unmarshal(entry.Response, response); err != nil {
+		return fmt.Errorf("parsing recorded response failed: %v", err)
+	}
+
+	return nil
+}
+
+// AnalyzeSentiment replays the recorded response of the request
+func (replayer *Replayer) AnalyzeSentiment(ctx context.Context, req *languagepb.AnalyzeSentimentRequest, opts ...gax.CallOption) (*languagepb.AnalyzeSentimentResponse, error) {
+	response := &languagepb.AnalyzeSentimentResponse{}
+
+	if err := replayer.next(ctx, sentimentMethod, req.Document.GetContent(), response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// AnalyzeEntitySentiment replays the recorded response of the request
+func (replayer *Replayer) AnalyzeEntitySentiment(ctx context.Context, req *languagepb.AnalyzeEntitySentimentRequest, opts ...gax.CallOption) (*languagepb.AnalyzeEntitySentimentResponse, error) {
+	response := &languagepb.AnalyzeEntitySentimentResponse{}
+
+	if err := replayer.next(ctx, entitySentimentMethod, req.Document.GetContent(), response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
@@ -0,0 +1,142 @@
+package sentiment
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/SADA-U-Session-3/sentiment-analysis/languagetest"
+	languagepb "google.golang.org/genproto/googleapis/cloud/language/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func sentimentRequest(text string) *languagepb.AnalyzeSentimentRequest {
+	return &languagepb.AnalyzeSentimentRequest{
+		Document: &languagepb.Document{
+			Source: &languagepb.Document_Content{
+				Content: text,
+			},
+			Type: languagepb.Document_PLAIN_TEXT,
+		},
+	}
+}
+
+// recordFixture records the replies of a fake api to texts
+func recordFixture(t *testing.T, texts []string, replies []error) *bytes.Buffer {
+	t.Helper()
+
+	server, client := newTestClient(t)
+
+	for i := 0; i < len(texts); i++ {
+		server.QueueSentiment(languagetest.SentimentResponse(float32(i+1)/10), replies[i])
+	}
+
+	fixture := &bytes.Buffer{}
+	recorder := NewRecorder(client, fixture)
+
+	for _, text := range texts {
+		recorder.AnalyzeSentiment(context.Background(), sentimentRequest(text))
+	}
+
+	return fixture
+}
+
+func TestReplayer(t *testing.T) {
+	tests := []struct {
+		name      string
+		recorded  []string
+		replies   []error
+		requests  []string
+		cancelled bool
+		wantScore []float32
+		wantCodes []codes.Code
+		wantErr   error
+	}{
+		{
+			name:      "replays the recorded responses",
+			recorded:  []string{"good", "bad"},
+			replies:   []error{nil, nil},
+			requests:  []string{"bad", "good"},
+			wantScore: []float32{0.2, 0.1},
+			wantCodes: []codes.Code{codes.OK, codes.OK},
+		},
+		{
+			name:      "repeats the last response of a text",
+			recorded:  []string{"good", "good"},
+			replies:   []error{nil, nil},
+			requests:  []string{"good", "good", "good"},
+			wantScore: []float32{0.1, 0.2, 0.2},
+			wantCodes: []codes.Code{codes.OK, codes.OK, codes.OK},
+		},
+		{
+			name:      "replays the recorded errors",
+			recorded:  []string{"good"},
+			replies:   []error{status.Error(codes.InvalidArgument, "bad document")},
+			requests:  []string{"good"},
+			wantScore: []float32{0},
+			wantCodes: []codes.Code{codes.InvalidArgument},
+		},
+		{
+			name:     "fails on texts that were not recorded",
+			recorded: []string{"good"},
+			replies:  []error{nil},
+			requests: []string{"other"},
+			wantErr:  ErrUnmatchedRequest,
+		},
+		{
+			name:      "honors a cancelled context",
+			recorded:  []string{"good"},
+			replies:   []error{nil},
+			requests:  []string{"good"},
+			cancelled: true,
+			wantScore: []float32{0},
+			wantCodes: []codes.Code{codes.Canceled},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			replayer, err := NewReplayer(recordFixture(t, test.recorded, test.replies))
+
+			if err != nil {
+				t.Fatalf("reading fixture failed: %v", err)
+			}
+
+			usage := NewUsage()
+			ctx, cancel := context.WithCancel(WithUsage(context.Background(), usage))
+
+			defer cancel()
+
+			if test.cancelled {
+				cancel()
+			}
+
+			for i, text := range test.requests {
+				response, err := analyzeSentiment(ctx, replayer, text)
+
+				if test.wantErr != nil {
+					if !errors.Is(err, test.wantErr) {
+						t.Fatalf("got error %v, want %v", err, test.wantErr)
+					}
+
+					continue
+				}
+
+				if code := status.Code(err); code != test.wantCodes[i] {
+					t.Fatalf("request %d: got error %v, want code %s", i, err, test.wantCodes[i])
+				}
+
+				if err == nil && response.DocumentSentiment.Score != test.wantScore[i] {
+					t.Errorf("request %d: got score %v, want %v", i, response.DocumentSentiment.Score, test.wantScore[i])
+				}
+			}
+
+			// replayed requests are not billed
+			if usage.TotalUnits != 0 {
+				t.Errorf("got %d billed units from a fixture", usage.TotalUnits)
+			}
+		})
+	}
+}
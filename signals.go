@@ -0,0 +1,302 @@
+package sentiment
+
+import (
+	"strings"
+	"unicode"
+)
+
+// textSignal is the sentiment of an emoji, emoticon or slang word and the plain words the api reads instead
+type textSignal struct {
+	score float32
+	words string
+}
+
+// emoticons must be a whole token, so urls such as http:// are not mistaken for :/
+var emoticons = map[string]textSignal{
+	":)": {0.6, "happy"}, ":-)": {0.6, "happy"}, "(:": {0.6, "happy"},
+	":D": {0.8, "laughing"}, ":-D": {0.8, "laughing"}, "xD": {0.7, "laughing"}, "XD": {0.7, "laughing"},
+	";)": {0.4, "winking"}, ";-)": {0.4, "winking"}, ":P": {0.3, "playful"}, ":p": {0.3, "playful"},
+	":(": {-0.6, "sad"}, ":-(": {-0.6, "sad"}, "):": {-0.6, "sad"}, ":'(": {-0.8, "crying"},
+	":/": {-0.3, "unsure"}, ":-/": {-0.3, "unsure"}, ":|": {-0.1, "indifferent"},
+	">:(": {-0.8, "angry"}, "<3": {0.7, "love"}, "</3": {-0.7, "heartbroken"},
+}
+
+// slang is matched case insensitive on whole words
+var slang = map[string]textSignal{
+	"lol": {0.4, "laughing"}, "lmao": {0.5, "laughing"}, "rofl": {0.5, "laughing"}, "haha": {0.4, "laughing"},
+	"smh": {-0.5, "shaking my head"}, "wtf": {-0.6, "what the hell"}, "fml": {-0.7, "my life is terrible"},
+	"ffs": {-0.6, "for heaven's sake"}, "ty": {0.5, "thank you"}, "tysm": {0.7, "thank you so much"},
+	"ily": {0.8, "i love you"}, "idk": {-0.1, "i don't know"}, "meh": {-0.3, "mediocre"},
+	"yikes": {-0.5, "bad"}, "ugh": {-0.5, "annoyed"}, "rip": {-0.4, "rest in peace"},
+	"cringe": {-0.5, "embarrassing"}, "sus": {-0.3, "suspicious"}, "bruh": {-0.2, "disbelief"},
+	"pog": {0.6, "great"},
+}
+
+// emoji are matched anywhere in the text, their variation selectors are ignored
+var emoji = map[rune]textSignal{
+	'\U0001F602': {0.5, "laughing"},      // face with tears of joy
+	'\U0001F923': {0.6, "laughing"},      // rolling on the floor laughing
+	'\U0001F600': {0.6, "happy"},         // grinning face
+	'\U0001F603': {0.6, "happy"},         // grinning face with big eyes
+	'\U0001F604': {0.6, "happy"},         // grinning face with smiling eyes
+	'\U0001F601': {0.6, "happy"},         // beaming face
+	'\U0001F60A': {0.6, "happy"},         // smiling face with smiling eyes
+	'\U0001F642': {0.3, "pleased"},       // slightly smiling face
+	'\U0001F60D': {0.8, "love"},          // smiling face with heart eyes
+	'\U0001F970': {0.8, "love"},          // smiling face with hearts
+	'\u2764':     {0.7, "love"},          // red heart
+	'\U0001F44D': {0.5, "good"},          // thumbs up
+	'\U0001F44E': {-0.5, "bad"},          // thumbs down
+	'\U0001F525': {0.5, "great"},         // fire
+	'\U0001F389': {0.6, "celebrate"},     // party popper
+	'\U0001F4AF': {0.6, "perfect"},       // hundred points
+	'\U0001F64F': {0.4, "thanks"},        // folded hands
+	'\U0001F622': {-0.6, "sad"},          // crying face
+	'\U0001F62D': {-0.5, "crying"},       // loudly crying face
+	'\U0001F61E': {-0.5, "disappointed"}, // disappointed face
+	'\U0001F629': {-0.5, "weary"},        // weary face
+	'\U0001F494': {-0.7, "heartbroken"},  // broken heart
+	'\U0001F621': {-0.8, "angry"},        // pouting face
+	'\U0001F620': {-0.7, "angry"},        // angry face
+	'\U0001F92C': {-0.9, "furious"},      // face with symbols on mouth
+	'\U0001F644': {-0.4, "annoyed"},      // face with rolling eyes
+	'\U0001F612': {-0.4, "unamused"},     // unamused face
+	'\U0001F92E': {-0.8, "disgusting"},   // face vomiting
+	'\U0001F4A9': {-0.6, "crap"},         // pile of poo
+	'\U0001F631': {-0.4, "shocked"},      // face screaming in fear
+	'\U0001F62C': {-0.3, "awkward"},      // grimacing face
+	'\U0001F610': {-0.1, "indifferent"},  // neutral face
+	'\U0001F914': {0, "thinking"},        // thinking face
+}
+
+const (
+	// sarcasmMarker is reddit's way of saying the opposite of what was written
+	sarcasmMarker = "/s"
+
+	// the weight of the signals grows with each signal found, up to maxSignalWeight
+	signalWeight    = 0.15
+	maxSignalWeight = 0.5
+
+	// shouting makes the sentiment stronger
+	shoutingFactor = 1.3
+)
+
+// TextSignals are the emoji, emoticons and slang found in a text and how they adjusted the api's score
+type TextSignals struct {
+	Score     float32 `json:"score"`
+	Emoji     int     `json:"emoji"`
+	Emoticons int     `json:"emoticons"`
+	Slang     int     `json:"slang"`
+	Sarcasm   bool    `json:"sarcasm"`
+	Shouting  bool    `json:"shouting"`
+
+	// RawScore is the score of the api before the signals adjusted it
+	RawScore *float32 `json:"rawScore,omitempty"`
+}
+
+func (signals TextSignals) count() int {
+	return signals.Emoji + signals.Emoticons + signals.Slang
+}
+
+// mapTokens replaces every whitespace separated token of text, keeping the whitespace as is
+func mapTokens(text string, mapper func(token string) string) string {
+	var builder strings.Builder
+
+	tokenStart := -1
+
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if tokenStart >= 0 {
+				builder.WriteString(mapper(text[tokenStart:i]))
+				tokenStart = -1
+			}
+
+			builder.WriteRune(r)
+		} else if tokenStart < 0 {
+			tokenStart = i
+		}
+	}
+
+	if tokenStart >= 0 {
+		builder.WriteString(mapper(text[tokenStart:]))
+	}
+
+	return builder.String()
+}
+
+// slangWord lowercases token and trims the punctuation around it
+func slangWord(token string) string {
+	return strings.ToLower(strings.TrimFunc(token, unicode.IsPunct))
+}
+
+// isShouting checks if most of the words of at least 3 letters are all caps, slang such as LOL does not count
+func isShouting(text string) bool {
+	words := 0
+	shouted := 0
+
+	for _, token := range strings.Fields(text) {
+		word := strings.TrimFunc(token, func(r rune) bool {
+			return !unicode.IsLetter(r)
+		})
+
+		if len([]rune(word)) < 3 {
+			continue
+		}
+
+		if _, ok := slang[strings.ToLower(word)]; ok {
+			continue
+		}
+
+		words++
+
+		if strings.ToUpper(word) == word && strings.ToLower(word) != word {
+			shouted++
+		}
+	}
+
+	return words >= 3 && float64(shouted)/float64(words) >= 0.6
+}
+
+// ExtractSignals finds the emoji, emoticons, slang, sarcasm marker and shouting in text
+func ExtractSignals(text string) TextSignals {
+	signals := TextSignals{}
+	scoreSum := float32(0)
+
+	for _, token := range strings.Fields(text) {
+		if token == sarcasmMarker {
+			signals.Sarcasm = true
+
+			continue
+		}
+
+		if signal, ok := emoticons[token]; ok {
+			signals.Emoticons++
+			scoreSum += signal.score
+
+			continue
+		}
+
+		if signal, ok := slang[slangWord(token)]; ok {
+			signals.Slang++
+			scoreSum += signal.score
+
+			continue
+		}
+
+		for _, r := range token {
+			if signal, ok := emoji[r]; ok {
+				signals.Emoji++
+				scoreSum += signal.score
+			}
+		}
+	}
+
+	if signals.count() > 0 {
+		signals.Score = scoreSum / float32(signals.count())
+	}
+
+	signals.Shouting = isShouting(text)
+
+	return signals
+}
+
+// NormalizeText replaces emoji, emoticons and slang with plain words and removes the sarcasm marker,
+// so the api reads what was meant
+func NormalizeText(text string) string {
+	return mapTokens(text, func(token string) string {
+		if token == sarcasmMarker {
+			return ""
+		}
+
+		if signal, ok := emoticons[token]; ok {
+			return signal.words
+		}
+
+		if signal, ok := slang[slangWord(token)]; ok {
+			return signal.words
+		}
+
+		var builder strings.Builder
+
+		for _, r := range token {
+			// variation selector, it only changes how the emoji before it looks
+			if r == '\ufe0f' {
+				continue
+			}
+
+			if signal, ok := emoji[r]; ok {
+				builder.WriteString(" " + signal.words + " ")
+
+				continue
+			}
+
+			builder.WriteRune(r)
+		}
+
+		return strings.Join(strings.Fields(builder.String()), " ")
+	})
+}
+
+// AdjustSentiment blends the signals into the api's sentiment, strengthens it when shouting
+// and flips it when the text is marked as sarcasm
+func AdjustSentiment(sentiment SentimentWrapper, signals *TextSignals) SentimentWrapper {
+	if signals == nil {
+		return sentiment
+	}
+
+	rawScore := sentiment.Score
+	score := rawScore
+
+	if signals.count() > 0 {
+		weight := float32(signals.count()) * signalWeight
+
+		if weight > maxSignalWeight {
+			weight = maxSignalWeight
+		}
+
+		score = score*(1-weight) + signals.Score*weight
+	}
+
+	if signals.Shouting {
+		score *= shoutingFactor
+	}
+
+	if signals.Sarcasm {
+		score = -score
+	}
+
+	if score > 1 {
+		score = 1
+	} else if score < -1 {
+		score = -1
+	}
+
+	signals.RawScore = &rawScore
+
+	return SentimentWrapper{
+		Score:           score,
+		ParsedSentiment: parseSentiment(score),
+	}
+}
+
+// PrepareSignals extracts the signals of each post's body, the text the api scores, and normalizes the body
+// sent to the api into NormalizedBody, the body itself is kept, run AdjustPostSentiment once the posts are analyzed
+func PrepareSignals(posts []RedditPost) []RedditPost {
+	for i := 0; i < len(posts); i++ {
+		signals := ExtractSignals(posts[i].Body)
+
+		posts[i].Analysis.Signals = &signals
+		posts[i].NormalizedBody = NormalizeText(posts[i].Body)
+	}
+
+	return posts
+}
+
+// AdjustPostSentiment adjusts the analyzed sentiment of each post by the signals found by PrepareSignals
+func AdjustPostSentiment(posts []RedditPost) []RedditPost {
+	for i := 0; i < len(posts); i++ {
+		posts[i].Analysis.Sentiment = AdjustSentiment(posts[i].Analysis.Sentiment, posts[i].Analysis.Signals)
+	}
+
+	return posts
+}
@@ -0,0 +1,128 @@
+package sentiment
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExtractSignals(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want TextSignals
+	}{
+		{
+			name: "averages the emoji, emoticons and slang",
+			text: "lol that was great :) \U0001F44D /s",
+			want: TextSignals{Score: 0.5, Emoji: 1, Emoticons: 1, Slang: 1, Sarcasm: true},
+		},
+		{
+			name: "matches emoticons on whole tokens only",
+			text: "see http://example.com :/",
+			want: TextSignals{Score: -0.3, Emoticons: 1},
+		},
+		{
+			name: "finds shouting",
+			text: "THIS IS THE WORST SERVICE",
+			want: TextSignals{Shouting: true},
+		},
+		{
+			name: "does not count slang as shouting",
+			text: "LOL OMG ok then",
+			want: TextSignals{Score: 0.4, Slang: 1},
+		},
+		{
+			name: "finds nothing in plain text",
+			text: "the soup was cold",
+			want: TextSignals{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			signals := ExtractSignals(test.text)
+
+			if math.Abs(float64(signals.Score-test.want.Score)) > 1e-6 {
+				t.Errorf("got score %v, want %v", signals.Score, test.want.Score)
+			}
+
+			signals.Score = test.want.Score
+
+			if signals != test.want {
+				t.Errorf("got signals %+v, want %+v", signals, test.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "replaces slang and emoticons", text: "ty :)", want: "thank you happy"},
+		{name: "replaces emoji without their variation selector", text: "love it❤️", want: "love it love"},
+		{name: "removes the sarcasm marker", text: "great service /s", want: "great service "},
+		{name: "keeps the whitespace", text: "line one\nsmh", want: "line one\nshaking my head"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if normalized := NormalizeText(test.text); normalized != test.want {
+				t.Errorf("got \"%s\", want \"%s\"", normalized, test.want)
+			}
+		})
+	}
+}
+
+func TestAdjustSentiment(t *testing.T) {
+	tests := []struct {
+		name      string
+		score     float32
+		signals   *TextSignals
+		wantScore float32
+	}{
+		{name: "keeps the score without signals", score: 0.2, wantScore: 0.2},
+		{name: "blends the signals in", score: 0.2, signals: &TextSignals{Score: 0.8, Emoji: 1, Slang: 1}, wantScore: 0.38},
+		{name: "caps the weight of the signals", score: 0, signals: &TextSignals{Score: 1, Emoji: 10}, wantScore: 0.5},
+		{name: "strengthens shouting", score: 0.5, signals: &TextSignals{Shouting: true}, wantScore: 0.65},
+		{name: "flips sarcasm", score: 0.4, signals: &TextSignals{Sarcasm: true}, wantScore: -0.4},
+		{name: "stays within -1 and 1", score: -0.9, signals: &TextSignals{Shouting: true}, wantScore: -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			adjusted := AdjustSentiment(SentimentWrapper{Score: test.score, ParsedSentiment: parseSentiment(test.score)}, test.signals)
+
+			if math.Abs(float64(adjusted.Score-test.wantScore)) > 1e-6 {
+				t.Errorf("got score %v, want %v", adjusted.Score, test.wantScore)
+			}
+
+			if adjusted.ParsedSentiment != parseSentiment(adjusted.Score) {
+				t.Errorf("got label \"%s\" for score %v", adjusted.ParsedSentiment, adjusted.Score)
+			}
+
+			if test.signals != nil && (test.signals.RawScore == nil || *test.signals.RawScore != test.score) {
+				t.Errorf("got raw score %v, want %v", test.signals.RawScore, test.score)
+			}
+		})
+	}
+}
+
+func TestPrepareSignals(t *testing.T) {
+	posts := PrepareSignals([]RedditPost{
+		{ID: "a", Title: "LOL :)", Body: "meh, it was ok"},
+	})
+
+	signals := posts[0].Analysis.Signals
+
+	// the api only scores the body, so the signals of the title are left out
+	if signals == nil || signals.Slang != 1 || signals.Emoticons != 0 || math.Abs(float64(signals.Score+0.3)) > 1e-6 {
+		t.Errorf("got signals %+v, want the slang of the body only", signals)
+	}
+
+	if posts[0].NormalizedBody != "mediocre it was ok" {
+		t.Errorf("got normalized body \"%s\"", posts[0].NormalizedBody)
+	}
+}